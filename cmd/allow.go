@@ -9,9 +9,28 @@ import (
 var allowCmd = &cobra.Command{
 	Use:   "allow",
 	Short: "Add go pkg to allow list",
-	Long:  `Add go pkg to allow list`,
-	Args:  cobra.ExactArgs(1),
+	Long: `Add go pkg to allow list.
+With --env, add an environment variable name pattern (e.g. CI_*) that the env module may read instead.`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
+		allowEnv, _ := cmd.Flags().GetBool("env")
+		if allowEnv {
+			pattern := args[0]
+			viper.Set(
+				"AllowedEnvVars",
+				append(
+					viper.GetStringSlice("AllowedEnvVars"),
+					pattern,
+				),
+			)
+			err := viper.WriteConfig()
+			if err != nil {
+				panic(err)
+			}
+			fmt.Printf("Added %s to allowed environment variables\n", pattern)
+			return
+		}
+
 		pkg := args[0]
 		viper.Set(
 			"AllowedGoPkgs",
@@ -30,4 +49,5 @@ var allowCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(allowCmd)
+	allowCmd.Flags().Bool("env", false, "Allow reading environment variables matching the pattern")
 }
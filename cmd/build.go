@@ -1,13 +1,16 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/totegamma/yisp/core"
+	"github.com/totegamma/yisp/diff"
 	"github.com/totegamma/yisp/engine"
 )
 
@@ -17,35 +20,89 @@ var buildCmd = &cobra.Command{
 	Long:  `Build the yaml file from the yisp script`,
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
+		// exitCode is set by --check and --output-dir; the deferred exit runs after the profile and coverage writers
+		exitCode := 0
+		defer func() {
+			if exitCode != 0 {
+				os.Exit(exitCode)
+			}
+		}()
 
-		showTrace, _ := cmd.Flags().GetBool("show-trace")
 		renderSpecialObjects, _ := cmd.Flags().GetBool("render-special-objects")
 		renderSourceMap, _ := cmd.Flags().GetBool("enable-sourcemap")
 		allowUntypedManifest, _ := cmd.Flags().GetBool("allow-untyped-manifest")
 		disableTypeCheck, _ := cmd.Flags().GetBool("disable-type-check")
+		profile, _ := cmd.Flags().GetBool("profile")
+		profilePprof, _ := cmd.Flags().GetString("profile-pprof")
+		profileFolded, _ := cmd.Flags().GetString("profile-folded")
+		coverageFile, _ := cmd.Flags().GetString("coverage")
+		check, _ := cmd.Flags().GetString("check")
+		strict, _ := cmd.Flags().GetBool("strict")
+		outputDir, _ := cmd.Flags().GetString("output-dir")
+		outputTemplate, _ := cmd.Flags().GetString("output-template")
+		watch, _ := cmd.Flags().GetBool("watch")
+
+		// profiles and coverage describe one build, and watching never ends one
+		if watch && (profile || profilePprof != "" || profileFolded != "" || coverageFile != "") {
+			fmt.Fprintln(os.Stderr, "Error: --watch cannot be combined with --profile, --profile-pprof, --profile-folded or --coverage")
+			exitCode = 1
+			return
+		}
+
+		tracer, closeTrace, err := newTracer(cmd)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		defer closeTrace()
+
+		var profiler *engine.Profiler
+		if profile || profilePprof != "" || profileFolded != "" {
+			profiler = engine.NewProfiler()
+			defer writeProfile(profiler, profile, profilePprof, profileFolded)
+		}
+
+		var coverage *engine.Coverage
+		if coverageFile != "" {
+			coverage = engine.NewCoverage()
+			defer writeCoverage(coverage, coverageFile)
+		}
+
+		values, err := loadValues(cmd)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
 
-		e := engine.NewEngine(engine.Options{
-			ShowTrace:            showTrace,
+		opts := engine.Options{
+			Tracer:               tracer,
 			RenderSpecialObjects: renderSpecialObjects,
 			RenderSources:        renderSourceMap,
 			AllowUntypedManifest: allowUntypedManifest,
 			DisableTypeCheck:     disableTypeCheck,
-		})
-
-		allowCmd, err := cmd.Flags().GetBool("allow-cmd")
-		if err == nil {
-			e.SetOption("net.gammalab.yisp.exec.allow_cmd", allowCmd)
+			Profiler:             profiler,
+			Coverage:             coverage,
+			Globals:              map[string]*core.YispNode{"values": values},
+			SchemaRegistry:       schemaRegistry(),
 		}
-
-		allowedGoPkgs := viper.GetStringSlice("AllowedGoPkgs")
-		if err == nil {
-			e.SetOption("net.gammalab.yisp.exec.allowed_go_pkgs", allowedGoPkgs)
+		setOptions := func(e interface{ SetOption(key string, value any) }) {
+			allowCmd, err := cmd.Flags().GetBool("allow-cmd")
+			if err == nil {
+				e.SetOption("net.gammalab.yisp.exec.allow_cmd", allowCmd)
+			}
+			e.SetOption("net.gammalab.yisp.exec.allowed_go_pkgs", viper.GetStringSlice("AllowedGoPkgs"))
+			e.SetOption("net.gammalab.yisp.env.allowed_vars", viper.GetStringSlice("AllowedEnvVars"))
 		}
 
 		output, err := cmd.Flags().GetString("output")
 		if err != nil {
 			output = "yaml"
 		}
+		if outputDir != "" && output != "yaml" {
+			fmt.Fprintln(os.Stderr, "Error: --output-dir writes yaml files and cannot be combined with --output")
+			exitCode = 1
+			return
+		}
 
 		yamlFile := args[0]
 		if yamlFile == "" {
@@ -61,59 +118,258 @@ var buildCmd = &cobra.Command{
 			}
 		}
 
-		switch output {
-		case "yaml":
-			result, err := e.EvaluateFileToYaml(yamlFile)
+		// cache is nil if caching is disabled for this build
+		cache, cacheKey := openBuildCache(cmd, yamlFile, values, opts.SchemaRegistry)
+		deps := engine.NewDependencies()
+		if cache != nil {
+			opts.Dependencies = deps
+		}
+		cached := func(format string, render func() (string, error)) (string, error) {
+			if cache == nil {
+				return render()
+			}
+			key := cacheKey + "/" + format
+			if result, ok := cache.Get(yamlFile, key); ok {
+				return result, nil
+			}
+			started := time.Now()
+			result, err := render()
 			if err != nil {
-				fmt.Println("Error:", err)
+				return "", err
+			}
+			err = cache.Put(yamlFile, key, deps, result, started)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Warning: failed to write build cache:", err)
+			}
+			return result, nil
+		}
+
+		e := engine.NewEngine(opts)
+		setOptions(e)
+		evaluateYaml := func() (string, error) {
+			return e.EvaluateFileToYaml(yamlFile)
+		}
+
+		if watch {
+			if check != "" || output != "yaml" {
+				fmt.Fprintln(os.Stderr, "Error: --watch renders yaml and cannot be combined with --check or --output")
+				exitCode = 1
+				return
+			}
+			if yamlFile == "-" || strings.HasPrefix(yamlFile, "http://") || strings.HasPrefix(yamlFile, "https://") {
+				fmt.Fprintln(os.Stderr, "Error: --watch requires a local entry file")
+				exitCode = 1
 				return
 			}
+			exitCode = watchBuild(yamlFile, outputDir, outputTemplate, func(deps *engine.Dependencies) (string, error) {
+				for _, file := range valuesFiles(cmd) {
+					deps.AddFile(file)
+				}
+				values, err := loadValues(cmd)
+				if err != nil {
+					return "", err
+				}
 
-			fmt.Println(result)
-		case "json":
-			resultAny, err := e.EvaluateFileToAny(yamlFile)
+				watchOpts := opts
+				watchOpts.Globals = map[string]*core.YispNode{"values": values}
+				watchOpts.Dependencies = deps
+				e := engine.NewEngine(watchOpts)
+				setOptions(e)
+				return e.EvaluateFileToYaml(yamlFile)
+			})
+			return
+		}
+
+		if check != "" {
+			result, err := cached("yaml", evaluateYaml)
 			if err != nil {
-				fmt.Println("Error:", err)
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				exitCode = 2
 				return
 			}
+			exitCode = checkDrift(result, yamlFile, check, strict)
+			return
+		}
 
-			resultArr, ok := resultAny.([]any)
-			if !ok {
-				fmt.Println("Error: Result is not an array")
+		if outputDir != "" {
+			result, err := cached("yaml", evaluateYaml)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				exitCode = 1
+				return
+			}
+			written, err := writeOutputDir(result, outputDir, outputTemplate)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				exitCode = 1
 				return
 			}
+			fmt.Fprintf(os.Stderr, "%s: %d files written, %d stale files pruned\n", outputDir, len(written.Written), len(written.Pruned))
+			return
+		}
 
-			if len(resultArr) == 0 {
-				fmt.Println("Error: Result is empty")
+		switch output {
+		case "yaml":
+			result, err := cached("yaml", evaluateYaml)
+			if err != nil {
+				fmt.Println("Error:", err)
 				return
 			}
 
-			if len(resultArr) > 1 {
-				fmt.Printf("Error: Json output only supports a single document, but got %v objects\n", len(resultArr))
+			fmt.Println(result)
+		default:
+			renderer, ok := engine.GetRenderer(output)
+			if !ok {
+				fmt.Printf("Error: Unsupported output format. Use one of yaml, %s.\n", strings.Join(engine.RendererNames(), ", "))
 				return
 			}
 
-			jsonResult, err := json.MarshalIndent(resultArr[0], "", "  ")
+			result, err := cached(output, func() (string, error) {
+				var b strings.Builder
+				err := e.EvaluateFileWithRenderer(&b, yamlFile, renderer)
+				return b.String(), err
+			})
 			if err != nil {
 				fmt.Println("Error:", err)
 				return
 			}
 
-			fmt.Println(string(jsonResult))
-		default:
-			fmt.Println("Error: Unsupported output format. Use 'yaml' or 'json'.")
-			return
+			fmt.Print(result)
 		}
 	},
 }
 
+// checkDrift compares the output rendered from path with the committed output in expected, a file or directory.
+// It prints the differences and returns the exit code.
+func checkDrift(rendered, path, expected string, strict bool) int {
+	actual, actualComments, err := diff.DecodeDocumentsWithComments(strings.NewReader(rendered))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 2
+	}
+
+	committed, committedComments, err := readDocuments(expected)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 2
+	}
+
+	var changes []diff.DocumentChange
+	if strict {
+		changes = diff.DocumentsWithComments(committed, actual, committedComments, actualComments)
+	} else {
+		changes = diff.Documents(committed, actual)
+	}
+	if len(changes) == 0 {
+		return 0
+	}
+
+	fmt.Printf("%s is out of date (%d changed documents)\n", expected, len(changes))
+	fmt.Printf("--- %s\n+++ rendered %s\n", expected, path)
+	printDocumentChanges(os.Stdout, changes)
+	return 1
+}
+
+// newTracer builds the tracer requested by the trace flags, or nil if tracing is off
+func newTracer(cmd *cobra.Command) (*engine.Tracer, func(), error) {
+	showTrace, _ := cmd.Flags().GetBool("show-trace")
+	traceFile, _ := cmd.Flags().GetString("trace-file")
+	traceFiles, _ := cmd.Flags().GetStringSlice("trace-filter-file")
+	traceOperators, _ := cmd.Flags().GetStringSlice("trace-filter-op")
+	traceMaxDepth, _ := cmd.Flags().GetInt("trace-max-depth")
+
+	if !showTrace && traceFile == "" {
+		return nil, func() {}, nil
+	}
+
+	filter := engine.TraceFilter{
+		Files:     traceFiles,
+		Operators: traceOperators,
+		MaxDepth:  traceMaxDepth,
+	}
+
+	if traceFile == "" {
+		return engine.NewTracer(os.Stderr, filter), func() {}, nil
+	}
+
+	file, err := os.Create(traceFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create trace file: %v", err)
+	}
+	return engine.NewTracer(file, filter), func() { file.Close() }, nil
+}
+
+func writeProfile(profiler *engine.Profiler, report bool, pprofPath, foldedPath string) {
+	if report {
+		err := profiler.WriteReport(os.Stderr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error writing profile report:", err)
+		}
+	}
+
+	if pprofPath != "" {
+		file, err := os.Create(pprofPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error creating pprof file:", err)
+		} else {
+			defer file.Close()
+			err = profiler.WritePprof(file)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error writing pprof file:", err)
+			}
+		}
+	}
+
+	if foldedPath != "" {
+		file, err := os.Create(foldedPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error creating folded stack file:", err)
+		} else {
+			defer file.Close()
+			err = profiler.WriteFolded(file)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error writing folded stack file:", err)
+			}
+		}
+	}
+}
+
+func writeCoverage(coverage *engine.Coverage, path string) {
+	file, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error creating coverage file:", err)
+		return
+	}
+	defer file.Close()
+
+	err = coverage.WriteLcov(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error writing coverage file:", err)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(buildCmd)
 	buildCmd.Flags().BoolP("allow-cmd", "", false, "Allow command execution")
-	buildCmd.Flags().BoolP("show-trace", "", false, "Show trace")
+	buildCmd.Flags().BoolP("show-trace", "", false, "Write an evaluation trace as JSON lines to stderr")
+	buildCmd.Flags().StringP("trace-file", "", "", "Write the evaluation trace to a file instead of stderr")
+	buildCmd.Flags().StringSliceP("trace-filter-file", "", nil, "Only trace nodes from files matching the glob (repeatable)")
+	buildCmd.Flags().StringSliceP("trace-filter-op", "", nil, "Only trace calls of the operator or lambda and what they evaluate (repeatable)")
+	buildCmd.Flags().IntP("trace-max-depth", "", 0, "Do not trace frames nested deeper than this")
 	buildCmd.Flags().BoolP("render-special-objects", "", false, "Show special objects (e.g. type, lambda, etc.)")
 	buildCmd.Flags().BoolP("enable-sourcemap", "", false, "Enable source map comments in output YAML")
 	buildCmd.Flags().BoolP("allow-untyped-manifest", "", false, "Allow untyped manifest")
-	buildCmd.Flags().StringP("output", "o", "yaml", "Output format (yaml, json)")
+	buildCmd.Flags().StringP("output", "o", "yaml", "Output format (yaml, json, json-array, ndjson, list, toml, properties, dotenv)")
 	buildCmd.Flags().BoolP("disable-type-check", "", false, "Disable type checking while output")
+	buildCmd.Flags().BoolP("profile", "", false, "Print an evaluation profile to stderr")
+	buildCmd.Flags().StringP("profile-pprof", "", "", "Write the evaluation profile to a pprof file")
+	buildCmd.Flags().StringP("profile-folded", "", "", "Write the evaluation profile as folded stacks for flamegraphs")
+	buildCmd.Flags().StringP("check", "", "", "Compare the output with this committed file or directory instead of printing it, and exit with status 1 if they differ")
+	buildCmd.Flags().BoolP("strict", "", false, "With --check, also report changed comments")
+	buildCmd.Flags().StringP("output-dir", "", "", "Write each document to its own file below this directory, with a kustomization.yaml listing them")
+	buildCmd.Flags().StringP("output-template", "", defaultOutputTemplate, "File name template for --output-dir (<apiVersion>, <group>, <version>, <kind>, <namespace>, <name>, <index>)")
+	buildCmd.Flags().BoolP("no-cache", "", false, "Always evaluate instead of reusing the output of an earlier build whose inputs did not change")
+	buildCmd.Flags().Bool("watch", false, "Rebuild whenever a file read by the build changes, printing the rendered YAML and a summary of the changed documents")
+	addValuesFlags(buildCmd)
+	buildCmd.Flags().StringP("coverage", "", "", "Write an lcov coverage report of the evaluated yisp sources to this file")
 }
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/totegamma/yisp/core"
+)
+
+var bundleKubeSchemas = &cobra.Command{
+	Use:   "bundle-kube-schemas <files/dirs>...",
+	Short: "Bundle Kubernetes Schemas of a version",
+	Long: `This command builds a compressed schema bundle from OpenAPI v2 or v3 documents of a Kubernetes release,
+such as api/openapi-spec/swagger.json of the Kubernetes repository.
+
+The bundle is saved in the bundles directory of the cache for the version given by --kube-version,
+and builds run with the same --kube-version use it without cluster access.
+With --output it is written elsewhere, e.g. to core/bundles to compile it into yisp.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		if output == "" {
+			version := kubeVersion()
+			if version == "" {
+				fmt.Fprintln(os.Stderr, "Error: --kube-version or --output is required")
+				os.Exit(1)
+			}
+			minor, err := core.KubeMinorVersion(version)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
+			}
+			output = filepath.Join(kubeBundleDir(), core.SchemaBundleName(minor))
+		}
+
+		definitions, err := readOpenAPIFiles(args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+
+		err = writeSchemaBundle(output, definitions)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing bundle: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Bundled %d schemas to %s.\n", len(definitions), output)
+	},
+}
+
+func writeSchemaBundle(output string, definitions map[string]map[string]any) error {
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	err = core.WriteSchemaBundle(file, definitions)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func init() {
+	rootCmd.AddCommand(bundleKubeSchemas)
+	bundleKubeSchemas.Flags().StringP("output", "o", "", "Write the bundle to this file instead of the cache")
+}
@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/totegamma/yisp/core"
+	"github.com/totegamma/yisp/engine"
+)
+
+// buildCacheKeyIgnoredFlags do not change the rendered output, so they are not part of the build cache key.
+// Values flags are covered by the values themselves.
+var buildCacheKeyIgnoredFlags = map[string]bool{
+	"check":           true,
+	"strict":          true,
+	"output":          true,
+	"output-dir":      true,
+	"output-template": true,
+	"no-cache":        true,
+	"watch":           true,
+	"values":          true,
+	"set":             true,
+	"set-string":      true,
+	"set-file":        true,
+}
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the yisp cache",
+}
+
+var cacheCleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Remove the build cache",
+	Long:  `Remove the outputs cached by yisp build. Cached schemas are kept unless --all is given.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		all, _ := cmd.Flags().GetBool("all")
+
+		dir, err := cacheDir()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		if !all {
+			dir = filepath.Join(dir, "builds")
+		}
+
+		err = engine.NewBuildCache(dir, nil).Clean()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Removed", dir)
+	},
+}
+
+// cacheDir returns the directory given by --cache-dir or the CacheDir config, or ~/.cache/yisp
+func cacheDir() (string, error) {
+	dir, _ := rootCmd.PersistentFlags().GetString("cache-dir")
+	if dir == "" {
+		dir = viper.GetString("CacheDir")
+	}
+	if dir != "" {
+		return dir, nil
+	}
+	return core.DefaultCacheDir()
+}
+
+// schemaRegistry returns the registry looking up schemas in the directory given by --schema-dir or the SchemaDir
+// config, then in the cache or the Kubernetes profile selected by --kube-profile, and finally over HTTP
+func schemaRegistry() core.SchemaRegistry {
+	return core.NewDefaultSchemaRegistry(schemaSources())
+}
+
+// schemaSources returns where schemas are looked up, from the flags and the config
+func schemaSources() core.SchemaSources {
+	schemaDir, _ := rootCmd.PersistentFlags().GetString("schema-dir")
+	if schemaDir == "" {
+		schemaDir = viper.GetString("SchemaDir")
+	}
+
+	profile := kubeProfile()
+	dir, err := kubeSchemaDir(profile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: schema cache disabled:", err)
+	} else if _, err := os.Stat(dir); profile != "" && err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Kubernetes profile %s is not cached. Run `yisp cache-kube-schemas --profile %s` first.\n", profile, profile)
+	}
+
+	var bundle fs.FS
+	if version := kubeVersion(); version != "" {
+		bundle, err = core.OpenSchemaBundle(kubeBundleDir(), version)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Warning: Kubernetes schema bundle disabled:", err)
+		}
+	}
+
+	return core.SchemaSources{
+		ProjectDir: schemaDir,
+		Bundle:     bundle,
+		CacheDir:   dir,
+	}
+}
+
+// openBuildCache returns the build cache and the key of the build, or nil if the build should not be cached:
+// with --no-cache, for entry files that are not local and when tracing, profiling or collecting coverage,
+// since those need the evaluation to run. Schemas are checked for changes in schemas.
+func openBuildCache(cmd *cobra.Command, path string, values *core.YispNode, schemas core.SchemaRegistry) (*engine.BuildCache, string) {
+	noCache, _ := cmd.Flags().GetBool("no-cache")
+	if noCache || path == "-" || strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return nil, ""
+	}
+	for _, name := range []string{"show-trace", "trace-file", "profile", "profile-pprof", "profile-folded", "coverage"} {
+		if cmd.Flags().Changed(name) {
+			return nil, ""
+		}
+	}
+
+	dir, err := cacheDir()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: build cache disabled:", err)
+		return nil, ""
+	}
+
+	key, err := buildCacheKey(cmd, values)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: build cache disabled:", err)
+		return nil, ""
+	}
+
+	return engine.NewBuildCache(filepath.Join(dir, "builds"), schemas), key
+}
+
+// buildCacheKey hashes everything besides the files read that changes the output: the yisp version and binary,
+// the flags, the values and the allowlists of the config file
+func buildCacheKey(cmd *cobra.Command, values *core.YispNode) (string, error) {
+	nativeValues, err := values.ToNative()
+	if err != nil {
+		return "", err
+	}
+
+	flags := make(map[string]string)
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if !buildCacheKeyIgnoredFlags[flag.Name] {
+			flags[flag.Name] = flag.Value.String()
+		}
+	})
+
+	data, err := json.Marshal(struct {
+		Version        string            `json:"version"`
+		Flags          map[string]string `json:"flags"`
+		Values         any               `json:"values"`
+		AllowedGoPkgs  []string          `json:"allowedGoPkgs"`
+		AllowedEnvVars []string          `json:"allowedEnvVars"`
+	}{
+		Version:        toolVersion(),
+		Flags:          flags,
+		Values:         nativeValues,
+		AllowedGoPkgs:  viper.GetStringSlice("AllowedGoPkgs"),
+		AllowedEnvVars: viper.GetStringSlice("AllowedEnvVars"),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// toolVersion identifies the running yisp binary. Development builds share a version,
+// so the size and modification time of the executable are included too.
+func toolVersion() string {
+	version := "unknown"
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		version = buildInfo.Main.Version
+		for _, setting := range buildInfo.Settings {
+			if strings.HasPrefix(setting.Key, "vcs.") {
+				version += " " + setting.Key + "=" + setting.Value
+			}
+		}
+	}
+
+	executable, err := os.Executable()
+	if err == nil {
+		stat, err := os.Stat(executable)
+		if err == nil {
+			version += fmt.Sprintf(" %d %d", stat.Size(), stat.ModTime().UnixNano())
+		}
+	}
+	return version
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheCleanCmd)
+	cacheCleanCmd.Flags().BoolP("all", "", false, "Remove the whole cache directory, including cached schemas")
+}
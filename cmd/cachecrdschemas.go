@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/spf13/cobra"
+	"github.com/totegamma/yisp/core"
+	"github.com/totegamma/yisp/diff"
+)
+
+var cacheCRDSchemas = &cobra.Command{
+	Use:   "cache-crd-schemas <files/dirs>...",
+	Short: "Cache schemas of CustomResourceDefinitions",
+	Long: `This command reads CustomResourceDefinition manifests and saves the schema of each served version
+next to the Kubernetes schemas, so custom resources are validated like built-in kinds.
+
+Directories are searched for .yaml, .yml and .json files, and documents that are not
+CustomResourceDefinitions are skipped. With --profile the schemas are added to a named profile.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		profile, _ := cmd.Flags().GetString("profile")
+
+		dir, err := kubeSchemaDir(profile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+
+		definitions, err := readCRDFiles(args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+
+		err = saveSchemas(definitions, dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving schemas: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Schemas saved successfully to %s.\n", dir)
+	},
+}
+
+// readCRDFiles reads the schemas of the CustomResourceDefinitions in files and directories,
+// as definitions in the form saveSchemas takes
+func readCRDFiles(paths []string) (map[string]map[string]any, error) {
+	definitions := make(map[string]map[string]any)
+	read := func(path string) error {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		documents, err := diff.DecodeDocuments(file)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+		for _, document := range documents {
+			manifest, ok := document.(map[string]any)
+			if !ok || !core.IsCRD(manifest) {
+				continue
+			}
+			schemas, err := core.CRDSchemas(manifest)
+			if err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+			for _, schema := range schemas {
+				def, err := crdDefinition(schema)
+				if err != nil {
+					return fmt.Errorf("%s: %v", path, err)
+				}
+				definitions[schema.ID] = def
+			}
+		}
+		return nil
+	}
+
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !stat.IsDir() {
+			if err := read(path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !slices.Contains([]string{".yaml", ".yml", ".json"}, filepath.Ext(file)) {
+				return nil
+			}
+			return read(file)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(definitions) == 0 {
+		return nil, fmt.Errorf("no CustomResourceDefinitions found in %v", paths)
+	}
+	return definitions, nil
+}
+
+// crdDefinition converts the schema of a CustomResourceDefinition into a definition carrying its GVK,
+// like the ones of the Kubernetes OpenAPI spec
+func crdDefinition(schema core.CRDSchema) (map[string]any, error) {
+	data, err := json.Marshal(schema.Schema)
+	if err != nil {
+		return nil, err
+	}
+	var def map[string]any
+	err = json.Unmarshal(data, &def)
+	if err != nil {
+		return nil, err
+	}
+	def["x-kubernetes-group-version-kind"] = []any{
+		map[string]any{"group": schema.Group, "version": schema.Version, "kind": schema.Kind},
+	}
+	return def, nil
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCRDSchemas)
+	cacheCRDSchemas.Flags().StringP("profile", "p", "", "Add the schemas to a named profile, used by builds with --kube-profile")
+}
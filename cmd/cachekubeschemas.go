@@ -4,53 +4,204 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"github.com/spf13/cobra"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
-type open struct {
+// openAPIDocument holds the schemas of an OpenAPI v2 document (definitions) or v3 document (components.schemas)
+type openAPIDocument struct {
 	Definitions map[string]map[string]any `json:"definitions"`
+	Components  struct {
+		Schemas map[string]map[string]any `json:"schemas"`
+	} `json:"components"`
 }
 
+// profilePattern restricts profile names to what can safely be used as a directory name
+var profilePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
 var cacheKubeSchemas = &cobra.Command{
 	Use:   "cache-kube-schemas",
 	Short: "Cache Kubernetes Schemas",
-	Long:  `This command fetches the Kubernetes OpenAPI schema and saves it locally.`,
+	Long: `This command fetches the Kubernetes OpenAPI schema and saves it locally.
+
+By default the schema is fetched from the current cluster with kubectl get --raw /openapi/v2.
+With --from-file it is read from OpenAPI v2 or v3 documents instead, or from a directory of
+documents such as the group files served under /openapi/v3, so no cluster access is needed.
+
+With --profile the schemas are saved as a named profile next to the default ones,
+and builds use them with --kube-profile.`,
+	Args: cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		response, err := cacheKube()
+		files, _ := cmd.Flags().GetStringSlice("from-file")
+		nonInteractive, _ := cmd.Flags().GetBool("non-interactive")
+		profile, _ := cmd.Flags().GetString("profile")
+
+		dir, err := kubeSchemaDir(profile)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error fetching Kubernetes : %v\n", err)
+			fmt.Fprintln(os.Stderr, "Error:", err)
 			os.Exit(1)
 		}
 
-		var openapi open
-		err = json.Unmarshal([]byte(response), &openapi)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error unmarshalling response: %v\n", err)
-			os.Exit(1)
+		var definitions map[string]map[string]any
+		if len(files) > 0 {
+			definitions, err = readOpenAPIFiles(files)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
+			}
+		} else {
+			response, err := cacheKube(nonInteractive)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error fetching Kubernetes : %v\n", err)
+				os.Exit(1)
+			}
+
+			var openapi openAPIDocument
+			err = json.Unmarshal([]byte(response), &openapi)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error unmarshalling response: %v\n", err)
+				os.Exit(1)
+			}
+			definitions = openapi.schemas()
+			fmt.Println("Successfully fetched Kubernetes . Saving schemas...")
 		}
 
-		fmt.Println("Successfully fetched Kubernetes . Saving schemas...")
-		err = saveSchemas(openapi)
+		err = saveSchemas(definitions, dir)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error saving schemas: %v\n", err)
 			os.Exit(1)
 		}
-		fmt.Println("Schemas saved successfully.")
+		fmt.Printf("Schemas saved successfully to %s.\n", dir)
 	},
 }
 
-func cacheKube() (string, error) {
+// schemas returns the schemas of the document by name, whichever OpenAPI version it is
+func (d openAPIDocument) schemas() map[string]map[string]any {
+	schemas := make(map[string]map[string]any, len(d.Definitions)+len(d.Components.Schemas))
+	for key, def := range d.Definitions {
+		schemas[key] = def
+	}
+	for key, def := range d.Components.Schemas {
+		schemas[key] = def
+	}
+	return schemas
+}
+
+// kubeSchemaDir returns the directory the schemas of a profile are stored in: the cache directory itself
+// for the default profile, and profiles/<name> in it for named ones
+func kubeSchemaDir(profile string) (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	if profile == "" {
+		return dir, nil
+	}
+	if !profilePattern.MatchString(profile) {
+		return "", fmt.Errorf("invalid profile name %q: use letters, digits, '.', '_' and '-'", profile)
+	}
+	return filepath.Join(dir, "profiles", profile), nil
+}
+
+// kubeProfile returns the profile given by --kube-profile or the KubeProfile config
+func kubeProfile() string {
+	profile, _ := rootCmd.PersistentFlags().GetString("kube-profile")
+	if profile == "" {
+		profile = viper.GetString("KubeProfile")
+	}
+	return profile
+}
+
+// kubeVersion returns the Kubernetes version given by --kube-version or the KubeVersion config
+func kubeVersion() string {
+	version, _ := rootCmd.PersistentFlags().GetString("kube-version")
+	if version == "" {
+		version = viper.GetString("KubeVersion")
+	}
+	return version
+}
+
+// kubeBundleDir returns the directory schema bundles are looked up in before those compiled into the binary
+func kubeBundleDir() string {
+	dir, err := cacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "bundles")
+}
+
+// readOpenAPIFiles reads the schemas of OpenAPI documents. Directories are searched for .json documents,
+// and documents without schemas in them, like the index of /openapi/v3, are skipped.
+func readOpenAPIFiles(paths []string) (map[string]map[string]any, error) {
+	definitions := make(map[string]map[string]any)
+	read := func(path string, required bool) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var openapi openAPIDocument
+		err = json.Unmarshal(data, &openapi)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+		schemas := openapi.schemas()
+		if len(schemas) == 0 && required {
+			return fmt.Errorf("%s contains no definitions or components.schemas", path)
+		}
+		for key, def := range schemas {
+			definitions[key] = def
+		}
+		return nil
+	}
+
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !stat.IsDir() {
+			if err := read(path, true); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || filepath.Ext(file) != ".json" {
+				return nil
+			}
+			return read(file, false)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(definitions) == 0 {
+		return nil, fmt.Errorf("no schemas found in %v", paths)
+	}
+	return definitions, nil
+}
+
+func cacheKube(nonInteractive bool) (string, error) {
 
 	cmd := exec.Command("kubectl", "get", "--raw", "/openapi/v2")
 
 	fmt.Fprintf(os.Stderr, "Going to run command: %v\n", cmd.Args)
-	fmt.Fprintf(os.Stderr, "Press Enter to continue or Ctrl+C to cancel...\n")
-	_, err := os.Stdin.Read(make([]byte, 1))
-	if err != nil {
-		return "", fmt.Errorf("error reading input: %v", err)
+	if !nonInteractive {
+		fmt.Fprintf(os.Stderr, "Press Enter to continue or Ctrl+C to cancel...\n")
+		_, err := os.Stdin.Read(make([]byte, 1))
+		if err != nil {
+			return "", fmt.Errorf("error reading input: %v", err)
+		}
 	}
 
 	stdout := new(bytes.Buffer)
@@ -58,7 +209,7 @@ func cacheKube() (string, error) {
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
 
-	err = cmd.Run()
+	err := cmd.Run()
 	errorOutput := stderr.String()
 	if err != nil {
 		return "", fmt.Errorf("error running command: %v, stderr: %s", err, errorOutput)
@@ -71,50 +222,34 @@ func cacheKube() (string, error) {
 	return response, nil
 }
 
-func saveSchemas(openapi open) error {
-
-	cacheDir, _ := rootCmd.PersistentFlags().GetString("cache-dir")
-	if cacheDir == "" {
-
-		home, err := os.UserHomeDir()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error getting home directory: %v\n", err)
-			os.Exit(1)
-		}
+// saveSchemas writes each definition to schemas/<name>.json in dir, and for definitions of Kubernetes kinds
+// the name to gvk/<group>_<version>_<kind>.txt
+func saveSchemas(definitions map[string]map[string]any, dir string) error {
 
-		cacheDir = filepath.Join(home, ".cache", "yisp")
-	}
-
-	schemasPath := filepath.Join(cacheDir, "schemas")
+	schemasPath := filepath.Join(dir, "schemas")
 	if err := os.MkdirAll(schemasPath, 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating schemas directory: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error creating schemas directory: %v", err)
 	}
 
-	gvkPath := filepath.Join(cacheDir, "gvk")
+	gvkPath := filepath.Join(dir, "gvk")
 	if err := os.MkdirAll(gvkPath, 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating GVK directory: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error creating GVK directory: %v", err)
 	}
 
-	for key, def := range openapi.Definitions {
+	for key, def := range definitions {
 
 		def["$id"] = key
 
 		schemaPath := filepath.Join(schemasPath, fmt.Sprintf("%s.json", key))
 
-		file, err := os.Create(schemaPath)
+		data, err := json.MarshalIndent(def, "", "  ")
 		if err != nil {
-			fmt.Println("Error creating file:", err)
+			fmt.Println("Error encoding JSON:", err)
 			continue
 		}
-		defer file.Close()
-
-		encoder := json.NewEncoder(file)
-		encoder.SetIndent("", "  ")
-		err = encoder.Encode(def)
+		err = os.WriteFile(schemaPath, append(data, '\n'), 0644)
 		if err != nil {
-			fmt.Println("Error encoding JSON to file:", err)
+			fmt.Println("Error creating file:", err)
 			continue
 		}
 		fmt.Printf("Created file: %s\n", schemaPath)
@@ -156,14 +291,8 @@ func saveSchemas(openapi open) error {
 
 			gvkPath := filepath.Join(gvkPath, fmt.Sprintf("%s_%s_%s.txt", group, version, kind))
 
-			file, err = os.Create(gvkPath)
-			if err != nil {
-				fmt.Println("Error creating file:", err)
-				continue
-			}
-
 			//write key
-			_, err = file.WriteString(key)
+			err = os.WriteFile(gvkPath, []byte(key), 0644)
 			if err != nil {
 				fmt.Println("Error writing to file:", err)
 				continue
@@ -178,4 +307,7 @@ func saveSchemas(openapi open) error {
 
 func init() {
 	rootCmd.AddCommand(cacheKubeSchemas)
+	cacheKubeSchemas.Flags().StringSliceP("from-file", "f", []string{}, "Read OpenAPI v2 or v3 documents, or directories of them, instead of fetching from the cluster")
+	cacheKubeSchemas.Flags().BoolP("non-interactive", "y", false, "Fetch from the cluster without asking for confirmation")
+	cacheKubeSchemas.Flags().StringP("profile", "p", "", "Save the schemas as a named profile, used by builds with --kube-profile")
 }
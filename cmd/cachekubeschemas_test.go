@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const openAPIv2 = `{
+  "swagger": "2.0",
+  "definitions": {
+    "io.k8s.api.core.v1.ConfigMap": {
+      "type": "object",
+      "properties": {"data": {"type": "object", "additionalProperties": {"type": "string"}}},
+      "x-kubernetes-group-version-kind": [{"group": "", "version": "v1", "kind": "ConfigMap"}]
+    }
+  }
+}`
+
+const openAPIv3Apps = `{
+  "openapi": "3.0.0",
+  "components": {
+    "schemas": {
+      "io.k8s.api.apps.v1.Deployment": {
+        "type": "object",
+        "properties": {"spec": {"allOf": [{"$ref": "#/components/schemas/io.k8s.api.apps.v1.DeploymentSpec"}]}},
+        "x-kubernetes-group-version-kind": [{"group": "apps", "version": "v1", "kind": "Deployment"}]
+      },
+      "io.k8s.api.apps.v1.DeploymentSpec": {
+        "type": "object",
+        "properties": {"replicas": {"type": "integer"}}
+      }
+    }
+  }
+}`
+
+const openAPIv3Batch = `{
+  "openapi": "3.0.0",
+  "components": {
+    "schemas": {
+      "io.k8s.api.batch.v1.Job": {
+        "type": "object",
+        "x-kubernetes-group-version-kind": [{"group": "batch", "version": "v1", "kind": "Job"}]
+      }
+    }
+  }
+}`
+
+// openAPIv3Index is the index served at /openapi/v3, which lists the group documents but has no schemas
+const openAPIv3Index = `{"paths": {"apis/apps/v1": {"serverRelativeURL": "/openapi/v3/apis/apps/v1"}}}`
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err == nil {
+		err = os.WriteFile(path, []byte(content), 0644)
+	}
+	if err != nil {
+		t.Fatalf("Error writing %s: %v", path, err)
+	}
+}
+
+func TestReadOpenAPIFiles(t *testing.T) {
+
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "swagger.json"), openAPIv2)
+	writeTestFile(t, filepath.Join(dir, "apps.json"), openAPIv3Apps)
+	writeTestFile(t, filepath.Join(dir, "v3", "openapi.json"), openAPIv3Index)
+	writeTestFile(t, filepath.Join(dir, "v3", "apis", "apps", "v1.json"), openAPIv3Apps)
+	writeTestFile(t, filepath.Join(dir, "v3", "apis", "batch", "v1.json"), openAPIv3Batch)
+	writeTestFile(t, filepath.Join(dir, "v3", "README.md"), "not a document")
+	writeTestFile(t, filepath.Join(dir, "empty", "openapi.json"), openAPIv3Index)
+
+	keys := func(definitions map[string]map[string]any) []string {
+		names := make([]string, 0, len(definitions))
+		for name := range definitions {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	tests := []struct {
+		name     string
+		paths    []string
+		expected []string
+		err      string
+	}{
+		{
+			name:     "v2 document",
+			paths:    []string{"swagger.json"},
+			expected: []string{"io.k8s.api.core.v1.ConfigMap"},
+		},
+		{
+			name:     "v3 group document",
+			paths:    []string{"apps.json"},
+			expected: []string{"io.k8s.api.apps.v1.Deployment", "io.k8s.api.apps.v1.DeploymentSpec"},
+		},
+		{
+			name:     "v3 directory with an index",
+			paths:    []string{"v3"},
+			expected: []string{"io.k8s.api.apps.v1.Deployment", "io.k8s.api.apps.v1.DeploymentSpec", "io.k8s.api.batch.v1.Job"},
+		},
+		{
+			name:     "several documents",
+			paths:    []string{"swagger.json", "v3/apis/batch"},
+			expected: []string{"io.k8s.api.batch.v1.Job", "io.k8s.api.core.v1.ConfigMap"},
+		},
+		{
+			name:  "document without schemas",
+			paths: []string{"v3/openapi.json"},
+			err:   "contains no definitions or components.schemas",
+		},
+		{
+			name:  "directory without schemas",
+			paths: []string{"empty"},
+			err:   "no schemas found",
+		},
+		{
+			name:  "not a document",
+			paths: []string{"v3/README.md"},
+			err:   "failed to parse",
+		},
+		{
+			name:  "missing file",
+			paths: []string{"missing.json"},
+			err:   "no such file or directory",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			paths := make([]string, len(test.paths))
+			for i, path := range test.paths {
+				paths[i] = filepath.Join(dir, path)
+			}
+
+			definitions, err := readOpenAPIFiles(paths)
+			if test.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), test.err)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, keys(definitions))
+		})
+	}
+}
+
+// setPersistentFlag sets a flag of the root command for the duration of a test
+func setPersistentFlag(t *testing.T, name, value string) {
+	t.Helper()
+	err := rootCmd.PersistentFlags().Set(name, value)
+	if err != nil {
+		t.Fatalf("Error setting --%s: %v", name, err)
+	}
+	t.Cleanup(func() {
+		rootCmd.PersistentFlags().Set(name, "")
+	})
+}
+
+func TestKubeSchemaProfiles(t *testing.T) {
+
+	cache := t.TempDir()
+	setPersistentFlag(t, "cache-dir", cache)
+
+	dir, err := kubeSchemaDir("")
+	assert.NoError(t, err)
+	assert.Equal(t, cache, dir)
+
+	dir, err = kubeSchemaDir("prod-1.29")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(cache, "profiles", "prod-1.29"), dir)
+
+	for _, profile := range []string{"../prod", "prod/1.29", ".hidden", "-flag", "prod 1.29"} {
+		_, err := kubeSchemaDir(profile)
+		assert.Error(t, err, profile)
+	}
+
+	// schemas cached into a profile are looked up only by builds using that profile
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "apps", "v1.json"), openAPIv3Apps)
+	definitions, err := readOpenAPIFiles([]string{src})
+	if err != nil {
+		t.Fatalf("Error reading documents: %v", err)
+	}
+	err = saveSchemas(definitions, dir)
+	if err != nil {
+		t.Fatalf("Error saving schemas: %v", err)
+	}
+	assert.FileExists(t, filepath.Join(dir, "schemas", "io.k8s.api.apps.v1.DeploymentSpec.json"))
+	assert.FileExists(t, filepath.Join(dir, "gvk", "apps_v1_Deployment.txt"))
+
+	setPersistentFlag(t, "kube-profile", "prod-1.29")
+	schema, err := schemaRegistry().SchemaByGVK("apps", "v1", "Deployment")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "io.k8s.api.apps.v1.Deployment", schema.ID)
+	}
+
+	setPersistentFlag(t, "kube-profile", "")
+	_, err = schemaRegistry().SchemaByGVK("apps", "v1", "Deployment")
+	assert.Error(t, err)
+}
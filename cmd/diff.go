@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/totegamma/yisp/diff"
+	"github.com/totegamma/yisp/engine"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <a> <b>",
+	Short: "Show the differences between two rendered outputs",
+	Long: `Render both sides and compare them document by document.
+Each side is a yisp entry file, a rendered YAML file, or a directory of rendered YAML files.
+Documents are paired by apiVersion, kind, namespace and name rather than by their order,
+and changed fields are reported with JSON pointer paths.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		exitCode, _ := cmd.Flags().GetBool("exit-code")
+		allowUntypedManifest, _ := cmd.Flags().GetBool("allow-untyped-manifest")
+		disableTypeCheck, _ := cmd.Flags().GetBool("disable-type-check")
+		allowCmd, _ := cmd.Flags().GetBool("allow-cmd")
+
+		opts := engine.Options{
+			AllowUntypedManifest: allowUntypedManifest,
+			DisableTypeCheck:     disableTypeCheck,
+			SchemaRegistry:       schemaRegistry(),
+		}
+
+		sides := make([][]any, 2)
+		for i, arg := range args {
+			documents, err := loadDocuments(arg, opts, allowCmd)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(2)
+			}
+			sides[i] = documents
+		}
+
+		changes := diff.Documents(sides[0], sides[1])
+
+		switch output {
+		case "text":
+			if len(changes) > 0 {
+				fmt.Printf("--- %s\n+++ %s\n", args[0], args[1])
+			}
+			printDocumentChanges(os.Stdout, changes)
+		case "json":
+			result, err := json.MarshalIndent(changes, "", "  ")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(2)
+			}
+			fmt.Println(string(result))
+		default:
+			fmt.Fprintf(os.Stderr, "Error: unsupported output format: %s\n", output)
+			os.Exit(2)
+		}
+
+		if exitCode && len(changes) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// loadDocuments renders a yisp file, or decodes a rendered YAML file or every YAML file below a directory
+func loadDocuments(path string, opts engine.Options, allowCmd bool) ([]any, error) {
+	stat, err := os.Stat(path)
+	isDir := err == nil && stat.IsDir()
+	ext := filepath.Ext(path)
+	if isDir || ext == ".yaml" || ext == ".yml" {
+		documents, _, err := readDocuments(path)
+		return documents, err
+	}
+
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		path, err = filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	e := engine.NewEngine(opts)
+	e.SetOption("net.gammalab.yisp.exec.allow_cmd", allowCmd)
+	e.SetOption("net.gammalab.yisp.exec.allowed_go_pkgs", viper.GetStringSlice("AllowedGoPkgs"))
+	e.SetOption("net.gammalab.yisp.env.allowed_vars", viper.GetStringSlice("AllowedEnvVars"))
+
+	rendered, err := e.EvaluateFileToYaml(path)
+	if err != nil {
+		return nil, err
+	}
+	return diff.DecodeDocuments(strings.NewReader(rendered))
+}
+
+// printDocumentChanges prints every changed document followed by its indented field changes
+func printDocumentChanges(w io.Writer, changes []diff.DocumentChange) {
+	for _, change := range changes {
+		fmt.Fprintln(w, change)
+		for _, fieldChange := range change.Changes {
+			fmt.Fprintf(w, "    %s\n", fieldChange)
+		}
+	}
+}
+
+// readDocuments decodes a rendered YAML file, or every YAML file below a directory in lexical order.
+// The kustomization.yaml written by --output-dir is not part of the output.
+func readDocuments(path string) ([]any, []map[string]string, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	files := []string{path}
+	if stat.IsDir() {
+		files = files[:0]
+		err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			ext := filepath.Ext(file)
+			if !d.IsDir() && (ext == ".yaml" || ext == ".yml") && d.Name() != kustomizationFile {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		slices.Sort(files)
+	}
+
+	documents := make([]any, 0)
+	comments := make([]map[string]string, 0)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		fileDocuments, fileComments, err := diff.DecodeDocumentsWithComments(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", file, err)
+		}
+		documents = append(documents, fileDocuments...)
+		comments = append(comments, fileComments...)
+	}
+	return documents, comments, nil
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().StringP("output", "o", "text", "Output format (text, json)")
+	diffCmd.Flags().Bool("exit-code", false, "Exit with status 1 if there are differences")
+	diffCmd.Flags().Bool("allow-untyped-manifest", false, "Allow untyped manifest")
+	diffCmd.Flags().Bool("disable-type-check", false, "Disable type checking while output")
+	diffCmd.Flags().Bool("allow-cmd", false, "Allow command execution")
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/totegamma/yisp/engine"
+)
+
+var fmtCmd = &cobra.Command{
+	Use:   "fmt [files or directories...]",
+	Short: "Format yisp files",
+	Long: `Rewrite yisp files in their canonical layout.
+Without flags the formatted source is printed to stdout. Directories are searched for .yisp files.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		check, _ := cmd.Flags().GetBool("check")
+		write, _ := cmd.Flags().GetBool("write")
+
+		if len(args) == 0 {
+			args = []string{"-"}
+		}
+
+		files, err := collectYispFiles(args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+
+		failed := false
+		unformatted := make([]string, 0)
+		for _, file := range files {
+			var src []byte
+			if file == "-" {
+				src, err = io.ReadAll(os.Stdin)
+			} else {
+				src, err = os.ReadFile(file)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				failed = true
+				continue
+			}
+
+			formatted, err := engine.Format(src)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s: %v\n", file, err)
+				failed = true
+				continue
+			}
+
+			changed := !bytes.Equal(src, formatted)
+
+			switch {
+			case check:
+				if changed {
+					unformatted = append(unformatted, file)
+				}
+			case write && file != "-":
+				if !changed {
+					continue
+				}
+				err = writeFileAtomic(file, formatted)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %s: %v\n", file, err)
+					failed = true
+				}
+			default:
+				os.Stdout.Write(formatted)
+			}
+		}
+
+		for _, file := range unformatted {
+			fmt.Println(file)
+		}
+
+		if failed || len(unformatted) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// collectYispFiles expands directories in args to the .yisp files they contain
+func collectYispFiles(args []string) ([]string, error) {
+	files := make([]string, 0)
+	for _, arg := range args {
+		if arg == "-" {
+			files = append(files, arg)
+			continue
+		}
+
+		stat, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		if !stat.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && filepath.Ext(path) == ".yisp" {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// writeFileAtomic replaces path with data, keeping its permissions
+func writeFileAtomic(path string, data []byte) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(tmp.Name(), stat.Mode())
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func init() {
+	rootCmd.AddCommand(fmtCmd)
+	fmtCmd.Flags().BoolP("check", "", false, "List files whose formatting differs and exit with status 1")
+	fmtCmd.Flags().BoolP("write", "w", false, "Write the result to the source files instead of stdout")
+}
@@ -58,6 +58,7 @@ var krmCmd = &cobra.Command{
 			RenderSpecialObjects: false,
 			RenderSources:        false,
 			AllowUntypedManifest: krmInput.FunctionConfig.Spec.AllowUntypedManifest,
+			SchemaRegistry:       schemaRegistry(),
 		})
 
 		env := core.NewEnv()
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/totegamma/yisp/lint"
+)
+
+var lintCmd = &cobra.Command{
+	Use:   "lint [files or directories...]",
+	Short: "Statically check yisp files",
+	Long: `Check yisp files for mistakes without evaluating them.
+Reports undefined symbols, unknown operators, lambda arity mismatches,
+unused anchors and imports, and shadowed names. Directories are searched for .yisp files.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		globals, _ := cmd.Flags().GetStringSlice("global")
+		warningsAsErrors, _ := cmd.Flags().GetBool("warnings-as-errors")
+
+		files, err := collectYispFiles(args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+
+		diagnostics, err := lint.Lint(files, lint.Options{Globals: globals})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+
+		switch format {
+		case "text":
+			for _, d := range diagnostics {
+				fmt.Println(d.String())
+			}
+		case "sarif":
+			cwd, _ := os.Getwd()
+			err = lint.WriteSARIF(os.Stdout, diagnostics, cwd)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "Error: unsupported format: %s\n", format)
+			os.Exit(1)
+		}
+
+		for _, d := range diagnostics {
+			if d.Severity == lint.SeverityError || warningsAsErrors {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+	lintCmd.Flags().StringP("format", "f", "text", "Output format (text, sarif)")
+	lintCmd.Flags().StringSlice("global", []string{}, "Names provided by the environment, e.g. items for krm functions")
+	lintCmd.Flags().Bool("warnings-as-errors", false, "Exit with status 1 on warnings too")
+}
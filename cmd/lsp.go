@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/totegamma/yisp/core"
+	"github.com/totegamma/yisp/engine"
+	"github.com/totegamma/yisp/lint"
+	"github.com/totegamma/yisp/lsp"
+)
+
+var lspCmd = &cobra.Command{
+	Use:   "lsp",
+	Short: "Start the yisp language server",
+	Long: `Speak the Language Server Protocol over stdin and stdout.
+Open documents are linted as you type and evaluated shortly after, so that errors show up as diagnostics.
+Commands are never executed and remote files and schemas are never fetched during evaluation.`,
+	Args: cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		allowUntypedManifest, _ := cmd.Flags().GetBool("allow-untyped-manifest")
+		globals, _ := cmd.Flags().GetStringSlice("global")
+
+		version := ""
+		if buildInfo, ok := debug.ReadBuildInfo(); ok {
+			version = buildInfo.Main.Version
+		}
+
+		// stdout carries the protocol, keep stray prints from corrupting it
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+
+		// documents are evaluated on every edit, so schemas named by URL are only taken from the cache
+		schemas := schemaSources()
+		schemas.Offline = true
+
+		server := lsp.NewServer(os.Stdin, stdout, lsp.Options{
+			Engine: engine.Options{
+				AllowUntypedManifest: allowUntypedManifest,
+				SchemaRegistry:       core.NewDefaultSchemaRegistry(schemas),
+			},
+			AllowedEnvVars: viper.GetStringSlice("AllowedEnvVars"),
+			Lint:           lint.Options{Globals: globals},
+			Version:        version,
+			Log:            os.Stderr,
+		})
+
+		err := server.Run()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lspCmd)
+	lspCmd.Flags().Bool("allow-untyped-manifest", false, "Allow untyped manifest")
+	lspCmd.Flags().StringSlice("global", []string{}, "Names provided by the environment, e.g. items for krm functions")
+}
@@ -0,0 +1,249 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/totegamma/yisp/diff"
+	"github.com/totegamma/yisp/internal/yaml"
+)
+
+const (
+	// kustomizationFile lists the files written to an output directory. It is also used to find stale files.
+	kustomizationFile     = "kustomization.yaml"
+	defaultOutputTemplate = "<namespace>/<kind>-<name>.yaml"
+	// kustomizationMarker heads the kustomization.yaml written by yisp. Only files listed in a marked one are pruned.
+	kustomizationMarker = "# Generated by yisp build --output-dir. Listed files that are no longer rendered are removed.\n"
+)
+
+type kustomization struct {
+	APIVersion string   `yaml:"apiVersion"`
+	Kind       string   `yaml:"kind"`
+	Resources  []string `yaml:"resources"`
+}
+
+// outputDirResult summarizes what writeOutputDir changed
+type outputDirResult struct {
+	Written []string
+	Pruned  []string
+}
+
+// writeOutputDir writes every document of rendered into its own file below dir, named by template.
+// Files listed in the kustomization.yaml of a previous run that are not written again are removed.
+// A kustomization.yaml that yisp did not write is neither pruned from nor overwritten,
+// and neither are existing files that it does not list.
+func writeOutputDir(rendered, dir, template string) (outputDirResult, error) {
+	var result outputDirResult
+
+	files := make(map[string][]byte)
+	owners := make(map[string]string)
+	decoder := yaml.NewDecoder(strings.NewReader(rendered))
+	for index := 0; ; index++ {
+		var node yaml.Node
+		err := decoder.Decode(&node)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return result, err
+		}
+
+		var document any
+		err = node.Decode(&document)
+		if err != nil {
+			return result, err
+		}
+		if document == nil {
+			index--
+			continue
+		}
+
+		id := diff.IdentityOf(document)
+		name, err := outputPath(template, id, index)
+		if err != nil {
+			return result, err
+		}
+		owner := id.String()
+		if id.IsZero() {
+			owner = fmt.Sprintf("document %d", index)
+		}
+		if other, ok := owners[name]; ok {
+			return result, fmt.Errorf("%s and %s would both be written to %s; use a template that tells them apart", other, owner, name)
+		}
+		owners[name] = owner
+
+		buf := bytes.Buffer{}
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		err = enc.Encode(&node)
+		if err != nil {
+			return result, err
+		}
+		enc.Close()
+		files[name] = buf.Bytes()
+	}
+	if _, ok := files[kustomizationFile]; ok {
+		return result, fmt.Errorf("%s is reserved for the index of the output directory", kustomizationFile)
+	}
+
+	previous, err := readKustomization(dir)
+	if err != nil {
+		return result, err
+	}
+
+	// files that are not listed in the index were not written by yisp, and must not be overwritten
+	listed := make(map[string]bool, len(previous))
+	for _, name := range previous {
+		listed[name] = true
+	}
+	foreign := make([]string, 0)
+	for name := range files {
+		if listed[name] {
+			continue
+		}
+		_, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(name)))
+		if err == nil {
+			foreign = append(foreign, name)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return result, err
+		}
+	}
+	if len(foreign) > 0 {
+		slices.Sort(foreign)
+		return result, fmt.Errorf("%s already contains files that yisp did not write: %s; move them away or use another output directory", dir, strings.Join(foreign, ", "))
+	}
+
+	for name, content := range files {
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		current, err := os.ReadFile(target)
+		if err == nil && bytes.Equal(current, content) {
+			continue
+		}
+		err = os.MkdirAll(filepath.Dir(target), 0755)
+		if err != nil {
+			return result, err
+		}
+		err = os.WriteFile(target, content, 0644)
+		if err != nil {
+			return result, err
+		}
+		result.Written = append(result.Written, name)
+	}
+	slices.Sort(result.Written)
+
+	for _, name := range previous {
+		if _, ok := files[name]; ok || !filepath.IsLocal(filepath.FromSlash(name)) {
+			continue
+		}
+		err := os.Remove(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return result, err
+		}
+		result.Pruned = append(result.Pruned, name)
+		removeEmptyParents(dir, path.Dir(name))
+	}
+
+	resources := make([]string, 0, len(files))
+	for name := range files {
+		resources = append(resources, name)
+	}
+	slices.Sort(resources)
+	index := bytes.NewBufferString(kustomizationMarker)
+	enc := yaml.NewEncoder(index)
+	enc.SetIndent(2)
+	err = enc.Encode(kustomization{
+		APIVersion: "kustomize.config.k8s.io/v1beta1",
+		Kind:       "Kustomization",
+		Resources:  resources,
+	})
+	if err != nil {
+		return result, err
+	}
+	enc.Close()
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return result, err
+	}
+	err = os.WriteFile(filepath.Join(dir, kustomizationFile), index.Bytes(), 0644)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// outputPath expands the placeholders of template for a document.
+// Path segments that expand to nothing are dropped, so cluster scoped resources are written one level up.
+func outputPath(template string, id diff.ID, index int) (string, error) {
+	group, version, found := strings.Cut(id.APIVersion, "/")
+	if !found {
+		group, version = "", group
+	}
+	name := id.Name
+	if name == "" {
+		name = "document-" + strconv.Itoa(index)
+	}
+
+	expanded := strings.NewReplacer(
+		"<apiVersion>", strings.ReplaceAll(id.APIVersion, "/", "_"),
+		"<group>", group,
+		"<version>", version,
+		"<kind>", strings.ToLower(id.Kind),
+		"<namespace>", id.Namespace,
+		"<name>", name,
+		"<index>", strconv.Itoa(index),
+	).Replace(template)
+
+	segments := make([]string, 0)
+	for _, segment := range strings.Split(expanded, "/") {
+		segment = strings.Trim(segment, "-_")
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	result := path.Join(segments...)
+	if !filepath.IsLocal(filepath.FromSlash(result)) {
+		return "", fmt.Errorf("output template %q expands to %q, which is outside the output directory", template, result)
+	}
+	return result, nil
+}
+
+// readKustomization returns the files listed in the index of dir, which must have been written by yisp if it exists
+func readKustomization(dir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, kustomizationFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte(kustomizationMarker)) {
+		return nil, fmt.Errorf("%s was not written by yisp; move it away or use another output directory", filepath.Join(dir, kustomizationFile))
+	}
+
+	var k kustomization
+	err = yaml.Unmarshal(data, &k)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Join(dir, kustomizationFile), err)
+	}
+	return k.Resources, nil
+}
+
+// removeEmptyParents removes the directory rel below dir and its parents as long as they are empty
+func removeEmptyParents(dir, rel string) {
+	for rel != "." && rel != "/" {
+		err := os.Remove(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil {
+			return
+		}
+		rel = path.Dir(rel)
+	}
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const outputDirTemplate = "<kind>-<name>.yaml"
+
+func TestWriteOutputDir(t *testing.T) {
+
+	dir := t.TempDir()
+	first := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+`
+	rendered := first + `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: b
+`
+
+	result, err := writeOutputDir(rendered, dir, outputDirTemplate)
+	if err != nil {
+		t.Fatalf("Error writing output dir: %v", err)
+	}
+	assert.Equal(t, []string{"configmap-a.yaml", "configmap-b.yaml"}, result.Written)
+	assert.FileExists(t, filepath.Join(dir, "configmap-a.yaml"))
+
+	// a file yisp did not write is not pruned
+	err = os.WriteFile(filepath.Join(dir, "notes.yaml"), []byte("keep: me\n"), 0644)
+	if err != nil {
+		t.Fatalf("Error writing file: %v", err)
+	}
+
+	result, err = writeOutputDir(first, dir, outputDirTemplate)
+	if err != nil {
+		t.Fatalf("Error writing output dir: %v", err)
+	}
+	assert.Empty(t, result.Written)
+	assert.Equal(t, []string{"configmap-b.yaml"}, result.Pruned)
+	assert.NoFileExists(t, filepath.Join(dir, "configmap-b.yaml"))
+	assert.FileExists(t, filepath.Join(dir, "notes.yaml"))
+}
+
+func TestWriteOutputDirForeignKustomization(t *testing.T) {
+
+	dir := t.TempDir()
+	kustomization := "resources:\n  - deployment.yaml\n"
+	err := os.WriteFile(filepath.Join(dir, kustomizationFile), []byte(kustomization), 0644)
+	if err != nil {
+		t.Fatalf("Error writing file: %v", err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "deployment.yaml"), []byte("kind: Deployment\n"), 0644)
+	if err != nil {
+		t.Fatalf("Error writing file: %v", err)
+	}
+
+	_, err = writeOutputDir("kind: ConfigMap\nmetadata:\n  name: a\n", dir, outputDirTemplate)
+	assert.ErrorContains(t, err, "was not written by yisp")
+
+	assert.FileExists(t, filepath.Join(dir, "deployment.yaml"))
+	assert.NoFileExists(t, filepath.Join(dir, "configmap-a.yaml"))
+	current, _ := os.ReadFile(filepath.Join(dir, kustomizationFile))
+	assert.Equal(t, kustomization, string(current))
+}
+
+func TestWriteOutputDirWithoutDocuments(t *testing.T) {
+
+	dir := filepath.Join(t.TempDir(), "out")
+
+	_, err := writeOutputDir("", dir, outputDirTemplate)
+	if err != nil {
+		t.Fatalf("Error writing output dir: %v", err)
+	}
+	assert.FileExists(t, filepath.Join(dir, kustomizationFile))
+}
+
+func TestWriteOutputDirExistingFiles(t *testing.T) {
+
+	dir := t.TempDir()
+	handwritten := "# maintained by hand\nkind: ConfigMap\n"
+	err := os.WriteFile(filepath.Join(dir, "configmap-a.yaml"), []byte(handwritten), 0644)
+	if err != nil {
+		t.Fatalf("Error writing file: %v", err)
+	}
+
+	// a first run does not take over files that were there before
+	rendered := "kind: ConfigMap\nmetadata:\n  name: a\n---\nkind: ConfigMap\nmetadata:\n  name: b\n"
+	_, err = writeOutputDir(rendered, dir, outputDirTemplate)
+	assert.ErrorContains(t, err, "already contains files that yisp did not write: configmap-a.yaml")
+	current, _ := os.ReadFile(filepath.Join(dir, "configmap-a.yaml"))
+	assert.Equal(t, handwritten, string(current))
+	assert.NoFileExists(t, filepath.Join(dir, "configmap-b.yaml"))
+	assert.NoFileExists(t, filepath.Join(dir, kustomizationFile))
+
+	// neither does a later run
+	err = os.Remove(filepath.Join(dir, "configmap-a.yaml"))
+	if err != nil {
+		t.Fatalf("Error removing file: %v", err)
+	}
+	_, err = writeOutputDir("kind: ConfigMap\nmetadata:\n  name: b\n", dir, outputDirTemplate)
+	if err != nil {
+		t.Fatalf("Error writing output dir: %v", err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "configmap-a.yaml"), []byte(handwritten), 0644)
+	if err != nil {
+		t.Fatalf("Error writing file: %v", err)
+	}
+	_, err = writeOutputDir(rendered, dir, outputDirTemplate)
+	assert.ErrorContains(t, err, "configmap-a.yaml")
+	current, _ = os.ReadFile(filepath.Join(dir, "configmap-a.yaml"))
+	assert.Equal(t, handwritten, string(current))
+
+	// files listed in the index are overwritten
+	_, err = writeOutputDir("kind: ConfigMap\nmetadata:\n  name: b\ndata:\n  x: y\n", dir, outputDirTemplate)
+	assert.NoError(t, err)
+}
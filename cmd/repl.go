@@ -0,0 +1,335 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/peterh/liner"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/totegamma/yisp/core"
+	"github.com/totegamma/yisp/engine"
+	"github.com/totegamma/yisp/internal/yaml"
+	"github.com/totegamma/yisp/lib"
+)
+
+const replHelp = `Enter yisp expressions as you would write them in a file, e.g. !yisp [+, 1, 2]
+Multi-line input is terminated by an empty line.
+
+Commands:
+  :load <file>   evaluate a file in the current environment
+  :type <expr>   show the kind and type of an expression
+  :env           list names bound in the root environment
+  :help          show this message
+  :quit          exit the repl
+`
+
+var replCommands = []string{":load", ":type", ":env", ":help", ":quit"}
+
+var replCmd = &cobra.Command{
+	Use:   "repl",
+	Short: "Start an interactive yisp session",
+	Long:  `Read yisp expressions, evaluate them against a persistent environment and print the result`,
+	Args:  cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		allowUntypedManifest, _ := cmd.Flags().GetBool("allow-untyped-manifest")
+		renderSpecialObjects, _ := cmd.Flags().GetBool("render-special-objects")
+
+		e := engine.NewEngine(engine.Options{
+			RenderSpecialObjects: renderSpecialObjects,
+			AllowUntypedManifest: allowUntypedManifest,
+			SchemaRegistry:       schemaRegistry(),
+		})
+
+		allowCmd, err := cmd.Flags().GetBool("allow-cmd")
+		if err == nil {
+			e.SetOption("net.gammalab.yisp.exec.allow_cmd", allowCmd)
+		}
+		e.SetOption("net.gammalab.yisp.exec.allowed_go_pkgs", viper.GetStringSlice("AllowedGoPkgs"))
+		e.SetOption("net.gammalab.yisp.env.allowed_vars", viper.GetStringSlice("AllowedEnvVars"))
+
+		wd, err := os.Getwd()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+
+		r := &repl{
+			engine:   e,
+			env:      core.NewEnv(),
+			location: filepath.Join(wd, "repl.yisp"),
+		}
+		r.run()
+	},
+}
+
+type repl struct {
+	engine interface {
+		core.Engine
+		Render(node *core.YispNode) (string, error)
+	}
+	env      *core.Env
+	location string
+}
+
+func (r *repl) run() {
+	line := liner.NewLiner()
+	defer line.Close()
+
+	line.SetCtrlCAborts(true)
+	line.SetMultiLineMode(true)
+	line.SetWordCompleter(r.complete)
+
+	fmt.Println("yisp repl. Type :help for help.")
+
+	buffer := ""
+	for {
+		prompt := "yisp> "
+		if buffer != "" {
+			prompt = "....> "
+		}
+
+		input, err := line.Prompt(prompt)
+		if err != nil {
+			if errors.Is(err, liner.ErrPromptAborted) {
+				buffer = ""
+				continue
+			}
+			if errors.Is(err, io.EOF) {
+				fmt.Println()
+				return
+			}
+			fmt.Println("Error:", err)
+			return
+		}
+
+		if buffer == "" {
+			trimmed := strings.TrimSpace(input)
+			if trimmed == "" {
+				continue
+			}
+			line.AppendHistory(input)
+
+			if strings.HasPrefix(trimmed, ":") {
+				if quit := r.command(trimmed); quit {
+					return
+				}
+				continue
+			}
+
+			if !isCompleteInput(input) {
+				buffer = input + "\n"
+				continue
+			}
+
+			r.evaluate(input)
+			continue
+		}
+
+		if strings.TrimSpace(input) == "" {
+			r.evaluate(buffer)
+			buffer = ""
+			continue
+		}
+
+		line.AppendHistory(input)
+		buffer += input + "\n"
+	}
+}
+
+// command runs a repl command and reports whether the session should end
+func (r *repl) command(input string) bool {
+	name, arg, _ := strings.Cut(input, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case ":quit", ":q", ":exit":
+		return true
+	case ":help", ":h":
+		fmt.Print(replHelp)
+	case ":env":
+		names := make([]string, 0, len(r.env.Vars))
+		for name := range r.env.Vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%s: %s\n", name, r.env.Vars[name].Kind)
+		}
+	case ":load":
+		if arg == "" {
+			fmt.Println("Error: :load requires a file path")
+			return false
+		}
+		path, err := filepath.Abs(arg)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return false
+		}
+		result, err := core.CallEngineByPath(path, "", r.env, r.engine)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return false
+		}
+		r.print(result)
+	case ":type":
+		if arg == "" {
+			fmt.Println("Error: :type requires an expression")
+			return false
+		}
+		result, err := r.engine.Run(strings.NewReader(arg), r.env, r.location)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return false
+		}
+		documents, _ := result.Value.([]any)
+		if len(documents) == 0 {
+			fmt.Println("null")
+			return false
+		}
+		node, ok := documents[len(documents)-1].(*core.YispNode)
+		if !ok {
+			fmt.Printf("Error: invalid document type: %T\n", documents[len(documents)-1])
+			return false
+		}
+		fmt.Println(describeType(node))
+	default:
+		fmt.Printf("Error: unknown command %s. Type :help for help.\n", name)
+	}
+
+	return false
+}
+
+func (r *repl) evaluate(input string) {
+	result, err := r.engine.Run(strings.NewReader(input), r.env, r.location)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	r.print(result)
+}
+
+func (r *repl) print(node *core.YispNode) {
+	rendered, err := r.engine.Render(node)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Print(rendered)
+	if rendered != "" && !strings.HasSuffix(rendered, "\n") {
+		fmt.Println()
+	}
+}
+
+// complete returns completions for the word under the cursor.
+// Words starting with * complete against the environment, others against operators.
+func (r *repl) complete(line string, pos int) (string, []string, string) {
+	start := strings.LastIndexAny(line[:pos], " \t[,") + 1
+	head, word, tail := line[:start], line[start:pos], line[pos:]
+
+	var candidates []string
+	switch {
+	case start == 0 && strings.HasPrefix(word, ":"):
+		candidates = replCommands
+	case strings.HasPrefix(word, "*"):
+		for env := r.env; env != nil; env = env.Parent {
+			for name := range env.Vars {
+				candidates = append(candidates, "*"+name)
+			}
+		}
+	default:
+		candidates = append(engine.OperatorNames(), lib.OperatorNames()...)
+	}
+
+	completions := make([]string, 0)
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) && !slices.Contains(completions, candidate) {
+			completions = append(completions, candidate)
+		}
+	}
+	sort.Strings(completions)
+
+	return head, completions, tail
+}
+
+// isCompleteInput reports whether a single line can be evaluated on its own.
+// Lines that open a block (e.g. "foo:" or "!yisp &name") or fail to parse start multi-line input.
+func isCompleteInput(input string) bool {
+	trimmed := strings.TrimSpace(input)
+	if strings.HasSuffix(trimmed, ":") || strings.HasSuffix(trimmed, "-") || strings.HasSuffix(trimmed, "|") || strings.HasSuffix(trimmed, ">") {
+		return false
+	}
+
+	onlyProperties := true
+	for _, field := range strings.Fields(trimmed) {
+		if !strings.HasPrefix(field, "!") && !strings.HasPrefix(field, "&") {
+			onlyProperties = false
+			break
+		}
+	}
+	if onlyProperties {
+		return false
+	}
+
+	var node yaml.Node
+	return yaml.Unmarshal([]byte(input), &node) == nil
+}
+
+func describeType(node *core.YispNode) string {
+	description := node.Kind.String()
+
+	switch node.Kind {
+	case core.KindLambda:
+		lambda, ok := node.Value.(*core.Lambda)
+		if !ok {
+			break
+		}
+		args := make([]string, len(lambda.Arguments))
+		for i, arg := range lambda.Arguments {
+			args[i] = arg.Name
+			if arg.Schema != nil {
+				args[i] += ": " + schemaName(arg.Schema)
+			}
+		}
+		description += "(" + strings.Join(args, ", ") + ")"
+		if lambda.Returns != nil {
+			description += " -> " + schemaName(lambda.Returns)
+		}
+	case core.KindType:
+		schema, ok := node.Value.(*core.Schema)
+		if ok {
+			description += " " + schemaName(schema)
+		}
+	}
+
+	if node.Type != nil {
+		description += " (" + schemaName(node.Type) + ")"
+	}
+
+	return description
+}
+
+func schemaName(schema *core.Schema) string {
+	if schema.ID != "" {
+		return schema.ID
+	}
+	if schema.Type != "" {
+		return schema.Type
+	}
+	return "any"
+}
+
+func init() {
+	rootCmd.AddCommand(replCmd)
+	replCmd.Flags().BoolP("allow-cmd", "", false, "Allow command execution")
+	replCmd.Flags().BoolP("allow-untyped-manifest", "", false, "Allow untyped manifest")
+	replCmd.Flags().BoolP("render-special-objects", "", false, "Show special objects (e.g. type, lambda, etc.)")
+}
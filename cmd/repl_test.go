@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/totegamma/yisp/core"
+)
+
+func TestIsCompleteInput(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected bool
+	}{
+		{name: "scalar", input: "hello", expected: true},
+		{name: "call", input: "!yisp [+, 1, 2]", expected: true},
+		{name: "mapping", input: "a: 1", expected: true},
+		{name: "flow mapping", input: "{a: 1, b: [1, 2]}", expected: true},
+		{name: "unterminated flow sequence", input: "!yisp [+, 1,", expected: false},
+		{name: "unterminated nested flow sequence", input: "!yisp [+, [1, 2]", expected: false},
+		{name: "unterminated flow mapping", input: "{a: 1", expected: false},
+		{name: "unterminated double quoted string", input: `"hello`, expected: false},
+		{name: "unterminated single quoted string", input: "'hello", expected: false},
+		{name: "quoted string with a colon", input: `"a:"`, expected: true},
+		{name: "mapping key", input: "foo:", expected: false},
+		{name: "sequence entry", input: "-", expected: false},
+		{name: "literal block", input: "text: |", expected: false},
+		{name: "folded block", input: "text: >", expected: false},
+		{name: "tag only", input: "!yisp", expected: false},
+		{name: "tag and anchor", input: "!yisp &name", expected: false},
+		{name: "trailing whitespace", input: "foo:  ", expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, isCompleteInput(test.input))
+		})
+	}
+}
+
+func TestDescribeType(t *testing.T) {
+	intSchema := &core.Schema{Type: "integer"}
+	deployment := &core.Schema{ID: "io.k8s.api.apps.v1.Deployment", Type: "object"}
+
+	tests := []struct {
+		name     string
+		node     *core.YispNode
+		expected string
+	}{
+		{
+			name:     "scalar",
+			node:     &core.YispNode{Kind: core.KindString, Value: "hello"},
+			expected: "string",
+		},
+		{
+			name:     "typed map",
+			node:     &core.YispNode{Kind: core.KindMap, Type: deployment},
+			expected: "map (io.k8s.api.apps.v1.Deployment)",
+		},
+		{
+			name: "lambda",
+			node: &core.YispNode{Kind: core.KindLambda, Value: &core.Lambda{
+				Arguments: []core.TypedSymbol{{Name: "x", Schema: intSchema}, {Name: "y"}},
+				Returns:   &core.Schema{},
+			}},
+			expected: "lambda(x: integer, y) -> any",
+		},
+		{
+			name: "lambda without arguments",
+			node: &core.YispNode{Kind: core.KindLambda, Value: &core.Lambda{
+				Returns: deployment,
+			}},
+			expected: "lambda() -> io.k8s.api.apps.v1.Deployment",
+		},
+		{
+			name:     "type",
+			node:     &core.YispNode{Kind: core.KindType, Value: deployment},
+			expected: "type io.k8s.api.apps.v1.Deployment",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, describeType(test.node))
+		})
+	}
+}
+
+func TestReplComplete(t *testing.T) {
+	root := core.NewEnv()
+	root.Set("values", &core.YispNode{Kind: core.KindMap})
+	env := root.CreateChild()
+	env.Set("value", &core.YispNode{Kind: core.KindInt})
+	env.Set("other", &core.YispNode{Kind: core.KindInt})
+	r := &repl{env: env}
+
+	tests := []struct {
+		name        string
+		line        string
+		pos         int
+		head        string
+		completions []string
+		tail        string
+	}{
+		{
+			name:        "command",
+			line:        ":l",
+			pos:         2,
+			completions: []string{":load"},
+		},
+		{
+			name:        "operator",
+			line:        "!yisp [lists.c",
+			pos:         14,
+			head:        "!yisp [",
+			completions: []string{"lists.car", "lists.cdr", "lists.cons", "lists.contains"},
+		},
+		{
+			name:        "operator after a comma",
+			line:        "!yisp [+, [strings.to",
+			pos:         21,
+			head:        "!yisp [+, [",
+			completions: []string{"strings.toLower", "strings.toUpper"},
+		},
+		{
+			name:        "variables of parent environments",
+			line:        "!yisp [+, *val]",
+			pos:         14,
+			head:        "!yisp [+, ",
+			completions: []string{"*value", "*values"},
+			tail:        "]",
+		},
+		{
+			name:        "commands only at the start of a line",
+			line:        "foo :l",
+			pos:         6,
+			head:        "foo ",
+			completions: []string{},
+		},
+		{
+			name:        "no match",
+			line:        "!yisp [nothing",
+			pos:         14,
+			head:        "!yisp [",
+			completions: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			head, completions, tail := r.complete(test.line, test.pos)
+			assert.Equal(t, test.head, head)
+			assert.Equal(t, test.completions, completions)
+			assert.Equal(t, test.tail, tail)
+		})
+	}
+}
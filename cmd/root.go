@@ -1,11 +1,13 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/totegamma/yisp/core"
 )
 
 var rootCmd = &cobra.Command{
@@ -22,6 +24,9 @@ func Execute() {
 
 func init() {
 	rootCmd.PersistentFlags().String("cache-dir", "", "Directory to use for caching schemas and other data")
+	rootCmd.PersistentFlags().String("schema-dir", "", "Directory of project schemas, looked up before the cache")
+	rootCmd.PersistentFlags().String("kube-profile", "", "Use the Kubernetes schemas cached with cache-kube-schemas --profile")
+	rootCmd.PersistentFlags().String("kube-version", "", "Use the bundled schemas of a Kubernetes minor version, e.g. 1.30")
 	rootCmd.PersistentFlags().StringP("config", "c", "", "Config file (default is $HOME/.config/yisp/config.yaml)")
 	cobra.OnInitialize(initConfig)
 }
@@ -51,6 +56,32 @@ func initConfig() {
 	err := viper.ReadInConfig()
 	if err != nil {
 		viper.SetDefault("AllowedGoPkgs", []string{})
+		viper.SetDefault("AllowedEnvVars", []string{})
 		_ = viper.WriteConfig()
 	}
+
+	applySchemaFormats()
+}
+
+// schemaFormatConfig configures a schema format, e.g. SchemaFormats: {uri: {strict: false}} in the config
+type schemaFormatConfig struct {
+	Strict *bool `mapstructure:"strict"`
+}
+
+// applySchemaFormats turns the checks of schema formats on or off as the config says
+func applySchemaFormats() {
+	var formats map[string]schemaFormatConfig
+	err := viper.UnmarshalKey("SchemaFormats", &formats)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: invalid SchemaFormats in the config:", err)
+		return
+	}
+	for name, format := range formats {
+		if format.Strict == nil {
+			continue
+		}
+		if !core.SetSchemaFormatStrict(name, *format.Strict) {
+			fmt.Fprintf(os.Stderr, "Warning: unknown schema format %s in the config\n", name)
+		}
+	}
 }
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/totegamma/yisp/engine"
+	"github.com/totegamma/yisp/yisptest"
+)
+
+var testCmd = &cobra.Command{
+	Use:   "test [dir]",
+	Short: "Run golden file tests",
+	Long: `Evaluate every *.test.yisp below dir, run the deftest forms in it
+and compare the output with the *.expected.yisp next to it, if there is one.
+A directory containing a ` + yisptest.ManifestFile + ` runs the tests listed there instead:
+
+  options:
+    allowUntypedManifest: true
+  tests:
+    - name: pod
+      test: pod.yisp
+      expected: pod.expected.yaml
+      options:
+        disableTypeCheck: true
+
+Commands, Go packages and environment variables are allowed by --allow-cmd and the config only,
+not by the manifest.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		update, _ := cmd.Flags().GetBool("update")
+		junit, _ := cmd.Flags().GetString("junit")
+		manifest, _ := cmd.Flags().GetString("manifest")
+		allowUntypedManifest, _ := cmd.Flags().GetBool("allow-untyped-manifest")
+		disableTypeCheck, _ := cmd.Flags().GetBool("disable-type-check")
+		renderSpecialObjects, _ := cmd.Flags().GetBool("render-special-objects")
+		allowCmd, _ := cmd.Flags().GetBool("allow-cmd")
+		coverageFile, _ := cmd.Flags().GetString("coverage")
+
+		opts := yisptest.Options{
+			AllowUntypedManifest: allowUntypedManifest,
+			DisableTypeCheck:     disableTypeCheck,
+			RenderSpecialObjects: renderSpecialObjects,
+			AllowCmd:             allowCmd,
+			AllowedGoPkgs:        viper.GetStringSlice("AllowedGoPkgs"),
+			AllowedEnvVars:       viper.GetStringSlice("AllowedEnvVars"),
+			SchemaRegistry:       schemaRegistry(),
+		}
+		if coverageFile != "" {
+			opts.Coverage = engine.NewCoverage()
+		}
+
+		dir := "."
+		if len(args) > 0 {
+			dir = args[0]
+		}
+
+		var cases []yisptest.Case
+		var err error
+		if manifest != "" {
+			cases, err = yisptest.LoadManifest(manifest, opts)
+		} else {
+			cases, err = yisptest.Discover(dir, opts)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+
+		counts := map[yisptest.Status]int{}
+		results := make([]yisptest.Result, 0, len(cases))
+		for _, c := range cases {
+			result := yisptest.Run(c, update)
+			results = append(results, result)
+			counts[result.Status]++
+
+			switch result.Status {
+			case yisptest.StatusPass:
+				fmt.Printf("PASS   %s (%s)\n", c.Name, result.Duration.Round(1e6))
+			case yisptest.StatusUpdated:
+				fmt.Printf("UPDATE %s\n", c.Name)
+			case yisptest.StatusFail:
+				fmt.Printf("FAIL   %s (%s)\n", c.Name, result.Duration.Round(1e6))
+				if len(result.Changes) > 0 {
+					fmt.Printf("    --- %s\n    +++ rendered %s\n", c.Expected, c.Test)
+					for _, change := range result.Changes {
+						fmt.Printf("    %s\n", change)
+					}
+				}
+			case yisptest.StatusError:
+				fmt.Printf("ERROR  %s\n", c.Name)
+				fmt.Printf("    %s\n", result.Err)
+			}
+
+			for _, test := range result.Tests {
+				switch {
+				case test.Err != nil:
+					fmt.Printf("    ERROR %s\n", test.Name)
+					fmt.Printf("        %s\n", strings.ReplaceAll(test.Err.Error(), "\n", "\n        "))
+				case len(test.Failures) > 0:
+					fmt.Printf("    FAIL  %s\n", test.Name)
+					for _, failure := range test.Failures {
+						fmt.Printf("        %s\n", strings.ReplaceAll(failure.String(), "\n", "\n            "))
+					}
+				default:
+					fmt.Printf("    ok    %s (%s)\n", test.Name, test.Duration.Round(1e3))
+				}
+			}
+		}
+
+		fmt.Printf("\n%d passed, %d failed, %d errors", counts[yisptest.StatusPass], counts[yisptest.StatusFail], counts[yisptest.StatusError])
+		if update {
+			fmt.Printf(", %d updated", counts[yisptest.StatusUpdated])
+		}
+		fmt.Println()
+
+		if opts.Coverage != nil {
+			writeCoverage(opts.Coverage, coverageFile)
+		}
+
+		if junit != "" {
+			file, err := os.Create(junit)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
+			}
+			name, _ := filepath.Abs(dir)
+			err = yisptest.WriteJUnit(file, filepath.Base(name), results)
+			file.Close()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
+			}
+		}
+
+		if counts[yisptest.StatusFail] > 0 || counts[yisptest.StatusError] > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(testCmd)
+	testCmd.Flags().Bool("update", false, "Rewrite golden files with the rendered output")
+	testCmd.Flags().String("junit", "", "Write a JUnit XML report to this file")
+	testCmd.Flags().String("manifest", "", "Run the tests listed in this manifest instead of searching dir")
+	testCmd.Flags().Bool("allow-untyped-manifest", false, "Allow untyped manifest")
+	testCmd.Flags().Bool("disable-type-check", false, "Disable type check")
+	testCmd.Flags().Bool("render-special-objects", false, "Render special objects")
+	testCmd.Flags().Bool("allow-cmd", false, "Allow command execution")
+	testCmd.Flags().String("coverage", "", "Write an lcov coverage report of the evaluated yisp sources to this file")
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/totegamma/yisp/core"
+)
+
+// addValuesFlags registers the flags that set the values symbol of the entry file
+func addValuesFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayP("values", "f", nil, "Read values from a YAML file (repeatable, later files are merged over earlier ones)")
+	cmd.Flags().StringArray("set", nil, "Set values, e.g. image.tag=v1,replicas=3 (repeatable)")
+	cmd.Flags().StringArray("set-string", nil, "Set values as strings without type parsing (repeatable)")
+	cmd.Flags().StringArray("set-file", nil, "Set a value to the content of a file, e.g. config=app.conf (repeatable)")
+}
+
+// loadValues builds the values symbol from the values flags.
+// Values files are merged first, then --set, --set-string and --set-file in that order, like Helm does.
+// Without values flags, values is an empty map.
+func loadValues(cmd *cobra.Command) (*core.YispNode, error) {
+	files, _ := cmd.Flags().GetStringArray("values")
+	sets, _ := cmd.Flags().GetStringArray("set")
+	setStrings, _ := cmd.Flags().GetStringArray("set-string")
+	setFiles, _ := cmd.Flags().GetStringArray("set-file")
+
+	values := &core.YispNode{Kind: core.KindMap, Value: core.NewYispMap()}
+	merge := func(src *core.YispNode) error {
+		merged, err := core.DeepMergeYispNode(values, src, nil)
+		if err != nil {
+			return err
+		}
+		values = merged
+		return nil
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(data)) == 0 {
+			continue
+		}
+		node, err := core.ParseValuesFile(file, bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if node.Kind != core.KindMap {
+			return nil, fmt.Errorf("%s: values must be a map, got %s", file, node.Kind)
+		}
+		err = merge(node)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	for i, set := range sets {
+		node, err := core.ParseSetValues(set, true, core.FilePos{File: fmt.Sprintf("--set[%d]", i)})
+		if err != nil {
+			return nil, fmt.Errorf("--set %s: %w", set, err)
+		}
+		err = merge(node)
+		if err != nil {
+			return nil, fmt.Errorf("--set %s: %w", set, err)
+		}
+	}
+
+	for i, set := range setStrings {
+		node, err := core.ParseSetValues(set, false, core.FilePos{File: fmt.Sprintf("--set-string[%d]", i)})
+		if err != nil {
+			return nil, fmt.Errorf("--set-string %s: %w", set, err)
+		}
+		err = merge(node)
+		if err != nil {
+			return nil, fmt.Errorf("--set-string %s: %w", set, err)
+		}
+	}
+
+	for _, set := range setFiles {
+		key, path, ok := strings.Cut(set, "=")
+		if !ok {
+			return nil, fmt.Errorf("--set-file %s: expected key=path", set)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("--set-file %s: %w", set, err)
+		}
+
+		node := &core.YispNode{Kind: core.KindMap, Value: core.NewYispMap()}
+		err = core.SetValuePath(node, key, &core.YispNode{
+			Kind:  core.KindString,
+			Value: string(data),
+			Attr:  core.Attribute{Sources: []core.FilePos{{File: path, Line: 1, Column: 1}}},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("--set-file %s: %w", set, err)
+		}
+		err = merge(node)
+		if err != nil {
+			return nil, fmt.Errorf("--set-file %s: %w", set, err)
+		}
+	}
+
+	return values, nil
+}
+
+// valuesFiles returns the files read by loadValues
+func valuesFiles(cmd *cobra.Command) []string {
+	files, _ := cmd.Flags().GetStringArray("values")
+	setFiles, _ := cmd.Flags().GetStringArray("set-file")
+
+	result := append([]string{}, files...)
+	for _, set := range setFiles {
+		if _, path, ok := strings.Cut(set, "="); ok {
+			result = append(result, path)
+		}
+	}
+	return result
+}
@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/totegamma/yisp/diff"
+	"github.com/totegamma/yisp/engine"
+)
+
+// watchDebounce is how long to wait for more changes before rebuilding, since editors often write a file several times
+const watchDebounce = 100 * time.Millisecond
+
+// buildWatcher rebuilds an entry file whenever one of the files or directories read by the last build changes
+type buildWatcher struct {
+	path      string
+	outputDir string
+	template  string
+	build     func(deps *engine.Dependencies) (string, error)
+
+	watcher   *fsnotify.Watcher
+	watched   map[string]bool
+	deps      *engine.Dependencies
+	documents []any
+}
+
+// watchBuild builds path, then rebuilds it on every change until interrupted.
+// Each build prints a summary of the changed documents or the error to stderr,
+// and writes the rendered YAML to outputDir if set or to stdout otherwise.
+func watchBuild(path, outputDir, template string, build func(deps *engine.Dependencies) (string, error)) int {
+	w, err := newBuildWatcher(path, outputDir, template, build)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	defer w.watcher.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	w.rebuild(nil)
+
+	var timer <-chan time.Time
+	changed := make([]string, 0)
+	for {
+		select {
+		case <-ctx.Done():
+			return 0
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return 0
+			}
+			if !w.affects(event) {
+				continue
+			}
+			changed = append(changed, event.Name)
+			timer = time.After(watchDebounce)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return 0
+			}
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		case <-timer:
+			w.rebuild(changed)
+			changed = changed[:0]
+			timer = nil
+		}
+	}
+}
+
+// newBuildWatcher creates a watcher for the entry file path.
+// Paths are made absolute, since the dependencies of a build and the events of the watched directories are.
+func newBuildWatcher(path, outputDir, template string, build func(deps *engine.Dependencies) (string, error)) (*buildWatcher, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if outputDir != "" {
+		outputDir, err = filepath.Abs(outputDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	return &buildWatcher{
+		path:      path,
+		outputDir: outputDir,
+		template:  template,
+		build:     build,
+		watcher:   watcher,
+		watched:   make(map[string]bool),
+		deps:      engine.NewDependencies(),
+	}, nil
+}
+
+// rebuild builds the entry file, prints the summary and watches what the build read
+func (w *buildWatcher) rebuild(changed []string) {
+	start := time.Now()
+	prefix := start.Format("[15:04:05]")
+	if len(changed) > 0 {
+		fmt.Fprintf(os.Stderr, "%s %s changed\n", prefix, describeChanged(changed))
+	}
+
+	deps := engine.NewDependencies()
+	rendered, err := w.build(deps)
+	if err != nil {
+		// keep watching what the last build read, since a broken file may have hidden the rest
+		deps.Merge(w.deps)
+		w.watch(deps)
+		fmt.Fprintf(os.Stderr, "%s Error: %v\n", prefix, err)
+		return
+	}
+	w.watch(deps)
+
+	documents, err := diff.DecodeDocuments(strings.NewReader(rendered))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s Error: %v\n", prefix, err)
+		return
+	}
+
+	if w.outputDir != "" {
+		result, err := writeOutputDir(rendered, w.outputDir, w.template)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s Error: %v\n", prefix, err)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "%s %s: %d files written, %d stale files pruned\n", prefix, w.outputDir, len(result.Written), len(result.Pruned))
+	} else {
+		fmt.Println(rendered)
+	}
+
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if w.documents == nil {
+		fmt.Fprintf(os.Stderr, "%s built %s: %d documents in %s, watching %d files\n", prefix, w.path, len(documents), elapsed, len(deps.Files()))
+	} else {
+		changes := diff.Documents(w.documents, documents)
+		fmt.Fprintf(os.Stderr, "%s rebuilt %s: %d changed documents in %s\n", prefix, w.path, len(changes), elapsed)
+		printDocumentChanges(os.Stderr, changes)
+	}
+	w.documents = documents
+}
+
+// watch watches the directories of every dependency and stops watching the ones that are no longer needed.
+// Directories are watched instead of files because editors often replace files instead of writing them.
+func (w *buildWatcher) watch(deps *engine.Dependencies) {
+	// the entry file is always watched, even if the build failed before reading it
+	wanted := map[string]bool{filepath.Dir(w.path): true}
+	for _, file := range deps.Files() {
+		wanted[filepath.Dir(file)] = true
+	}
+	for dir, recursive := range deps.Dirs() {
+		wanted[dir] = true
+		if !recursive {
+			continue
+		}
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && d.IsDir() {
+				wanted[path] = true
+			}
+			return nil
+		})
+	}
+
+	for dir := range w.watched {
+		if !wanted[dir] {
+			w.watcher.Remove(dir)
+			delete(w.watched, dir)
+		}
+	}
+	for dir := range wanted {
+		if w.watched[dir] {
+			continue
+		}
+		// directories that do not exist yet are picked up by a later build once their parent changes
+		if err := w.watcher.Add(dir); err == nil {
+			w.watched[dir] = true
+		}
+	}
+	w.deps = deps
+}
+
+// affects reports whether an event touches a file or directory the last build read
+func (w *buildWatcher) affects(event fsnotify.Event) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+	name, err := filepath.Abs(event.Name)
+	if err != nil {
+		return false
+	}
+	if w.outputDir != "" && within(w.outputDir, name) {
+		return false
+	}
+
+	if name == w.path || slices.Contains(w.deps.Files(), name) {
+		return true
+	}
+	for dir, recursive := range w.deps.Dirs() {
+		if filepath.Dir(name) == dir || recursive && within(dir, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// within reports whether path is dir or below it
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func describeChanged(changed []string) string {
+	unique := make([]string, 0, len(changed))
+	for _, name := range changed {
+		if !slices.Contains(unique, name) {
+			unique = append(unique, name)
+		}
+	}
+	if len(unique) == 1 {
+		return unique[0]
+	}
+	return fmt.Sprintf("%s and %d more files", unique[0], len(unique)-1)
+}
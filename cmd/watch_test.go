@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/totegamma/yisp/engine"
+)
+
+// newTestWatcher creates a watcher for index.yisp in the working directory, with paths given relative to it
+func newTestWatcher(t *testing.T, outputDir string) *buildWatcher {
+	t.Helper()
+	w, err := newBuildWatcher("index.yisp", outputDir, defaultOutputTemplate, nil)
+	if err != nil {
+		t.Fatalf("Error creating watcher: %v", err)
+	}
+	t.Cleanup(func() { w.watcher.Close() })
+	return w
+}
+
+func watchedDirs(w *buildWatcher) []string {
+	dirs := make([]string, 0, len(w.watched))
+	for dir := range w.watched {
+		dirs = append(dirs, dir)
+	}
+	slices.Sort(dirs)
+	return dirs
+}
+
+func TestBuildWatcherWatch(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	for _, sub := range []string{"lib", "templates/nested/deeper", "other"} {
+		err := os.MkdirAll(filepath.Join(dir, sub), 0755)
+		if err != nil {
+			t.Fatalf("Error creating directory: %v", err)
+		}
+	}
+
+	w := newTestWatcher(t, "")
+	assert.Equal(t, filepath.Join(dir, "index.yisp"), w.path)
+
+	deps := engine.NewDependencies()
+	deps.AddFile("lib/util.yisp")
+	deps.AddDir("templates", true)
+	deps.AddDir("other", false)
+	deps.AddDir("missing", false)
+	w.watch(deps)
+	assert.Equal(t, []string{
+		dir,
+		filepath.Join(dir, "lib"),
+		filepath.Join(dir, "other"),
+		filepath.Join(dir, "templates"),
+		filepath.Join(dir, "templates/nested"),
+		filepath.Join(dir, "templates/nested/deeper"),
+	}, watchedDirs(w))
+	assert.ElementsMatch(t, watchedDirs(w), w.watcher.WatchList())
+
+	// directories the next build does not read are no longer watched, but the one of the entry file is
+	deps = engine.NewDependencies()
+	deps.AddFile("lib/util.yisp")
+	w.watch(deps)
+	assert.Equal(t, []string{dir, filepath.Join(dir, "lib")}, watchedDirs(w))
+	assert.ElementsMatch(t, watchedDirs(w), w.watcher.WatchList())
+
+	// a directory that did not exist is watched once it does
+	err := os.Mkdir(filepath.Join(dir, "missing"), 0755)
+	if err != nil {
+		t.Fatalf("Error creating directory: %v", err)
+	}
+	deps.AddDir("missing", false)
+	w.watch(deps)
+	assert.Equal(t, []string{dir, filepath.Join(dir, "lib"), filepath.Join(dir, "missing")}, watchedDirs(w))
+}
+
+func TestBuildWatcherAffects(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	w := newTestWatcher(t, "templates/rendered")
+	deps := engine.NewDependencies()
+	deps.AddFile("lib/util.yisp")
+	deps.AddDir("templates", true)
+	deps.AddDir("snippets", false)
+	w.watch(deps)
+
+	tests := []struct {
+		name     string
+		event    fsnotify.Event
+		expected bool
+	}{
+		{name: "entry file", event: fsnotify.Event{Name: filepath.Join(dir, "index.yisp"), Op: fsnotify.Write}, expected: true},
+		{name: "relative entry file", event: fsnotify.Event{Name: "index.yisp", Op: fsnotify.Write}, expected: true},
+		{name: "imported file", event: fsnotify.Event{Name: filepath.Join(dir, "lib/util.yisp"), Op: fsnotify.Write}, expected: true},
+		{name: "replaced file", event: fsnotify.Event{Name: filepath.Join(dir, "lib/util.yisp"), Op: fsnotify.Rename}, expected: true},
+		{name: "chmod", event: fsnotify.Event{Name: filepath.Join(dir, "lib/util.yisp"), Op: fsnotify.Chmod}, expected: false},
+		{name: "unrelated file next to an imported one", event: fsnotify.Event{Name: filepath.Join(dir, "lib/other.yisp"), Op: fsnotify.Create}, expected: false},
+		{name: "file in a listed directory", event: fsnotify.Event{Name: filepath.Join(dir, "snippets/a.yaml"), Op: fsnotify.Create}, expected: true},
+		{name: "file below a listed directory", event: fsnotify.Event{Name: filepath.Join(dir, "snippets/nested/a.yaml"), Op: fsnotify.Create}, expected: false},
+		{name: "file below a recursively listed directory", event: fsnotify.Event{Name: filepath.Join(dir, "templates/nested/a.yaml"), Op: fsnotify.Create}, expected: true},
+		{name: "file in the output directory", event: fsnotify.Event{Name: filepath.Join(dir, "templates/rendered/configmap-a.yaml"), Op: fsnotify.Write}, expected: false},
+		{name: "output directory", event: fsnotify.Event{Name: filepath.Join(dir, "templates/rendered"), Op: fsnotify.Create}, expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, w.affects(test.event))
+		})
+	}
+}
+
+func TestWithin(t *testing.T) {
+	tests := []struct {
+		dir      string
+		path     string
+		expected bool
+	}{
+		{dir: "/a", path: "/a", expected: true},
+		{dir: "/a", path: "/a/b", expected: true},
+		{dir: "/a", path: "/a/b/c", expected: true},
+		{dir: "/a", path: "/ab", expected: false},
+		{dir: "/a", path: "/", expected: false},
+		{dir: "/a/b", path: "/a/c", expected: false},
+		{dir: "/a", path: "/a/..b", expected: true},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, within(test.dir, test.path), "%s in %s", test.path, test.dir)
+	}
+}
@@ -0,0 +1,119 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// CRDSchema is the schema of a served version of a CustomResourceDefinition
+type CRDSchema struct {
+	Group   string
+	Version string
+	Kind    string
+	// ID is the name Kubernetes publishes the schema under, e.g. io.cert-manager.v1.Certificate
+	ID     string
+	Schema *Schema
+}
+
+// IsCRD reports whether a manifest, given as native values, is a CustomResourceDefinition
+func IsCRD(manifest map[string]any) bool {
+	apiVersion, _ := manifest["apiVersion"].(string)
+	kind, _ := manifest["kind"].(string)
+	return strings.HasPrefix(apiVersion, "apiextensions.k8s.io/") && kind == "CustomResourceDefinition"
+}
+
+// CRDSchemas returns the schemas of the served versions of a CustomResourceDefinition, given as native values.
+// Like the schemas Kubernetes publishes for custom resources, they declare apiVersion, kind and metadata,
+// and accept any object metadata. Versions without a schema are skipped.
+func CRDSchemas(crd map[string]any) ([]CRDSchema, error) {
+	if !IsCRD(crd) {
+		return nil, fmt.Errorf("not a CustomResourceDefinition: %v %v", crd["apiVersion"], crd["kind"])
+	}
+
+	spec, _ := crd["spec"].(map[string]any)
+	group, _ := spec["group"].(string)
+	names, _ := spec["names"].(map[string]any)
+	kind, _ := names["kind"].(string)
+	if group == "" || kind == "" {
+		return nil, fmt.Errorf("CustomResourceDefinition has no spec.group or spec.names.kind")
+	}
+
+	// apiextensions.k8s.io/v1beta1 may declare one schema for all versions
+	var sharedSchema any
+	if validation, ok := spec["validation"].(map[string]any); ok {
+		sharedSchema = validation["openAPIV3Schema"]
+	}
+	versions, _ := spec["versions"].([]any)
+	if len(versions) == 0 {
+		if version, ok := spec["version"].(string); ok {
+			versions = []any{map[string]any{"name": version, "served": true}}
+		}
+	}
+
+	schemas := make([]CRDSchema, 0, len(versions))
+	for _, versionAny := range versions {
+		version, ok := versionAny.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid version of CustomResourceDefinition %s: %T", kind, versionAny)
+		}
+		name, _ := version["name"].(string)
+		if served, ok := version["served"].(bool); ok && !served {
+			continue
+		}
+
+		openAPIV3Schema := sharedSchema
+		if versionSchema, ok := version["schema"].(map[string]any); ok {
+			openAPIV3Schema = versionSchema["openAPIV3Schema"]
+		}
+		if openAPIV3Schema == nil {
+			continue
+		}
+
+		schema, err := crdSchema(openAPIV3Schema)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema of %s/%s %s: %v", group, name, kind, err)
+		}
+
+		id := crdSchemaID(group, name, kind)
+		schema.ID = id
+		schemas = append(schemas, CRDSchema{Group: group, Version: name, Kind: kind, ID: id, Schema: schema})
+	}
+	return schemas, nil
+}
+
+func crdSchema(openAPIV3Schema any) (*Schema, error) {
+	data, err := json.Marshal(openAPIV3Schema)
+	if err != nil {
+		return nil, err
+	}
+	var schema Schema
+	err = json.Unmarshal(data, &schema)
+	if err != nil {
+		return nil, err
+	}
+
+	if schema.Properties == nil {
+		schema.Properties = make(map[string]*Schema)
+	}
+	for _, key := range []string{"apiVersion", "kind"} {
+		if schema.Properties[key] == nil {
+			schema.Properties[key] = &Schema{Type: "string"}
+		}
+	}
+	metadata := schema.Properties["metadata"]
+	if metadata == nil {
+		metadata = &Schema{Type: "object"}
+		schema.Properties["metadata"] = metadata
+	}
+	metadata.K8sPreserveUnknownFields = true
+	return &schema, nil
+}
+
+// crdSchemaID names a schema like Kubernetes does in its OpenAPI spec: the group reversed, the version and the kind
+func crdSchemaID(group, version, kind string) string {
+	parts := strings.Split(group, ".")
+	slices.Reverse(parts)
+	return strings.Join(parts, ".") + "." + version + "." + kind
+}
@@ -0,0 +1,503 @@
+package core
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"github.com/totegamma/yisp/diff"
+)
+
+// formatExtensions maps the format names accepted as an explicit override to the extension they stand for
+var formatExtensions = map[string]string{
+	"yisp":       ".yisp",
+	"yaml":       ".yaml",
+	"json":       ".json",
+	"toml":       ".toml",
+	"env":        ".env",
+	"dotenv":     ".env",
+	"ini":        ".ini",
+	"properties": ".properties",
+	"csv":        ".csv",
+	"text":       ".txt",
+}
+
+// FormatExtension returns the file extension a format name stands for
+func FormatExtension(format string) (string, error) {
+	extension, ok := formatExtensions[format]
+	if !ok {
+		names := make([]string, 0, len(formatExtensions))
+		for name := range formatExtensions {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return "", fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(names, ", "))
+	}
+	return extension, nil
+}
+
+func newStringNode(value string, pos FilePos) *YispNode {
+	return &YispNode{
+		Kind:  KindString,
+		Value: value,
+		Attr:  Attribute{Sources: []FilePos{pos}},
+	}
+}
+
+func newMapNode(m *YispMap, pos FilePos) *YispNode {
+	return &YispNode{
+		Kind:  KindMap,
+		Value: m,
+		Attr:  Attribute{Sources: []FilePos{pos}},
+	}
+}
+
+// ParseToml parses a TOML document into a YispNode. Keys keep their order in the file,
+// and every key and array item records its line. Dates and times become strings.
+func ParseToml(filename string, reader io.Reader) (*YispNode, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TOML: %v", err)
+	}
+
+	var value map[string]any
+	err = toml.Unmarshal(data, &value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode TOML: %v", err)
+	}
+
+	positions, err := tomlPositions(filename, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode TOML: %v", err)
+	}
+
+	return tomlNode(value, "", positions, FilePos{File: filename, Line: 1, Column: 1})
+}
+
+// tomlPositions records the position of every key and array item by its JSON pointer path
+func tomlPositions(filename string, data []byte) (map[string]FilePos, error) {
+	positions := make(map[string]FilePos)
+	arrayTables := make(map[string]int)
+
+	p := unstable.Parser{}
+	p.Reset(data)
+
+	position := func(r unstable.Range) FilePos {
+		shape := p.Shape(r)
+		return FilePos{File: filename, Line: shape.Start.Line, Column: shape.Start.Column}
+	}
+
+	keyPath := func(prefix string, node *unstable.Node) (string, FilePos) {
+		path := prefix
+		var pos FilePos
+		it := node.Key()
+		for i := 0; it.Next(); i++ {
+			key := it.Node()
+			if i == 0 {
+				pos = position(key.Raw)
+			}
+			path += "/" + diff.EscapePointer(string(key.Data))
+			if _, ok := positions[path]; !ok {
+				positions[path] = pos
+			}
+		}
+		return path, pos
+	}
+
+	var walkValue func(path string, node *unstable.Node)
+	walkValue = func(path string, node *unstable.Node) {
+		switch node.Kind {
+		case unstable.Array:
+			it := node.Children()
+			for i := 0; it.Next(); i++ {
+				item := it.Node()
+				itemPath := path + "/" + strconv.Itoa(i)
+				positions[itemPath] = position(item.Raw)
+				walkValue(itemPath, item)
+			}
+		case unstable.InlineTable:
+			it := node.Children()
+			for it.Next() {
+				keyValue := it.Node()
+				keyValuePath, _ := keyPath(path, keyValue)
+				walkValue(keyValuePath, keyValue.Value())
+			}
+		}
+	}
+
+	table := ""
+	for p.NextExpression() {
+		expression := p.Expression()
+		switch expression.Kind {
+		case unstable.Table:
+			table, _ = keyPath("", expression)
+		case unstable.ArrayTable:
+			path, pos := keyPath("", expression)
+			index := arrayTables[path]
+			arrayTables[path] = index + 1
+			table = path + "/" + strconv.Itoa(index)
+			positions[table] = pos
+		case unstable.KeyValue:
+			path, _ := keyPath(table, expression)
+			walkValue(path, expression.Value())
+		}
+	}
+	return positions, p.Error()
+}
+
+func tomlNode(value any, path string, positions map[string]FilePos, parent FilePos) (*YispNode, error) {
+	pos, ok := positions[path]
+	if !ok {
+		pos = parent
+	}
+	attr := Attribute{Sources: []FilePos{pos}}
+
+	switch v := value.(type) {
+	case nil:
+		return &YispNode{Kind: KindNull, Attr: attr}, nil
+	case bool:
+		return &YispNode{Kind: KindBool, Value: v, Attr: attr}, nil
+	case int64:
+		return &YispNode{Kind: KindInt, Value: int(v), Attr: attr}, nil
+	case float64:
+		return &YispNode{Kind: KindFloat, Value: v, Attr: attr}, nil
+	case string:
+		return &YispNode{Kind: KindString, Value: v, Attr: attr}, nil
+	case time.Time:
+		return &YispNode{Kind: KindString, Value: v.Format(time.RFC3339Nano), Attr: attr}, nil
+	case toml.LocalDate, toml.LocalTime, toml.LocalDateTime:
+		return &YispNode{Kind: KindString, Value: fmt.Sprint(v), Attr: attr}, nil
+	case []any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			node, err := tomlNode(item, path+"/"+strconv.Itoa(i), positions, pos)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = node
+		}
+		return &YispNode{Kind: KindArray, Value: items, Attr: attr}, nil
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		keyPos := func(key string) FilePos {
+			return positions[path+"/"+diff.EscapePointer(key)]
+		}
+		slices.SortFunc(keys, func(a, b string) int {
+			pa, pb := keyPos(a), keyPos(b)
+			if pa.Line != pb.Line {
+				return pa.Line - pb.Line
+			}
+			if pa.Column != pb.Column {
+				return pa.Column - pb.Column
+			}
+			return strings.Compare(a, b)
+		})
+
+		m := NewYispMap()
+		for _, key := range keys {
+			node, err := tomlNode(v[key], path+"/"+diff.EscapePointer(key), positions, pos)
+			if err != nil {
+				return nil, err
+			}
+			m.Set(key, node)
+		}
+		return &YispNode{Kind: KindMap, Value: m, Attr: attr}, nil
+	default:
+		return nil, fmt.Errorf("unsupported TOML value at %s: %T", path, value)
+	}
+}
+
+// ParseDotenv parses a .env file into a map of strings.
+// Lines may start with export, values may be single quoted (literal) or double quoted (with escapes),
+// and unquoted values end at a " #" comment.
+func ParseDotenv(filename string, reader io.Reader) (*YispNode, error) {
+	m := NewYispMap()
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text = strings.TrimPrefix(text, "export ")
+
+		key, value, ok := strings.Cut(text, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s:%d: expected KEY=value", filename, line)
+		}
+		value, err := unquoteEnv(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", filename, line, err)
+		}
+
+		column := strings.Index(scanner.Text(), key) + 1
+		m.Set(key, newStringNode(value, FilePos{File: filename, Line: line, Column: column}))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read dotenv: %v", err)
+	}
+	return newMapNode(m, FilePos{File: filename, Line: 1, Column: 1}), nil
+}
+
+func unquoteEnv(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		end := 1
+		for ; end < len(value); end++ {
+			if value[end] == '\\' {
+				end++
+				continue
+			}
+			if value[end] == '"' {
+				break
+			}
+		}
+		if end >= len(value) {
+			return "", errors.New("unterminated double quoted value")
+		}
+		return strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\$`, "$", `\\`, `\`).Replace(value[1:end]), nil
+	case strings.HasPrefix(value, "'"):
+		end := strings.Index(value[1:], "'")
+		if end < 0 {
+			return "", errors.New("unterminated single quoted value")
+		}
+		return value[1 : end+1], nil
+	default:
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		return value, nil
+	}
+}
+
+// ParseIni parses an INI file into a map of sections. Keys before the first section are kept at the top level.
+// Values are strings; comments start with ; or #.
+func ParseIni(filename string, reader io.Reader) (*YispNode, error) {
+	root := NewYispMap()
+	current := root
+
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		raw := scanner.Text()
+		text := strings.TrimSpace(raw)
+		if text == "" || strings.HasPrefix(text, ";") || strings.HasPrefix(text, "#") {
+			continue
+		}
+		column := len(raw) - len(strings.TrimLeft(raw, " \t")) + 1
+		pos := FilePos{File: filename, Line: line, Column: column}
+
+		if strings.HasPrefix(text, "[") {
+			if !strings.HasSuffix(text, "]") {
+				return nil, fmt.Errorf("%s:%d: unterminated section header", filename, line)
+			}
+			name := strings.TrimSpace(text[1 : len(text)-1])
+			existing, ok := root.Get(name)
+			if node, isNode := existing.(*YispNode); ok && isNode && node.Kind == KindMap {
+				current = node.Value.(*YispMap)
+				continue
+			}
+			current = NewYispMap()
+			root.Set(name, newMapNode(current, pos))
+			continue
+		}
+
+		i := strings.IndexAny(text, "=:")
+		if i < 0 {
+			return nil, fmt.Errorf("%s:%d: expected key = value", filename, line)
+		}
+		key := strings.TrimSpace(text[:i])
+		value := strings.TrimSpace(text[i+1:])
+		if len(value) >= 2 && (value[0] == '"' && value[len(value)-1] == '"' || value[0] == '\'' && value[len(value)-1] == '\'') {
+			value = value[1 : len(value)-1]
+		}
+		current.Set(key, newStringNode(value, pos))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read INI: %v", err)
+	}
+	return newMapNode(root, FilePos{File: filename, Line: 1, Column: 1}), nil
+}
+
+// ParseProperties parses a Java properties file into a flat map of strings.
+// Keys are separated from values by =, : or whitespace, lines ending in a backslash continue,
+// and \uXXXX escapes are decoded.
+func ParseProperties(filename string, reader io.Reader) (*YispNode, error) {
+	m := NewYispMap()
+	scanner := bufio.NewScanner(reader)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := scanner.Text()
+		text := strings.TrimLeft(raw, " \t\f")
+		if text == "" || text[0] == '#' || text[0] == '!' {
+			continue
+		}
+		pos := FilePos{File: filename, Line: line, Column: len(raw) - len(text) + 1}
+
+		for continuesLine(text) && scanner.Scan() {
+			line++
+			text = text[:len(text)-1] + strings.TrimLeft(scanner.Text(), " \t\f")
+		}
+
+		key, value := splitProperty(text)
+		key, err := unescapeProperty(key)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", filename, pos.Line, err)
+		}
+		value, err = unescapeProperty(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", filename, pos.Line, err)
+		}
+		m.Set(key, newStringNode(value, pos))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read properties: %v", err)
+	}
+	return newMapNode(m, FilePos{File: filename, Line: 1, Column: 1}), nil
+}
+
+// continuesLine reports whether a line ends in an odd number of backslashes
+func continuesLine(text string) bool {
+	count := 0
+	for i := len(text) - 1; i >= 0 && text[i] == '\\'; i-- {
+		count++
+	}
+	return count%2 == 1
+}
+
+func splitProperty(text string) (string, string) {
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '=', ':', ' ', '\t', '\f':
+			key := text[:i]
+			rest := strings.TrimLeft(text[i:], " \t\f")
+			if text[i] == ' ' || text[i] == '\t' || text[i] == '\f' {
+				if strings.HasPrefix(rest, "=") || strings.HasPrefix(rest, ":") {
+					rest = rest[1:]
+				}
+			} else {
+				rest = rest[1:]
+			}
+			return key, strings.TrimLeft(rest, " \t\f")
+		}
+	}
+	return text, ""
+}
+
+func unescapeProperty(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	units := make([]uint16, 0)
+	flush := func() {
+		if len(units) > 0 {
+			b.WriteString(string(utf16Decode(units)))
+			units = units[:0]
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			flush()
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			flush()
+			b.WriteByte('\t')
+		case 'n':
+			flush()
+			b.WriteByte('\n')
+		case 'r':
+			flush()
+			b.WriteByte('\r')
+		case 'f':
+			flush()
+			b.WriteByte('\f')
+		case 'u':
+			if i+5 > len(s) {
+				return "", errors.New("malformed \\uXXXX escape")
+			}
+			unit, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", errors.New("malformed \\uXXXX escape")
+			}
+			units = append(units, uint16(unit))
+			i += 4
+		default:
+			flush()
+			b.WriteByte(s[i])
+		}
+	}
+	flush()
+	return b.String(), nil
+}
+
+func utf16Decode(units []uint16) []rune {
+	runes := make([]rune, 0, len(units))
+	for i := 0; i < len(units); i++ {
+		r := rune(units[i])
+		if r >= 0xd800 && r < 0xdc00 && i+1 < len(units) && units[i+1] >= 0xdc00 && units[i+1] < 0xe000 {
+			r = 0x10000 + (r-0xd800)<<10 + rune(units[i+1]-0xdc00)
+			i++
+		}
+		runes = append(runes, r)
+	}
+	return runes
+}
+
+// ParseCsv parses a CSV file with a header row into an array of maps, one per row, keyed by the header.
+// Values are strings.
+func ParseCsv(filename string, reader io.Reader) (*YispNode, error) {
+	r := csv.NewReader(reader)
+
+	header, err := r.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: missing header row", filename)
+		}
+		return nil, fmt.Errorf("failed to decode CSV: %v", err)
+	}
+	header = slices.Clone(header)
+
+	rows := make([]any, 0)
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode CSV: %v", err)
+		}
+
+		m := NewYispMap()
+		for i, name := range header {
+			line, column := r.FieldPos(i)
+			m.Set(name, newStringNode(record[i], FilePos{File: filename, Line: line, Column: column}))
+		}
+		line, column := r.FieldPos(0)
+		rows = append(rows, newMapNode(m, FilePos{File: filename, Line: line, Column: column}))
+	}
+
+	return &YispNode{
+		Kind:  KindArray,
+		Value: rows,
+		Attr:  Attribute{Sources: []FilePos{{File: filename, Line: 1, Column: 1}}},
+	}, nil
+}
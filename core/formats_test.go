@@ -0,0 +1,86 @@
+package core
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseFormats(t *testing.T) {
+	tests := []struct {
+		name   string
+		parse  func(string, io.Reader) (*YispNode, error)
+		source string
+		path   string
+		value  any
+		line   int
+	}{
+		{"toml", ParseToml, "b = 1\n[server]\nhosts = [\"a\",\n  \"b\"]\n", "server.hosts[1]", "b", 4},
+		{"toml array table", ParseToml, "[[users]]\nname = \"x\"\n[[users]]\nname = \"y\"\n", "users[1].name", "y", 4},
+		{"dotenv", ParseDotenv, "# comment\nexport A=\"x\\ny\"\nB=plain # comment\n", "B", "plain", 3},
+		{"ini", ParseIni, "top = 1\n[db]\n; comment\nport: 5432\n", "db.port", "5432", 4},
+		{"properties", ParseProperties, "a.b=1\nkey value\\\n  continued\nc=\\u00e9\n", "c", "é", 4},
+		{"csv", ParseCsv, "env,replicas\nprod,3\n\"dev, local\",1\n", "[1].env", "dev, local", 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node, err := test.parse("test", strings.NewReader(test.source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := lookupTestPath(node, test.path)
+			if !ok {
+				t.Fatalf("%s not found", test.path)
+			}
+			if got.Value != test.value {
+				t.Errorf("expected %v at %s, got %v", test.value, test.path, got.Value)
+			}
+			if got.Attr.Line() != test.line {
+				t.Errorf("expected %s on line %d, got %d", test.path, test.line, got.Attr.Line())
+			}
+		})
+	}
+}
+
+func TestParseTomlKeepsOrder(t *testing.T) {
+	node, err := ParseToml("test", strings.NewReader("zeta = 1\nalpha = 2\n[b]\n[a]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, 0)
+	for key := range node.Value.(*YispMap).AllFromFront() {
+		keys = append(keys, key)
+	}
+	if strings.Join(keys, ",") != "zeta,alpha,b,a" {
+		t.Errorf("unexpected key order: %v", keys)
+	}
+}
+
+// lookupTestPath follows a path like users[1].name, where keys may contain no dots
+func lookupTestPath(node *YispNode, path string) (*YispNode, bool) {
+	for _, part := range strings.FieldsFunc(strings.ReplaceAll(path, "[", ".["), func(r rune) bool { return r == '.' }) {
+		if strings.HasPrefix(part, "[") {
+			arr, ok := node.Value.([]any)
+			index := 0
+			for _, c := range strings.Trim(part, "[]") {
+				index = index*10 + int(c-'0')
+			}
+			if !ok || index >= len(arr) {
+				return nil, false
+			}
+			node = arr[index].(*YispNode)
+			continue
+		}
+		m, ok := node.Value.(*YispMap)
+		if !ok {
+			return nil, false
+		}
+		value, ok := m.Get(part)
+		if !ok {
+			return nil, false
+		}
+		node = value.(*YispNode)
+	}
+	return node, true
+}
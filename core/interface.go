@@ -2,6 +2,10 @@ package core
 
 import (
 	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
 )
 
 type Engine interface {
@@ -11,3 +15,76 @@ type Engine interface {
 	Render(node *YispNode) (string, error)
 	GetOption(key string) (any, bool)
 }
+
+// DependencyRecorder is implemented by engines that record what an evaluation reads, e.g. to rebuild when it changes
+type DependencyRecorder interface {
+	// RecordFile records a file that was read
+	RecordFile(path string)
+	// RecordDir records a directory that was listed, including its subdirectories if recursive
+	RecordDir(path string, recursive bool)
+	// RecordInput records something other than a local file that was read, with its content.
+	// Nil content means the input does not exist, e.g. an unset environment variable.
+	RecordInput(kind, name string, content []byte)
+	// RecordVolatile records that the result depends on something that cannot be tracked, e.g. command output
+	RecordVolatile(reason string)
+}
+
+// SchemaResolver is implemented by engines that look up schemas in a SchemaRegistry of their own
+type SchemaResolver interface {
+	SchemaRegistry() SchemaRegistry
+}
+
+// SchemaRegistryOf returns the schema registry of e, or the default registry
+func SchemaRegistryOf(e Engine) SchemaRegistry {
+	if resolver, ok := e.(SchemaResolver); ok {
+		return resolver.SchemaRegistry()
+	}
+	return DefaultSchemaRegistry()
+}
+
+// SchemaRegistrar is implemented by engines that accept schemas defined while evaluating, e.g. by CRDs of the same build
+type SchemaRegistrar interface {
+	// RegisterSchema makes schema the schema of manifests of a Kubernetes group, version and kind
+	RegisterSchema(group, version, kind string, schema *Schema)
+}
+
+// Kinds of inputs recorded with RecordInput
+const (
+	InputRemote    = "remote"
+	InputEnv       = "env"
+	InputSchemaURL = "schema-url"
+	InputSchemaGVK = "schema-gvk"
+)
+
+// RecordFile records that path was read, if e records dependencies
+func RecordFile(e Engine, path string) {
+	if recorder, ok := e.(DependencyRecorder); ok {
+		recorder.RecordFile(path)
+	}
+}
+
+// RecordGlob records the directory listed by a doublestar glob pattern relative to dir, if e records dependencies.
+// Patterns without meta characters only name files, so nothing is recorded for them.
+func RecordGlob(e Engine, dir, pattern string) {
+	if recorder, ok := e.(DependencyRecorder); ok {
+		base, rest := doublestar.SplitPattern(pattern)
+		if !strings.ContainsAny(rest, "*?[{") {
+			return
+		}
+		recorder.RecordDir(filepath.Join(dir, base), strings.Contains(rest, "**"))
+	}
+}
+
+// RecordInput records that an input other than a local file was read, if e records dependencies
+func RecordInput(e Engine, kind, name string, content []byte) {
+	if recorder, ok := e.(DependencyRecorder); ok {
+		recorder.RecordInput(kind, name, content)
+	}
+}
+
+// RecordVolatile records that the result cannot be reproduced from the recorded inputs, if e records dependencies
+func RecordVolatile(e Engine, reason string) {
+	if recorder, ok := e.(DependencyRecorder); ok {
+		recorder.RecordVolatile(reason)
+	}
+}
@@ -1,15 +1,14 @@
 package core
 
 import (
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
-	"path/filepath"
+	"math"
+	"regexp"
 	"slices"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 var schemaTypeToKind = map[string]Kind{
@@ -38,88 +37,233 @@ type Schema struct {
 	Default              any                `json:"default,omitempty"`
 
 	OneOf []*Schema `json:"oneOf,omitempty"`
+	AnyOf []*Schema `json:"anyOf,omitempty"`
+	AllOf []*Schema `json:"allOf,omitempty"`
+	Not   *Schema   `json:"not,omitempty"`
+	If    *Schema   `json:"if,omitempty"`
+	Then  *Schema   `json:"then,omitempty"`
+	Else  *Schema   `json:"else,omitempty"`
+
+	// Value constraints. Const is kept as raw JSON so that a null const can be told apart from a missing one.
+	Enum  []any           `json:"enum,omitempty"`
+	Const json.RawMessage `json:"const,omitempty"`
 
 	// Numeric constraints
-	MultipleOf       *int     `json:"multipleOf,omitempty"`
+	MultipleOf       *float64 `json:"multipleOf,omitempty"`
 	Minimum          *float64 `json:"minimum,omitempty"`
 	Maximum          *float64 `json:"maximum,omitempty"`
 	ExclusiveMinimum *float64 `json:"exclusiveMinimum,omitempty"`
 	ExclusiveMaximum *float64 `json:"exclusiveMaximum,omitempty"`
 
 	// String constraints
-	MinLength *int `json:"minLength,omitempty"`
-	MaxLength *int `json:"maxLength,omitempty"`
+	MinLength *int   `json:"minLength,omitempty"`
+	MaxLength *int   `json:"maxLength,omitempty"`
+	Pattern   string `json:"pattern,omitempty"`
+
+	// Array constraints
+	MinItems    *int `json:"minItems,omitempty"`
+	MaxItems    *int `json:"maxItems,omitempty"`
+	UniqueItems bool `json:"uniqueItems,omitempty"`
+
+	// Object constraints
+	MinProperties     *int                `json:"minProperties,omitempty"`
+	MaxProperties     *int                `json:"maxProperties,omitempty"`
+	PatternProperties map[string]*Schema  `json:"patternProperties,omitempty"`
+	DependentRequired map[string][]string `json:"dependentRequired,omitempty"`
+
+	// Nullable accepts null in addition to the type, as in OpenAPI v3
+	Nullable bool `json:"nullable,omitempty"`
+
+	// Kubernetes extensions of structural schemas, as used by CustomResourceDefinitions
+	K8sPreserveUnknownFields bool     `json:"x-kubernetes-preserve-unknown-fields,omitempty"`
+	K8sIntOrString           bool     `json:"x-kubernetes-int-or-string,omitempty"`
+	K8sEmbeddedResource      bool     `json:"x-kubernetes-embedded-resource,omitempty"`
+	K8sListType              string   `json:"x-kubernetes-list-type,omitempty"`
+	K8sListMapKeys           []string `json:"x-kubernetes-list-map-keys,omitempty"`
+	K8sMapType               string   `json:"x-kubernetes-map-type,omitempty"`
+	// K8sValidations are CEL rules. They are kept so that schemas are written back unchanged, but not checked.
+	K8sValidations json.RawMessage `json:"x-kubernetes-validations,omitempty"`
 
 	PatchStrategy    string `json:"patchStrategy,omitempty"`
 	PatchMergeKey    string `json:"patchMergeKey,omitempty"`
 	K8sPatchStrategy string `json:"x-kubernetes-patch-strategy,omitempty"`
 	K8sPatchMergeKey string `json:"x-kubernetes-patch-merge-key,omitempty"`
+
+	// registry resolves $refs. It is set by the registry the schema was loaded from.
+	registry SchemaRegistry
+	// target is the schema $ref points to, if it was resolved in advance by a CachedSchemaRegistry
+	target *Schema
 }
 
-func (s *Schema) GetProperties() map[string]*Schema {
-	if s.Properties == nil {
-		return make(map[string]*Schema)
+// UnmarshalJSON decodes a schema. A schema for additionalProperties is decoded into a *Schema,
+// so that it is not decoded again on every validation.
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	type plain Schema
+	decoded := struct {
+		*plain
+		AdditionalProperties json.RawMessage `json:"additionalProperties,omitempty"`
+	}{plain: (*plain)(s)}
+	err := json.Unmarshal(data, &decoded)
+	if err != nil {
+		return err
 	}
 
-	newProperties := make(map[string]*Schema, len(s.Properties))
-	for key, value := range s.Properties {
-		if value.Ref != "" {
-			refSchema, err := LoadSchemaFromID(value.Ref)
-			if err != nil {
-				fmt.Printf("Error loading schema from ref %s: %v\n", value.Ref, err)
-				continue
-			}
-			newProperties[key] = refSchema
-		} else {
-			newProperties[key] = value
-		}
+	s.AdditionalProperties = nil
+	if len(decoded.AdditionalProperties) == 0 || string(decoded.AdditionalProperties) == "null" {
+		return nil
 	}
-
-	return newProperties
+	var allowed bool
+	if json.Unmarshal(decoded.AdditionalProperties, &allowed) == nil {
+		s.AdditionalProperties = allowed
+		return nil
+	}
+	var additionalSchema Schema
+	err = json.Unmarshal(decoded.AdditionalProperties, &additionalSchema)
+	if err != nil {
+		return fmt.Errorf("invalid additionalProperties: %v", err)
+	}
+	s.AdditionalProperties = &additionalSchema
+	return nil
 }
 
-func (s *Schema) GetItems() *Schema {
-	if s.Items != nil && s.Items.Ref != "" {
-		refSchema, err := LoadSchemaFromID(s.Items.Ref)
+// GetProperties returns the schemas of the properties, with $refs resolved
+func (s *Schema) GetProperties() (map[string]*Schema, error) {
+	properties := make(map[string]*Schema, len(s.Properties))
+	for key, value := range s.Properties {
+		resolved, err := s.resolve(value)
 		if err != nil {
-			fmt.Printf("Error loading schema from ref %s: %v\n", s.Items.Ref, err)
-			return nil
+			return nil, fmt.Errorf("failed to resolve schema of property %s: %v", key, err)
 		}
-		return refSchema
+		properties[key] = resolved
 	}
-	return s.Items
+	return properties, nil
 }
 
-func (s *Schema) GetAdditionalProperties() any {
+// GetItems returns the schema of the items, with its $ref resolved, or nil if the items are not constrained
+func (s *Schema) GetItems() (*Schema, error) {
+	if s.Items == nil {
+		return nil, nil
+	}
+	items, err := s.resolve(s.Items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve schema of items: %v", err)
+	}
+	return items, nil
+}
+
+// GetAdditionalProperties returns whether additional properties are allowed, as a bool,
+// or the schema they must match, with its $ref resolved
+func (s *Schema) GetAdditionalProperties() (any, error) {
 
 	if s.AdditionalProperties == nil {
-		return false
+		return false, nil
 	}
 
 	switch ap := s.AdditionalProperties.(type) {
 	case bool:
-		return ap
+		return ap, nil
+	case *Schema:
+		resolved, err := s.resolve(ap)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve schema of additionalProperties: %v", err)
+		}
+		return resolved, nil
 	default:
+		// schemas built in Go may hold the schema as a map
 		jsonStr, err := json.Marshal(s.AdditionalProperties)
 		if err != nil {
-			return fmt.Sprintf("failed to marshal additionalProperties: %v", err)
+			return nil, fmt.Errorf("failed to marshal additionalProperties: %v", err)
 		}
 		var additionalSchema *Schema
 		err = json.Unmarshal(jsonStr, &additionalSchema)
 		if err != nil {
-			return fmt.Sprintf("failed to unmarshal additionalProperties: %v", err)
+			return nil, fmt.Errorf("failed to unmarshal additionalProperties: %v", err)
 		}
+		additionalSchema.SetRegistry(s.registry)
 
-		if additionalSchema.Ref != "" {
-			refSchema, err := LoadSchemaFromID(additionalSchema.Ref)
-			if err != nil {
-				fmt.Printf("Error loading schema from ref %s: %v\n", additionalSchema.Ref, err)
-			}
-			return refSchema
+		resolved, err := s.resolve(additionalSchema)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve schema of additionalProperties: %v", err)
+		}
+		return resolved, nil
+	}
+}
+
+// SetRegistry makes the schema and its subschemas resolve $refs through registry
+func (s *Schema) SetRegistry(registry SchemaRegistry) {
+	if s == nil {
+		return
+	}
+	s.registry = registry
+	for _, subSchema := range s.subSchemas() {
+		subSchema.SetRegistry(registry)
+	}
+}
+
+// subSchemas returns the schemas nested directly in s
+func (s *Schema) subSchemas() []*Schema {
+	subSchemas := make([]*Schema, 0, len(s.Properties))
+	for _, property := range s.Properties {
+		subSchemas = append(subSchemas, property)
+	}
+	for _, property := range s.PatternProperties {
+		subSchemas = append(subSchemas, property)
+	}
+	subSchemas = append(subSchemas, s.Arguments...)
+	subSchemas = append(subSchemas, s.OneOf...)
+	subSchemas = append(subSchemas, s.AnyOf...)
+	subSchemas = append(subSchemas, s.AllOf...)
+	for _, subSchema := range []*Schema{s.Items, s.Returns, s.Not, s.If, s.Then, s.Else} {
+		if subSchema != nil {
+			subSchemas = append(subSchemas, subSchema)
 		}
+	}
+	if additionalSchema, ok := s.AdditionalProperties.(*Schema); ok {
+		subSchemas = append(subSchemas, additionalSchema)
+	}
+	return subSchemas
+}
 
-		return additionalSchema
+// resolve returns the schema a subschema refers to with $ref, or the subschema itself
+func (s *Schema) resolve(subSchema *Schema) (*Schema, error) {
+	if subSchema.Ref == "" {
+		return subSchema, nil
+	}
+	if subSchema.target != nil {
+		return subSchema.target, nil
+	}
+	if s.registry == nil {
+		return nil, fmt.Errorf("cannot resolve $ref %s without a schema registry", subSchema.Ref)
+	}
+	return s.registry.SchemaByID(SchemaIDFromRef(subSchema.Ref))
+}
+
+// RefTargets returns the schemas s refers to with $ref, directly or through other referenced schemas,
+// keyed by their $ref. A $ref that cannot be resolved maps to nil.
+func (s *Schema) RefTargets() map[string]*Schema {
+	targets := make(map[string]*Schema)
+	var walk func(schema *Schema)
+	walk = func(schema *Schema) {
+		if schema.Ref != "" {
+			if _, seen := targets[schema.Ref]; !seen {
+				target, err := schema.resolve(schema)
+				if err != nil {
+					target = nil
+				}
+				targets[schema.Ref] = target
+				if target != nil {
+					walk(target)
+				}
+			}
+		}
+		for _, subSchema := range schema.subSchemas() {
+			walk(subSchema)
+		}
 	}
+	if s != nil {
+		walk(s)
+	}
+	return targets
 }
 
 func (s *Schema) GetPatchStrategy() string {
@@ -129,6 +273,9 @@ func (s *Schema) GetPatchStrategy() string {
 	if s.K8sPatchStrategy != "" {
 		return s.K8sPatchStrategy
 	}
+	if s.K8sListType == "map" && len(s.K8sListMapKeys) == 1 {
+		return "merge"
+	}
 	return ""
 }
 
@@ -139,6 +286,9 @@ func (s *Schema) GetPatchMergeKey() string {
 	if s.K8sPatchMergeKey != "" {
 		return s.K8sPatchMergeKey
 	}
+	if s.K8sListType == "map" && len(s.K8sListMapKeys) == 1 {
+		return s.K8sListMapKeys[0]
+	}
 	return ""
 }
 
@@ -157,132 +307,150 @@ func (s *Schema) ToYispNode() (*YispNode, error) {
 	return ParseAny("", anyValue)
 }
 
-func LoadSchemaFromURL(url string) (*Schema, error) {
-
-	cachekey := base64.StdEncoding.EncodeToString([]byte(url))
-	home, err := os.UserHomeDir()
+// Validate checks a node against the schema.
+// Like in JSON Schema, keywords only apply to nodes of their kind, e.g. minItems to arrays,
+// and a schema without a type accepts every kind of node.
+// Once the node is valid, integers in int-or-string strings are converted to strings.
+func (s *Schema) Validate(node *YispNode) error {
+	err := s.validate(node)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	schemasPath := filepath.Join(home, ".cache", "yisp", "schemas", cachekey+".json")
-	file, err := os.Open(schemasPath)
-	if err == nil {
-		defer file.Close()
-		var schema Schema
-		decoder := json.NewDecoder(file)
-		err = decoder.Decode(&schema)
-		if err != nil {
-			return nil, err
-		}
-		return &schema, nil
-	} else {
-		resp, err := http.Get(url)
-		if err != nil {
-			return nil, err
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("failed to fetch schema from URL: %s", resp.Status)
-		}
-
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
-		}
+	s.coerce(node)
+	return nil
+}
 
-		var schema Schema
-		err = json.Unmarshal(body, &schema)
-		if err != nil {
-			return nil, err
-		}
+// validate checks a node against the schema without changing it,
+// so subschemas can be tried, e.g. by anyOf or if, without side effects
+func (s *Schema) validate(node *YispNode) error {
 
-		err = os.MkdirAll(filepath.Dir(schemasPath), os.ModePerm)
-		if err != nil {
-			return nil, err
-		}
+	if s.Nullable && node.Kind == KindNull {
+		return nil
+	}
 
-		file, err := os.Create(schemasPath)
+	// a $ref in a subschema, e.g. in the allOf wrappers of OpenAPI v3, applies the referenced schema
+	// in addition to the keywords next to it
+	if s.Ref != "" {
+		target, err := s.resolve(s)
 		if err != nil {
-			return nil, err
+			return NewEvaluationError(node, err.Error())
 		}
-		defer file.Close()
-
-		encoder := json.NewEncoder(file)
-		err = encoder.Encode(&schema)
+		err = target.validate(node)
 		if err != nil {
-			return nil, err
+			return err
 		}
-
-		return &schema, nil
-	}
-}
-
-func LoadSchemaFromID(id string) (*Schema, error) {
-
-	if strings.HasPrefix(id, "#") {
-		split := strings.Split(id, "/")
-		id = split[len(split)-1]
 	}
 
-	home, err := os.UserHomeDir()
+	err := s.validateApplicators(node)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	schemasPath := filepath.Join(home, ".cache", "yisp", "schemas", id+".json")
-	file, err := os.Open(schemasPath)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
 
-	var schema Schema
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&schema)
+	err = s.validateType(node)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return &schema, nil
-}
 
-func LoadSchemaFromGVK(group, version, kind string) (*Schema, error) {
-
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return nil, err
+	// the rest of the keywords see an int-or-string integer as the string it becomes
+	if s.intOrString(node) {
+		node = &YispNode{Kind: KindString, Value: strconv.Itoa(node.Value.(int)), Attr: node.Attr}
 	}
 
-	gvkPath := filepath.Join(home, ".cache", "yisp", "gvk", fmt.Sprintf("%s_%s_%s.txt", group, version, kind))
-	file, err := os.Open(gvkPath)
+	err = s.validateValue(node)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer file.Close()
 
-	id, err := io.ReadAll(file)
-	if err != nil {
-		return nil, err
+	switch node.Kind {
+	case KindInt, KindFloat:
+		return s.validateNumber(node)
+	case KindString:
+		return s.validateString(node)
+	case KindArray:
+		return s.validateArray(node)
+	case KindMap:
+		return s.validateObject(node)
 	}
 
-	return LoadSchemaFromID(string(id))
+	return nil
 }
 
-func (s *Schema) Validate(node *YispNode) error {
+// validateApplicators checks the keywords that combine subschemas: oneOf, anyOf, allOf, not and if/then/else
+func (s *Schema) validateApplicators(node *YispNode) error {
 
 	if s.OneOf != nil {
 		var errors []string
+		matched := false
 		for _, subSchema := range s.OneOf {
-			err := subSchema.Validate(node)
+			err := subSchema.validate(node)
 			if err == nil {
-				return nil // Valid against one of the schemas
+				matched = true // Valid against one of the schemas
+				break
 			}
 			errors = append(errors, err.Error())
 		}
-		return NewEvaluationError(node, fmt.Sprintf("node does not match any of the oneOf schemas: %s", strings.Join(errors, ", ")))
+		if !matched {
+			return NewEvaluationError(node, fmt.Sprintf("node does not match any of the oneOf schemas: %s", strings.Join(errors, ", ")))
+		}
+	}
+
+	if s.AnyOf != nil {
+		var errors []string
+		matched := false
+		for _, subSchema := range s.AnyOf {
+			err := subSchema.validate(node)
+			if err == nil {
+				matched = true
+				break
+			}
+			errors = append(errors, err.Error())
+		}
+		if !matched {
+			return NewEvaluationError(node, fmt.Sprintf("node does not match any of the anyOf schemas: %s", strings.Join(errors, ", ")))
+		}
+	}
+
+	for i, subSchema := range s.AllOf {
+		err := subSchema.validate(node)
+		if err != nil {
+			return NewEvaluationError(node, fmt.Sprintf("node does not match allOf schema %d: %v", i, err))
+		}
+	}
+
+	if s.Not != nil && s.Not.validate(node) == nil {
+		return NewEvaluationError(node, "node matches the schema it must not match")
+	}
+
+	if s.If != nil {
+		if s.If.validate(node) == nil {
+			if s.Then != nil {
+				err := s.Then.validate(node)
+				if err != nil {
+					return NewEvaluationError(node, fmt.Sprintf("node matches the if schema but not the then schema: %v", err))
+				}
+			}
+		} else if s.Else != nil {
+			err := s.Else.validate(node)
+			if err != nil {
+				return NewEvaluationError(node, fmt.Sprintf("node does not match the if schema nor the else schema: %v", err))
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateType checks the type keyword. A string with the int-or-string format accepts ints and converts them.
+func (s *Schema) validateType(node *YispNode) error {
+	if s.K8sIntOrString {
+		if node.Kind != KindInt && node.Kind != KindString {
+			return NewEvaluationError(node, fmt.Sprintf("expected string or int, got %s", node.Kind))
+		}
+		return nil
 	}
 
 	switch s.Type {
-	case "any":
+	case "", "any":
 		return nil
 	case "null":
 		if node.Kind != KindNull {
@@ -296,191 +464,508 @@ func (s *Schema) Validate(node *YispNode) error {
 		if node.Kind != KindInt {
 			return NewEvaluationError(node, fmt.Sprintf("expected int, got %s", node.Kind))
 		}
-		if s.Minimum != nil && node.Value.(int) < int(*s.Minimum) {
-			return NewEvaluationError(node, fmt.Sprintf("value %d is less than minimum %f", node.Value.(int), *s.Minimum))
-		}
-		if s.Maximum != nil && node.Value.(int) > int(*s.Maximum) {
-			return NewEvaluationError(node, fmt.Sprintf("value %d is greater than maximum %f", node.Value.(int), *s.Maximum))
-		}
-		if s.ExclusiveMinimum != nil && node.Value.(int) <= int(*s.ExclusiveMinimum) {
-			return NewEvaluationError(node, fmt.Sprintf("value %d is not greater than exclusive minimum %f", node.Value.(int), *s.ExclusiveMinimum))
+	case "float":
+		if node.Kind != KindFloat {
+			return NewEvaluationError(node, fmt.Sprintf("expected float, got %s", node.Kind))
 		}
-		if s.ExclusiveMaximum != nil && node.Value.(int) >= int(*s.ExclusiveMaximum) {
-			return NewEvaluationError(node, fmt.Sprintf("value %d is not less than exclusive maximum %f", node.Value.(int), *s.ExclusiveMaximum))
+	case "number":
+		if node.Kind != KindInt && node.Kind != KindFloat {
+			return NewEvaluationError(node, fmt.Sprintf("expected number, got %s", node.Kind))
 		}
-		if s.MultipleOf != nil {
-			if node.Value.(int)%*s.MultipleOf != 0 {
-				return NewEvaluationError(node, fmt.Sprintf("value %d is not a multiple of %d", node.Value.(int), *s.MultipleOf))
+	case "string":
+		if node.Kind != KindString {
+			if s.Format != "int-or-string" {
+				return NewEvaluationError(node, fmt.Sprintf("expected string, got %s", node.Kind))
+			}
+			if node.Kind != KindInt {
+				return NewEvaluationError(node, fmt.Sprintf("expected string or int, got %s", node.Kind))
 			}
 		}
-	case "float":
-		if node.Kind != KindFloat {
-			return NewEvaluationError(node, fmt.Sprintf("expected float, got %s", node.Kind))
+	case "array":
+		if node.Kind != KindArray {
+			return NewEvaluationError(node, fmt.Sprintf("expected array, got %s", node.Kind))
 		}
-		if s.Minimum != nil && node.Value.(float64) < *s.Minimum {
-			return NewEvaluationError(node, fmt.Sprintf("value %f is less than minimum %f", node.Value.(float64), *s.Minimum))
+	case "object":
+		if node.Kind != KindMap {
+			return NewEvaluationError(node, fmt.Sprintf("expected map, got %s", node.Kind))
 		}
-		if s.Maximum != nil && node.Value.(float64) > *s.Maximum {
-			return NewEvaluationError(node, fmt.Sprintf("value %f is greater than maximum %f", node.Value.(float64), *s.Maximum))
+	case "function":
+		if node.Kind != KindLambda {
+			return NewEvaluationError(node, fmt.Sprintf("expected function, got %s", node.Kind))
 		}
-		if s.ExclusiveMinimum != nil && node.Value.(float64) <= *s.ExclusiveMinimum {
-			return NewEvaluationError(node, fmt.Sprintf("value %f is not greater than exclusive minimum %f", node.Value.(float64), *s.ExclusiveMinimum))
+		fn, ok := node.Value.(*Lambda)
+		if !ok {
+			return NewEvaluationError(node, fmt.Sprintf("expected YispLambda, got %T", node.Value))
 		}
-		if s.ExclusiveMaximum != nil && node.Value.(float64) >= *s.ExclusiveMaximum {
-			return NewEvaluationError(node, fmt.Sprintf("value %f is not less than exclusive maximum %f", node.Value.(float64), *s.ExclusiveMaximum))
+		if len(fn.Arguments) != len(s.Arguments) {
+			return NewEvaluationError(node, fmt.Sprintf("expected %d arguments, got %d", len(s.Arguments), len(fn.Arguments)))
 		}
-		if s.MultipleOf != nil {
-			if int(node.Value.(float64))%*s.MultipleOf != 0 {
-				return NewEvaluationError(node, fmt.Sprintf("value %f is not a multiple of %d", node.Value.(float64), *s.MultipleOf))
+		for i, arg := range s.Arguments {
+			if fn.Arguments[i].Schema != nil && !arg.Equals(fn.Arguments[i].Schema) {
+				return NewEvaluationError(node, fmt.Sprintf("argument %d does not match schema", i))
 			}
+
 		}
-	case "string":
-		if node.Kind != KindString {
-			if s.Format == "int-or-string" {
-				if node.Kind != KindInt {
-					return NewEvaluationError(node, fmt.Sprintf("expected string or int, got %s", node.Kind))
-				}
-				node.Kind = KindString
-				node.Value = fmt.Sprintf("%d", node.Value.(int))
-			} else {
-				return NewEvaluationError(node, fmt.Sprintf("expected string, got %s", node.Kind))
+		if s.Returns != nil && fn.Returns != nil {
+			if !s.Returns.Equals(fn.Returns) {
+				return NewEvaluationError(node, fmt.Sprintf("return type does not match schema. Expected %s, got %s", s.Returns.Type, fn.Returns.Type))
 			}
 		}
-		if s.MinLength != nil && len(node.Value.(string)) < *s.MinLength {
-			return NewEvaluationError(node, fmt.Sprintf("string length %d is less than minimum %d", len(node.Value.(string)), *s.MinLength))
+	default:
+		return NewEvaluationError(node, fmt.Sprintf("unknown type: %s", s.Type))
+	}
+	return nil
+}
+
+// intOrString reports whether node is an integer that the schema accepts as a string
+func (s *Schema) intOrString(node *YispNode) bool {
+	return s.Type == "string" && s.Format == "int-or-string" && node.Kind == KindInt
+}
+
+// coerce converts the integers of int-or-string strings in a valid node to strings.
+// Like InterpolateDefaults, it only follows the subschemas that apply to the node:
+// the branch of if/then/else its condition picks, and the first anyOf or oneOf schema it matches.
+func (s *Schema) coerce(node *YispNode) {
+	if s.Nullable && node.Kind == KindNull {
+		return
+	}
+	if s.Ref != "" {
+		if target, err := s.resolve(s); err == nil {
+			target.coerce(node)
 		}
-		if s.MaxLength != nil && len(node.Value.(string)) > *s.MaxLength {
-			return NewEvaluationError(node, fmt.Sprintf("string length %d is greater than maximum %d", len(node.Value.(string)), *s.MaxLength))
+	}
+
+	for _, subSchema := range s.AllOf {
+		subSchema.coerce(node)
+	}
+	if s.If != nil {
+		branch := s.Else
+		if s.If.validate(node) == nil {
+			branch = s.Then
 		}
-	case "array":
-		if node.Kind != KindArray {
-			return NewEvaluationError(node, fmt.Sprintf("expected array, got %s", node.Kind))
+		if branch != nil {
+			branch.coerce(node)
 		}
-		if s.Items != nil {
-			subSchema := s.GetItems()
-			arr, ok := node.Value.([]any)
-			if !ok {
-				return NewEvaluationError(node, fmt.Sprintf("expected array, got %T", node.Value))
+	}
+	for _, alternatives := range [][]*Schema{s.AnyOf, s.OneOf} {
+		for _, subSchema := range alternatives {
+			if subSchema.validate(node) == nil {
+				subSchema.coerce(node)
+				break
 			}
+		}
+	}
 
-			for _, item := range arr {
-				itemNode, ok := item.(*YispNode)
-				if !ok {
-					return NewEvaluationError(node, fmt.Sprintf("expected YispNode, got %T", item))
-				}
-				if err := subSchema.Validate(itemNode); err != nil {
-					return err
-				}
-			}
+	if s.intOrString(node) {
+		node.Kind = KindString
+		node.Value = strconv.Itoa(node.Value.(int))
+		return
+	}
+
+	switch node.Kind {
+	case KindArray:
+		items, err := s.GetItems()
+		if err != nil || items == nil {
+			return
 		}
-	case "object":
-		if node.Kind != KindMap {
-			return NewEvaluationError(node, fmt.Sprintf("expected map, got %s", node.Kind))
+		arr, _ := node.Value.([]any)
+		for _, item := range arr {
+			if itemNode, ok := item.(*YispNode); ok {
+				items.coerce(itemNode)
+			}
 		}
+	case KindMap:
 		m, ok := node.Value.(*YispMap)
 		if !ok {
-			return NewEvaluationError(node, fmt.Sprintf("expected map, got %T", node.Value))
+			return
 		}
-
-		processed := make(map[string]bool)
-		for key, subSchema := range s.GetProperties() {
-			item, ok := m.Get(key)
+		properties, err := s.GetProperties()
+		if err != nil {
+			return
+		}
+		additionalProperties, _ := s.GetAdditionalProperties()
+		for key, item := range m.AllFromFront() {
+			itemNode, ok := item.(*YispNode)
 			if !ok {
-				if slices.Contains(s.Required, key) {
-					return NewEvaluationError(node, fmt.Sprintf("missing required property: %s", key))
-				} else {
-					continue
+				continue
+			}
+			matched := false
+			if subSchema, ok := properties[key]; ok {
+				subSchema.coerce(itemNode)
+				matched = true
+			}
+			for expr, subSchema := range s.PatternProperties {
+				if pattern, err := compilePattern(expr); err == nil && pattern.MatchString(key) {
+					subSchema.coerce(itemNode)
+					matched = true
 				}
 			}
+			if ap, ok := additionalProperties.(*Schema); ok && !matched {
+				ap.coerce(itemNode)
+			}
+		}
+	}
+}
+
+// validateValue checks enum and const
+func (s *Schema) validateValue(node *YispNode) error {
+	if s.Enum == nil && s.Const == nil {
+		return nil
+	}
+
+	value, err := node.ToNative()
+	if err != nil {
+		return NewEvaluationError(node, fmt.Sprintf("failed to compare value: %v", err))
+	}
+
+	if s.Enum != nil && !slices.ContainsFunc(s.Enum, func(allowed any) bool { return jsonEqual(value, allowed) }) {
+		return NewEvaluationError(node, fmt.Sprintf("value %v is not one of %v", describeValue(value), describeValue(s.Enum)))
+	}
+
+	if s.Const != nil {
+		var constant any
+		err := json.Unmarshal(s.Const, &constant)
+		if err != nil {
+			return NewEvaluationError(node, fmt.Sprintf("invalid const: %v", err))
+		}
+		if !jsonEqual(value, constant) {
+			return NewEvaluationError(node, fmt.Sprintf("value %v is not %v", describeValue(value), describeValue(constant)))
+		}
+	}
+
+	return nil
+}
+
+func (s *Schema) validateNumber(node *YispNode) error {
+	if node.Kind == KindInt {
+		value := node.Value.(int)
+		if s.Minimum != nil && float64(value) < *s.Minimum {
+			return NewEvaluationError(node, fmt.Sprintf("value %d is less than minimum %f", value, *s.Minimum))
+		}
+		if s.Maximum != nil && float64(value) > *s.Maximum {
+			return NewEvaluationError(node, fmt.Sprintf("value %d is greater than maximum %f", value, *s.Maximum))
+		}
+		if s.ExclusiveMinimum != nil && float64(value) <= *s.ExclusiveMinimum {
+			return NewEvaluationError(node, fmt.Sprintf("value %d is not greater than exclusive minimum %f", value, *s.ExclusiveMinimum))
+		}
+		if s.ExclusiveMaximum != nil && float64(value) >= *s.ExclusiveMaximum {
+			return NewEvaluationError(node, fmt.Sprintf("value %d is not less than exclusive maximum %f", value, *s.ExclusiveMaximum))
+		}
+		if s.MultipleOf != nil && !isMultipleOf(float64(value), *s.MultipleOf) {
+			return NewEvaluationError(node, fmt.Sprintf("value %d is not a multiple of %v", value, *s.MultipleOf))
+		}
+		return nil
+	}
+
+	value := node.Value.(float64)
+	if s.Minimum != nil && value < *s.Minimum {
+		return NewEvaluationError(node, fmt.Sprintf("value %f is less than minimum %f", value, *s.Minimum))
+	}
+	if s.Maximum != nil && value > *s.Maximum {
+		return NewEvaluationError(node, fmt.Sprintf("value %f is greater than maximum %f", value, *s.Maximum))
+	}
+	if s.ExclusiveMinimum != nil && value <= *s.ExclusiveMinimum {
+		return NewEvaluationError(node, fmt.Sprintf("value %f is not greater than exclusive minimum %f", value, *s.ExclusiveMinimum))
+	}
+	if s.ExclusiveMaximum != nil && value >= *s.ExclusiveMaximum {
+		return NewEvaluationError(node, fmt.Sprintf("value %f is not less than exclusive maximum %f", value, *s.ExclusiveMaximum))
+	}
+	if s.MultipleOf != nil && !isMultipleOf(value, *s.MultipleOf) {
+		return NewEvaluationError(node, fmt.Sprintf("value %v is not a multiple of %v", value, *s.MultipleOf))
+	}
+	return nil
+}
+
+// isMultipleOf reports whether value is a multiple of divisor. A divisor of 0 constrains nothing.
+func isMultipleOf(value, divisor float64) bool {
+	if divisor == 0 {
+		return true
+	}
+	quotient := value / divisor
+	if math.IsInf(quotient, 0) || math.IsNaN(quotient) {
+		return false
+	}
+	// decimal fractions are not exact in binary, e.g. 0.0075 / 0.0001 is 74.99999999999999
+	return math.Abs(quotient-math.Round(quotient)) < 1e-9*math.Max(1, math.Abs(quotient))
+}
+
+func (s *Schema) validateString(node *YispNode) error {
+	value := node.Value.(string)
+	if s.MinLength != nil && len(value) < *s.MinLength {
+		return NewEvaluationError(node, fmt.Sprintf("string length %d is less than minimum %d", len(value), *s.MinLength))
+	}
+	if s.MaxLength != nil && len(value) > *s.MaxLength {
+		return NewEvaluationError(node, fmt.Sprintf("string length %d is greater than maximum %d", len(value), *s.MaxLength))
+	}
+	if s.Pattern != "" {
+		pattern, err := compilePattern(s.Pattern)
+		if err != nil {
+			return NewEvaluationError(node, err.Error())
+		}
+		if !pattern.MatchString(value) {
+			return NewEvaluationError(node, fmt.Sprintf("string %q does not match pattern %s", value, s.Pattern))
+		}
+	}
+	if s.Format != "" {
+		if err := ValidateFormat(s.Format, value); err != nil {
+			return NewEvaluationError(node, err.Error())
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateArray(node *YispNode) error {
+	arr, ok := node.Value.([]any)
+	if !ok {
+		return NewEvaluationError(node, fmt.Sprintf("expected array, got %T", node.Value))
+	}
+
+	if s.MinItems != nil && len(arr) < *s.MinItems {
+		return NewEvaluationError(node, fmt.Sprintf("array has %d items, less than minimum %d", len(arr), *s.MinItems))
+	}
+	if s.MaxItems != nil && len(arr) > *s.MaxItems {
+		return NewEvaluationError(node, fmt.Sprintf("array has %d items, more than maximum %d", len(arr), *s.MaxItems))
+	}
+
+	if s.Items != nil {
+		subSchema, err := s.GetItems()
+		if err != nil {
+			return NewEvaluationError(node, err.Error())
+		}
+		for _, item := range arr {
 			itemNode, ok := item.(*YispNode)
 			if !ok {
-				return NewEvaluationError(node, fmt.Sprintf("[object]expected YispNode, got %T", item))
+				return NewEvaluationError(node, fmt.Sprintf("expected YispNode, got %T", item))
 			}
-
-			if err := subSchema.Validate(itemNode); err != nil {
+			if err := subSchema.validate(itemNode); err != nil {
 				return err
 			}
-			processed[key] = true
 		}
+	}
 
-		left := NewYispMap()
-		for key, item := range m.AllFromFront() {
-			if _, ok := processed[key]; !ok {
-				if key != "$schema" {
-					left.Set(key, item)
+	if s.UniqueItems || s.K8sListType == "set" {
+		if err := checkUnique(node, arr, nil); err != nil {
+			return err
+		}
+	}
+	if s.K8sListType == "map" && len(s.K8sListMapKeys) > 0 {
+		if err := checkUnique(node, arr, s.K8sListMapKeys); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkUnique reports the first two equal items of an array, or of maps in it with the same values for keys
+func checkUnique(node *YispNode, arr []any, keys []string) error {
+	values := make([]any, 0, len(arr))
+	for i, item := range arr {
+		itemNode, ok := item.(*YispNode)
+		if !ok {
+			return NewEvaluationError(node, fmt.Sprintf("expected YispNode, got %T", item))
+		}
+		value, err := itemNode.ToNative()
+		if err != nil {
+			return NewEvaluationError(itemNode, fmt.Sprintf("failed to compare value: %v", err))
+		}
+		if keys != nil {
+			m, ok := value.(map[string]any)
+			if !ok {
+				continue
+			}
+			keyValues := make([]any, len(keys))
+			for k, key := range keys {
+				keyValues[k] = m[key]
+			}
+			value = keyValues
+		}
+		for j, other := range values {
+			if jsonEqual(value, other) {
+				if keys != nil {
+					return NewEvaluationError(itemNode, fmt.Sprintf("items %d and %d have the same %s, but it must be unique", j, i, strings.Join(keys, ", ")))
 				}
+				return NewEvaluationError(itemNode, fmt.Sprintf("items %d and %d are equal, but items must be unique", j, i))
 			}
 		}
+		values = append(values, value)
+	}
+	return nil
+}
 
-		if left.Len() != 0 {
-			additionalProperties := s.GetAdditionalProperties()
+func (s *Schema) validateObject(node *YispNode) error {
+	m, ok := node.Value.(*YispMap)
+	if !ok {
+		return NewEvaluationError(node, fmt.Sprintf("expected map, got %T", node.Value))
+	}
 
-			switch ap := additionalProperties.(type) {
-			case bool:
-				if !ap {
-					keys := ""
-					for key := range left.AllFromFront() {
-						if keys != "" {
-							keys += ", "
-						}
-						keys += key
-					}
-					return NewEvaluationError(node, fmt.Sprintf("unexpected properties: %v", keys))
-				}
-			case *Schema:
-				for key, item := range left.AllFromFront() {
-					itemNode, ok := item.(*YispNode)
-					if !ok {
-						return NewEvaluationError(node, fmt.Sprintf("expected YispNode, got %T", item))
-					}
-					if err := ap.Validate(itemNode); err != nil {
-						return NewEvaluationError(node, fmt.Sprintf("additional property %s does not match schema: %v", key, err))
-					}
-				}
-			default:
-				return NewEvaluationError(node, fmt.Sprintf("unexpected additionalProperties type: %T", ap))
+	for _, key := range s.Required {
+		if _, ok := m.Get(key); !ok {
+			return NewEvaluationError(node, fmt.Sprintf("missing required property: %s", key))
+		}
+	}
+
+	if s.MinProperties != nil && m.Len() < *s.MinProperties {
+		return NewEvaluationError(node, fmt.Sprintf("map has %d properties, less than minimum %d", m.Len(), *s.MinProperties))
+	}
+	if s.MaxProperties != nil && m.Len() > *s.MaxProperties {
+		return NewEvaluationError(node, fmt.Sprintf("map has %d properties, more than maximum %d", m.Len(), *s.MaxProperties))
+	}
+
+	for key := range m.AllFromFront() {
+		for _, dependency := range s.DependentRequired[key] {
+			if _, ok := m.Get(dependency); !ok {
+				return NewEvaluationError(node, fmt.Sprintf("property %s requires property %s", key, dependency))
 			}
 		}
+	}
 
-	case "function":
-		if node.Kind != KindLambda {
-			return NewEvaluationError(node, fmt.Sprintf("expected function, got %s", node.Kind))
+	properties, err := s.GetProperties()
+	if err != nil {
+		return NewEvaluationError(node, err.Error())
+	}
+
+	processed := make(map[string]bool)
+	for key, subSchema := range properties {
+		item, ok := m.Get(key)
+		if !ok {
+			continue
 		}
-		fn, ok := node.Value.(*Lambda)
+		itemNode, ok := item.(*YispNode)
 		if !ok {
-			return NewEvaluationError(node, fmt.Sprintf("expected YispLambda, got %T", node.Value))
+			return NewEvaluationError(node, fmt.Sprintf("[object]expected YispNode, got %T", item))
 		}
-		if len(fn.Arguments) != len(s.Arguments) {
-			return NewEvaluationError(node, fmt.Sprintf("expected %d arguments, got %d", len(s.Arguments), len(fn.Arguments)))
+
+		if err := subSchema.validate(itemNode); err != nil {
+			return err
 		}
-		for i, arg := range s.Arguments {
-			if fn.Arguments[i].Schema != nil && !arg.Equals(fn.Arguments[i].Schema) {
-				return NewEvaluationError(node, fmt.Sprintf("argument %d does not match schema", i))
-			}
+		processed[key] = true
+	}
 
+	for expr, subSchema := range s.PatternProperties {
+		pattern, err := compilePattern(expr)
+		if err != nil {
+			return NewEvaluationError(node, err.Error())
 		}
-		if s.Returns != nil && fn.Returns != nil {
-			if !s.Returns.Equals(fn.Returns) {
-				return NewEvaluationError(node, fmt.Sprintf("return type does not match schema. Expected %s, got %s", s.Returns.Type, fn.Returns.Type))
+		for key, item := range m.AllFromFront() {
+			if !pattern.MatchString(key) {
+				continue
 			}
+			itemNode, ok := item.(*YispNode)
+			if !ok {
+				return NewEvaluationError(node, fmt.Sprintf("expected YispNode, got %T", item))
+			}
+			if err := subSchema.validate(itemNode); err != nil {
+				return err
+			}
+			processed[key] = true
 		}
+	}
 
+	left := NewYispMap()
+	for key, item := range m.AllFromFront() {
+		if _, ok := processed[key]; !ok {
+			if key == "$schema" {
+				continue
+			}
+			// embedded resources may carry the type and object metadata of a manifest without declaring them
+			if s.K8sEmbeddedResource && (key == "apiVersion" || key == "kind" || key == "metadata") {
+				continue
+			}
+			left.Set(key, item)
+		}
+	}
+
+	// yisp rejects unknown properties of objects unless additionalProperties allows them,
+	// but a schema without a type only constrains the properties it names, like in JSON Schema
+	if left.Len() == 0 || s.K8sPreserveUnknownFields || s.AdditionalProperties == nil && s.Type != "object" {
+		return nil
+	}
+
+	additionalProperties, err := s.GetAdditionalProperties()
+	if err != nil {
+		return NewEvaluationError(node, err.Error())
+	}
+
+	switch ap := additionalProperties.(type) {
+	case bool:
+		if !ap {
+			keys := ""
+			for key := range left.AllFromFront() {
+				if keys != "" {
+					keys += ", "
+				}
+				keys += key
+			}
+			return NewEvaluationError(node, fmt.Sprintf("unexpected properties: %v", keys))
+		}
+	case *Schema:
+		for key, item := range left.AllFromFront() {
+			itemNode, ok := item.(*YispNode)
+			if !ok {
+				return NewEvaluationError(node, fmt.Sprintf("expected YispNode, got %T", item))
+			}
+			if err := ap.validate(itemNode); err != nil {
+				return NewEvaluationError(node, fmt.Sprintf("additional property %s does not match schema: %v", key, err))
+			}
+		}
 	default:
-		JsonPrint("schema", s)
-		return NewEvaluationError(node, fmt.Sprintf("unknown type: %s", s.Type))
+		return NewEvaluationError(node, fmt.Sprintf("unexpected additionalProperties type: %T", ap))
 	}
 
 	return nil
 }
 
+// InterpolateDefaults fills in the defaults of missing properties.
+// Defaults of allOf schemas always apply, those of if/then/else follow the condition,
+// and those of anyOf and oneOf come from the first schema the node matches.
 func (s *Schema) InterpolateDefaults(node *YispNode) error {
-	switch s.Type {
+	for _, subSchema := range s.AllOf {
+		if err := subSchema.InterpolateDefaults(node); err != nil {
+			return err
+		}
+	}
+
+	if s.If != nil {
+		branch := s.Else
+		if s.If.validate(node) == nil {
+			branch = s.Then
+		}
+		if branch != nil {
+			if err := branch.InterpolateDefaults(node); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, alternatives := range [][]*Schema{s.AnyOf, s.OneOf} {
+		for _, subSchema := range alternatives {
+			if subSchema.validate(node) == nil {
+				if err := subSchema.InterpolateDefaults(node); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+
+	typ := s.Type
+	if typ == "" {
+		switch node.Kind {
+		case KindArray:
+			typ = "array"
+		case KindMap:
+			typ = "object"
+		}
+	}
+
+	switch typ {
 	case "array":
 		if node.Kind != KindArray {
 			return NewEvaluationError(node, fmt.Sprintf("expected array, got %s", node.Kind))
 		}
-		if s.Items == nil {
-			return nil // No items schema to interpolate defaults for
+		if s.Items == nil || node.Value == nil {
+			return nil // No items to interpolate defaults for
 		}
 		arr, ok := node.Value.([]any)
 		if !ok {
@@ -514,13 +999,12 @@ func (s *Schema) InterpolateDefaults(node *YispNode) error {
 					return NewEvaluationError(node, fmt.Sprintf("missing required property: %s", key))
 				}
 				if subSchema.Default != nil {
-					defaultNode := &YispNode{
-						Kind:  schemaTypeToKind[subSchema.Type],
-						Value: subSchema.Default,
-						Tag:   node.Tag,
-						Attr:  node.Attr,
-						Type:  subSchema,
+					defaultNode, err := subSchema.defaultNode()
+					if err != nil {
+						return NewEvaluationError(node, fmt.Sprintf("invalid default for property %s: %v", key, err))
 					}
+					defaultNode.Tag = node.Tag
+					defaultNode.Attr = node.Attr
 					m.Set(key, defaultNode)
 					continue
 				}
@@ -550,6 +1034,21 @@ func (s *Schema) InterpolateDefaults(node *YispNode) error {
 	}
 }
 
+// defaultNode converts the default value to a node. Defaults are decoded from JSON,
+// so whole numbers of integer schemas are turned back into ints.
+func (s *Schema) defaultNode() (*YispNode, error) {
+	value := s.Default
+	if f, ok := value.(float64); ok && s.Type == "integer" && f == math.Trunc(f) {
+		value = int(f)
+	}
+	node, err := ParseAny("", value)
+	if err != nil {
+		return nil, err
+	}
+	node.Type = s
+	return node, nil
+}
+
 func (s *Schema) Cast(node *YispNode) (*YispNode, error) {
 	err := s.InterpolateDefaults(node)
 	if err != nil {
@@ -619,3 +1118,82 @@ func (s *Schema) Equals(other *Schema) bool {
 		return false
 	}
 }
+
+var patternCache sync.Map
+
+// compilePattern compiles a pattern or patternProperties regular expression, caching the result
+func compilePattern(expr string) (*regexp.Regexp, error) {
+	if cached, ok := patternCache.Load(expr); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %s: %v", expr, err)
+	}
+	patternCache.Store(expr, pattern)
+	return pattern, nil
+}
+
+// jsonEqual compares native values like JSON Schema does: numbers by value regardless of int or float
+func jsonEqual(a, b any) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+
+	switch x := a.(type) {
+	case nil:
+		return b == nil
+	case bool, string:
+		return a == b
+	case []any:
+		y, ok := b.([]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !jsonEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		y, ok := b.(map[string]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, value := range x {
+			other, ok := y[key]
+			if !ok || !jsonEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+// describeValue formats a native value as JSON for error messages
+func describeValue(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
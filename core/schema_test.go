@@ -0,0 +1,202 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type conformanceGroup struct {
+	Description string          `json:"description"`
+	Schema      json.RawMessage `json:"schema"`
+	Tests       []struct {
+		Description string          `json:"description"`
+		Data        json.RawMessage `json:"data"`
+		Valid       bool            `json:"valid"`
+	} `json:"tests"`
+}
+
+func TestJSONSchemaConformance(t *testing.T) {
+	files, err := filepath.Glob("testdata/jsonschema/*.json")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no conformance files found: %v", err)
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var groups []conformanceGroup
+		err = json.Unmarshal(data, &groups)
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+
+		for _, group := range groups {
+			name := strings.TrimSuffix(filepath.Base(file), ".json") + "/" + group.Description
+			t.Run(name, func(t *testing.T) {
+				schema, err := conformanceSchema(group.Schema)
+				if err != nil {
+					t.Fatalf("invalid schema: %v", err)
+				}
+
+				for _, test := range group.Tests {
+					node, err := parseConformanceData(test.Data)
+					if err != nil {
+						t.Fatalf("%s: invalid data: %v", test.Description, err)
+					}
+					err = schema.Validate(node)
+					if test.Valid && err != nil {
+						t.Errorf("%s: expected valid, got %v", test.Description, err)
+					}
+					if !test.Valid && err == nil {
+						t.Errorf("%s: expected invalid", test.Description)
+					}
+				}
+			})
+		}
+	}
+}
+
+// conformanceSchema decodes the schema of a group. Its $defs are put in a registry,
+// which resolves a $ref like #/$defs/name by the last segment, like the definitions of OpenAPI documents.
+func conformanceSchema(data []byte) (*Schema, error) {
+	var schema Schema
+	err := json.Unmarshal(data, &schema)
+	if err != nil {
+		return nil, err
+	}
+
+	var defs struct {
+		Defs map[string]*Schema `json:"$defs"`
+	}
+	err = json.Unmarshal(data, &defs)
+	if err != nil {
+		return nil, err
+	}
+	registry := NewMemorySchemaRegistry()
+	for name, def := range defs.Defs {
+		registry.Add(name, def)
+	}
+	schema.SetRegistry(registry)
+	return &schema, nil
+}
+
+// parseConformanceData parses JSON test data like YAML would: numbers without a fraction or exponent are ints
+func parseConformanceData(data []byte) (*YispNode, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+	return ParseAny("", convertNumbers(value))
+}
+
+func convertNumbers(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if !strings.ContainsAny(v.String(), ".eE") {
+			if i, err := v.Int64(); err == nil {
+				return int(i)
+			}
+		}
+		f, _ := v.Float64()
+		return f
+	case []any:
+		for i, item := range v {
+			v[i] = convertNumbers(item)
+		}
+		return v
+	case map[string]any:
+		for key, item := range v {
+			v[key] = convertNumbers(item)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+func TestCastCombinators(t *testing.T) {
+	var schema Schema
+	err := json.Unmarshal([]byte(`{
+		"type": "object",
+		"properties": {
+			"kind": {"type": "string", "enum": ["web", "worker"]},
+			"port": {"type": "integer"},
+			"replicas": {"type": "integer"}
+		},
+		"allOf": [{"properties": {"replicas": {"type": "integer", "default": 1}}}],
+		"if": {"properties": {"kind": {"const": "web"}}},
+		"then": {"properties": {"port": {"type": "integer", "default": 8080}}}
+	}`), &schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	web, _ := parseConformanceData([]byte(`{"kind": "web"}`))
+	_, err = schema.Cast(web)
+	if err != nil {
+		t.Fatal(err)
+	}
+	native, _ := web.ToNative()
+	if !jsonEqual(native, map[string]any{"kind": "web", "port": 8080, "replicas": 1}) {
+		t.Errorf("unexpected web defaults: %v", describeValue(native))
+	}
+
+	worker, _ := parseConformanceData([]byte(`{"kind": "worker"}`))
+	_, err = schema.Cast(worker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	native, _ = worker.ToNative()
+	if !jsonEqual(native, map[string]any{"kind": "worker", "replicas": 1}) {
+		t.Errorf("unexpected worker defaults: %v", describeValue(native))
+	}
+
+	invalid, _ := parseConformanceData([]byte(`{"kind": "cron"}`))
+	_, err = schema.Cast(invalid)
+	if err == nil {
+		t.Error("expected cron to be rejected by the enum")
+	}
+}
+
+func TestIntOrStringCoercion(t *testing.T) {
+	tests := []struct {
+		schema   string
+		data     string
+		expected any
+	}{
+		// the first alternative rejects "42" by its length, and must not leave the int converted for the second
+		{`{"anyOf": [{"type": "string", "format": "int-or-string", "maxLength": 1}, {"type": "integer"}]}`, `42`, 42},
+		{`{"anyOf": [{"type": "string", "format": "int-or-string"}, {"type": "integer"}]}`, `42`, "42"},
+		{`{"not": {"type": "string", "format": "int-or-string", "maxLength": 1}}`, `42`, 42},
+		{`{"if": {"type": "string", "format": "int-or-string", "maxLength": 1}, "else": {"type": "integer"}}`, `42`, 42},
+		{`{"type": "object", "properties": {"port": {"type": "string", "format": "int-or-string"}}}`, `{"port": 8080}`, map[string]any{"port": "8080"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.schema, func(t *testing.T) {
+			var schema Schema
+			err := json.Unmarshal([]byte(test.schema), &schema)
+			if err != nil {
+				t.Fatal(err)
+			}
+			node, _ := parseConformanceData([]byte(test.data))
+			err = schema.Validate(node)
+			if err != nil {
+				t.Fatal(err)
+			}
+			native, _ := node.ToNative()
+			if !jsonEqual(native, test.expected) || describeValue(native) != describeValue(test.expected) {
+				t.Errorf("expected %v, got %v", describeValue(test.expected), describeValue(native))
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package core
+
+import (
+	"archive/zip"
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ErrSchemaBundleNotFound is returned when there is no bundle for a Kubernetes version
+var ErrSchemaBundleNotFound = errors.New("schema bundle not found")
+
+// bundledSchemas are the schema bundles compiled into the binary. See bundles/README.md.
+//
+//go:embed bundles
+var bundledSchemas embed.FS
+
+var kubeVersionPattern = regexp.MustCompile(`^v?(\d+)\.(\d+)(\.\d+)?$`)
+
+// KubeMinorVersion returns the minor version bundles are selected by, e.g. 1.30 for v1.30.2
+func KubeMinorVersion(version string) (string, error) {
+	match := kubeVersionPattern.FindStringSubmatch(version)
+	if match == nil {
+		return "", fmt.Errorf("invalid Kubernetes version %q: expected a version like 1.30", version)
+	}
+	return match[1] + "." + match[2], nil
+}
+
+// SchemaBundleName returns the file name of the bundle of a Kubernetes minor version
+func SchemaBundleName(version string) string {
+	return "kubernetes-" + version + ".zip"
+}
+
+// OpenSchemaBundle returns the schemas of a Kubernetes version, read from its bundle in dir or, if there is none,
+// from the bundles compiled into the binary. The archive is read into memory, so there is nothing to close;
+// schemas are decompressed when they are looked up.
+func OpenSchemaBundle(dir, version string) (fs.FS, error) {
+	minor, err := KubeMinorVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	name := SchemaBundleName(minor)
+
+	var data []byte
+	if dir != "" {
+		data, err = os.ReadFile(filepath.Join(dir, name))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to open schema bundle %s: %v", name, err)
+		}
+	}
+	if data == nil {
+		data, err = bundledSchemas.ReadFile(path.Join("bundles", name))
+		if errors.Is(err, fs.ErrNotExist) {
+			available := "none"
+			if versions := SchemaBundleVersions(dir); len(versions) > 0 {
+				available = strings.Join(versions, ", ")
+			}
+			return nil, fmt.Errorf("%w: Kubernetes %s (available: %s)", ErrSchemaBundleNotFound, minor, available)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	bundle, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open schema bundle %s: %v", name, err)
+	}
+	return bundle, nil
+}
+
+// SchemaBundleVersions returns the Kubernetes versions there are bundles for, in dir or compiled into the binary
+func SchemaBundleVersions(dir string) []string {
+	names := make([]string, 0)
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+	}
+	if entries, err := bundledSchemas.ReadDir("bundles"); err == nil {
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+	}
+
+	versions := make([]string, 0, len(names))
+	for _, name := range names {
+		version, ok := strings.CutPrefix(name, "kubernetes-")
+		if !ok {
+			continue
+		}
+		version, ok = strings.CutSuffix(version, ".zip")
+		if ok && !slices.Contains(versions, version) {
+			versions = append(versions, version)
+		}
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// WriteSchemaBundle writes definitions of an OpenAPI document as a bundle: a zip archive in the layout of the cache.
+// Definitions of Kubernetes kinds, those with x-kubernetes-group-version-kind, can be looked up by GVK.
+func WriteSchemaBundle(w io.Writer, definitions map[string]map[string]any) error {
+	archive := zip.NewWriter(w)
+
+	// sorted, so that the same definitions give the same bundle
+	ids := make([]string, 0, len(definitions))
+	for id := range definitions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	gvks := make(map[string]string)
+	for _, id := range ids {
+		def := definitions[id]
+		def["$id"] = id
+		data, err := json.Marshal(def)
+		if err != nil {
+			return fmt.Errorf("invalid definition %s: %v", id, err)
+		}
+		if err := writeBundleEntry(archive, path.Join("schemas", id+".json"), data); err != nil {
+			return err
+		}
+
+		gvkList, _ := def["x-kubernetes-group-version-kind"].([]any)
+		for _, gvkAny := range gvkList {
+			gvk, _ := gvkAny.(map[string]any)
+			group, _ := gvk["group"].(string)
+			version, _ := gvk["version"].(string)
+			kind, _ := gvk["kind"].(string)
+			if version == "" || kind == "" {
+				continue
+			}
+			gvks[path.Join("gvk", fmt.Sprintf("%s_%s_%s.txt", group, version, kind))] = id
+		}
+	}
+
+	names := make([]string, 0, len(gvks))
+	for name := range gvks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := writeBundleEntry(archive, name, []byte(gvks[name])); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func writeBundleEntry(archive *zip.Writer, name string, data []byte) error {
+	entry, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+	if err != nil {
+		return err
+	}
+	_, err = entry.Write(data)
+	return err
+}
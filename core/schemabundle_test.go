@@ -0,0 +1,62 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSchemaBundle(t *testing.T) {
+	definitions := map[string]map[string]any{
+		"io.k8s.api.core.v1.ConfigMap": {
+			"type": "object",
+			"properties": map[string]any{
+				"metadata": map[string]any{"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+				"data":     map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}},
+			},
+			"x-kubernetes-group-version-kind": []any{map[string]any{"group": "", "version": "v1", "kind": "ConfigMap"}},
+		},
+		"io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta": {
+			"type":       "object",
+			"properties": map[string]any{"name": map[string]any{"type": "string"}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSchemaBundle(&buf, definitions); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, SchemaBundleName("1.30")), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle, err := OpenSchemaBundle(dir, "v1.30.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := NewDefaultSchemaRegistry(SchemaSources{Bundle: bundle})
+	configMap, err := registry.SchemaByGVK("", "v1", "ConfigMap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, err := ParseAny("", map[string]any{"metadata": map[string]any{"name": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := configMap.Validate(node); err == nil {
+		t.Error("expected the name to be checked against the bundled ObjectMeta")
+	}
+
+	if versions := SchemaBundleVersions(dir); len(versions) != 1 || versions[0] != "1.30" {
+		t.Errorf("expected the bundle of 1.30, got %v", versions)
+	}
+	if _, err := OpenSchemaBundle(dir, "1.29"); !errors.Is(err, ErrSchemaBundleNotFound) {
+		t.Errorf("expected ErrSchemaBundleNotFound, got %v", err)
+	}
+	if _, err := OpenSchemaBundle(dir, "latest"); err == nil {
+		t.Error("expected an error for an invalid version")
+	}
+}
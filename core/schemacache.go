@@ -0,0 +1,123 @@
+package core
+
+import (
+	"sync"
+)
+
+// CachedSchemaRegistry loads each schema of another registry once and shares it between all engines using it.
+// The $refs of loaded schemas are resolved in advance, so validation does not look anything up.
+// Schemas are never reloaded, so changes to the sources are only seen by a new registry.
+type CachedSchemaRegistry struct {
+	registry SchemaRegistry
+
+	mu      sync.Mutex
+	schemas map[string]*Schema
+	gvks    map[string]*Schema
+	urls    map[string]*Schema
+}
+
+func NewCachedSchemaRegistry(registry SchemaRegistry) *CachedSchemaRegistry {
+	return &CachedSchemaRegistry{
+		registry: registry,
+		schemas:  make(map[string]*Schema),
+		gvks:     make(map[string]*Schema),
+		urls:     make(map[string]*Schema),
+	}
+}
+
+var (
+	defaultSchemaRegistry     SchemaRegistry
+	defaultSchemaRegistryOnce sync.Once
+)
+
+// DefaultSchemaRegistry returns the registry used when none is given: the default cache directory and HTTP.
+// It is created once per process, so schemas are only loaded once.
+func DefaultSchemaRegistry() SchemaRegistry {
+	defaultSchemaRegistryOnce.Do(func() {
+		cacheDir, _ := DefaultCacheDir()
+		defaultSchemaRegistry = NewDefaultSchemaRegistry(SchemaSources{CacheDir: cacheDir})
+	})
+	return defaultSchemaRegistry
+}
+
+func (r *CachedSchemaRegistry) SchemaByID(id string) (*Schema, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.schemaByID(id)
+}
+
+func (r *CachedSchemaRegistry) SchemaByGVK(group, version, kind string) (*Schema, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := group + "/" + version + "/" + kind
+	if schema, ok := r.gvks[name]; ok {
+		return schema, nil
+	}
+	schema, err := r.registry.SchemaByGVK(group, version, kind)
+	if err != nil {
+		return nil, err
+	}
+	schema = r.add(schema, schema.ID)
+	r.gvks[name] = schema
+	return schema, nil
+}
+
+func (r *CachedSchemaRegistry) SchemaByURL(url string) (*Schema, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if schema, ok := r.urls[url]; ok {
+		return schema, nil
+	}
+	schema, err := r.registry.SchemaByURL(url)
+	if err != nil {
+		return nil, err
+	}
+	schema = r.add(schema, schema.ID)
+	r.urls[url] = schema
+	return schema, nil
+}
+
+// schemaByID returns a cached schema or loads it. r.mu must be held.
+func (r *CachedSchemaRegistry) schemaByID(id string) (*Schema, error) {
+	if schema, ok := r.schemas[id]; ok {
+		return schema, nil
+	}
+	schema, err := r.registry.SchemaByID(id)
+	if err != nil {
+		return nil, err
+	}
+	schema = r.add(schema, id)
+	r.schemas[id] = schema
+	return schema, nil
+}
+
+// add caches a loaded schema by its id and links its $refs. If a schema with the same id is cached already,
+// e.g. because it was loaded by GVK and then by id, that one is returned. r.mu must be held.
+func (r *CachedSchemaRegistry) add(schema *Schema, id string) *Schema {
+	if id != "" {
+		if cached, ok := r.schemas[id]; ok {
+			return cached
+		}
+		// cached before linking, so that cycles of $refs end at this schema
+		r.schemas[id] = schema
+	}
+	schema.SetRegistry(r)
+	r.link(schema)
+	return schema
+}
+
+// link points the $refs of a schema and its subschemas to the cached schemas they refer to.
+// $refs that cannot be loaded are left to fail when they are used. r.mu must be held.
+func (r *CachedSchemaRegistry) link(schema *Schema) {
+	if schema.Ref != "" && schema.target == nil {
+		target, err := r.schemaByID(SchemaIDFromRef(schema.Ref))
+		if err == nil {
+			schema.target = target
+		}
+	}
+	for _, subSchema := range schema.subSchemas() {
+		r.link(subSchema)
+	}
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// benchmarkSchemas are a trimmed down Deployment in the layout of the cache, with the $refs of the Kubernetes
+// OpenAPI spec and a recursive type like JSONSchemaProps
+var benchmarkSchemas = map[string]string{
+	"gvk/apps_v1_Deployment.txt": "io.k8s.api.apps.v1.Deployment",
+	"schemas/io.k8s.api.apps.v1.Deployment.json": `{"type": "object", "properties": {
+		"apiVersion": {"type": "string"}, "kind": {"type": "string"},
+		"metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+		"spec": {"$ref": "#/definitions/io.k8s.api.apps.v1.DeploymentSpec"}}}`,
+	"schemas/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta.json": `{"type": "object", "properties": {
+		"name": {"type": "string"}, "namespace": {"type": "string"},
+		"labels": {"type": "object", "additionalProperties": {"type": "string"}},
+		"annotations": {"type": "object", "additionalProperties": {"type": "string"}}}}`,
+	"schemas/io.k8s.api.apps.v1.DeploymentSpec.json": `{"type": "object", "properties": {
+		"replicas": {"type": "integer"},
+		"selector": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.LabelSelector"},
+		"template": {"$ref": "#/definitions/io.k8s.api.core.v1.PodTemplateSpec"}}}`,
+	"schemas/io.k8s.apimachinery.pkg.apis.meta.v1.LabelSelector.json": `{"type": "object", "properties": {
+		"matchLabels": {"type": "object", "additionalProperties": {"type": "string"}}}}`,
+	"schemas/io.k8s.api.core.v1.PodTemplateSpec.json": `{"type": "object", "properties": {
+		"metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+		"spec": {"$ref": "#/definitions/io.k8s.api.core.v1.PodSpec"}}}`,
+	"schemas/io.k8s.api.core.v1.PodSpec.json": `{"type": "object", "properties": {
+		"containers": {"type": "array", "items": {"$ref": "#/definitions/io.k8s.api.core.v1.Container"}}}}`,
+	"schemas/io.k8s.api.core.v1.Container.json": `{"type": "object", "properties": {
+		"name": {"type": "string"}, "image": {"type": "string"},
+		"ports": {"type": "array", "items": {"$ref": "#/definitions/io.k8s.api.core.v1.ContainerPort"}},
+		"env": {"type": "array", "items": {"$ref": "#/definitions/io.k8s.api.core.v1.EnvVar"}},
+		"resources": {"$ref": "#/definitions/io.k8s.api.core.v1.ResourceRequirements"}}}`,
+	"schemas/io.k8s.api.core.v1.ContainerPort.json": `{"type": "object", "properties": {
+		"name": {"type": "string"}, "containerPort": {"type": "integer"}, "protocol": {"type": "string"}}}`,
+	"schemas/io.k8s.api.core.v1.EnvVar.json": `{"type": "object", "properties": {
+		"name": {"type": "string"}, "value": {"type": "string"}}}`,
+	"schemas/io.k8s.api.core.v1.ResourceRequirements.json": `{"type": "object", "properties": {
+		"limits": {"type": "object", "additionalProperties": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.api.resource.Quantity"}},
+		"requests": {"type": "object", "additionalProperties": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.api.resource.Quantity"}}}}`,
+	"schemas/io.k8s.apimachinery.pkg.api.resource.Quantity.json": `{"type": "string", "format": "quantity"}`,
+	"schemas/example.Props.json": `{"type": "object", "properties": {
+		"name": {"type": "string"},
+		"children": {"type": "array", "items": {"$ref": "example.Props"}}}}`,
+}
+
+func writeBenchmarkSchemas(t testing.TB) string {
+	dir := t.TempDir()
+	for name, content := range benchmarkSchemas {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func benchmarkDeployment(t testing.TB, i int) *YispNode {
+	node, err := ParseAny("", map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]any{"name": fmt.Sprintf("app-%d", i), "labels": map[string]any{"app": "web"}},
+		"spec": map[string]any{
+			"replicas": 2,
+			"selector": map[string]any{"matchLabels": map[string]any{"app": "web"}},
+			"template": map[string]any{
+				"metadata": map[string]any{"labels": map[string]any{"app": "web"}},
+				"spec": map[string]any{"containers": []any{map[string]any{
+					"name":      "web",
+					"image":     "nginx:1.27",
+					"ports":     []any{map[string]any{"name": "http", "containerPort": 80}},
+					"env":       []any{map[string]any{"name": "MODE", "value": "production"}},
+					"resources": map[string]any{"limits": map[string]any{"cpu": "500m", "memory": "256Mi"}},
+				}}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node
+}
+
+func TestCachedSchemaRegistry(t *testing.T) {
+	registry := NewCachedSchemaRegistry(NewDirSchemaRegistry(writeBenchmarkSchemas(t)))
+
+	deployment, err := registry.SchemaByGVK("apps", "v1", "Deployment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID, err := registry.SchemaByID("io.k8s.api.apps.v1.Deployment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployment != byID {
+		t.Error("expected the schema loaded by GVK to be shared with the one loaded by id")
+	}
+
+	// the metadata of the deployment and of its pod template refer to the same schema
+	spec := deployment.Properties["spec"].target
+	template := spec.Properties["template"].target
+	if deployment.Properties["metadata"].target == nil || deployment.Properties["metadata"].target != template.Properties["metadata"].target {
+		t.Error("expected $refs to be linked to the shared schema")
+	}
+
+	props, err := registry.SchemaByID("example.Props")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if props.Properties["children"].Items.target != props {
+		t.Error("expected the recursive $ref to point back to the schema")
+	}
+	tree, err := ParseAny("", map[string]any{"name": "a", "children": []any{map[string]any{"name": "b", "children": []any{map[string]any{"name": 1}}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := props.Validate(tree); err == nil {
+		t.Error("expected the nested name to be rejected")
+	}
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			schema, err := registry.SchemaByGVK("apps", "v1", "Deployment")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if err := schema.Validate(benchmarkDeployment(t, i)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkValidateDeployments(b *testing.B) {
+	dir := writeBenchmarkSchemas(b)
+	manifests := make([]*YispNode, 200)
+	for i := range manifests {
+		manifests[i] = benchmarkDeployment(b, i)
+	}
+
+	registries := []struct {
+		name     string
+		registry func() SchemaRegistry
+	}{
+		{"uncached", func() SchemaRegistry { return NewDirSchemaRegistry(dir) }},
+		{"cached", func() SchemaRegistry { return NewCachedSchemaRegistry(NewDirSchemaRegistry(dir)) }},
+	}
+	for _, r := range registries {
+		b.Run(r.name, func(b *testing.B) {
+			registry := r.registry()
+			for b.Loop() {
+				for _, manifest := range manifests {
+					schema, err := registry.SchemaByGVK("apps", "v1", "Deployment")
+					if err != nil {
+						b.Fatal(err)
+					}
+					if err := schema.Validate(manifest); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
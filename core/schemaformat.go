@@ -0,0 +1,205 @@
+package core
+
+import (
+	"fmt"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SchemaFormat checks strings against the format keyword of schemas
+type SchemaFormat struct {
+	// Validate returns an error describing why the value does not have the format
+	Validate func(value string) error
+	// Strict formats reject values that fail Validate.
+	// Formats that are not strict only annotate the schema, as in JSON Schema, and accept any string.
+	Strict bool
+}
+
+// schemaFormatsMu guards schemaFormats, which may be changed while schemas are validated
+var schemaFormatsMu sync.RWMutex
+
+var schemaFormats = map[string]SchemaFormat{
+	"quantity":           {Validate: validateQuantity, Strict: true},
+	"duration":           {Validate: validateDuration, Strict: true},
+	"date-time":          {Validate: validateDateTime, Strict: true},
+	"uri":                {Validate: validateURI, Strict: true},
+	"email":              {Validate: validateEmail, Strict: true},
+	"ipv4":               {Validate: validateIPv4, Strict: true},
+	"ipv6":               {Validate: validateIPv6, Strict: true},
+	"cidr":               {Validate: validateCIDR, Strict: true},
+	"dns-1123-label":     {Validate: validateDNS1123Label, Strict: true},
+	"dns-1123-subdomain": {Validate: validateDNS1123Subdomain, Strict: true},
+}
+
+// RegisterSchemaFormat makes a format available to schemas, replacing any format of the same name
+func RegisterSchemaFormat(name string, format SchemaFormat) {
+	schemaFormatsMu.Lock()
+	defer schemaFormatsMu.Unlock()
+	schemaFormats[name] = format
+}
+
+func unregisterSchemaFormat(name string) {
+	schemaFormatsMu.Lock()
+	defer schemaFormatsMu.Unlock()
+	delete(schemaFormats, name)
+}
+
+// SetSchemaFormatStrict changes whether values failing a registered format are rejected.
+// It returns false if no format is registered under name.
+func SetSchemaFormatStrict(name string, strict bool) bool {
+	schemaFormatsMu.Lock()
+	defer schemaFormatsMu.Unlock()
+	format, ok := schemaFormats[name]
+	if !ok {
+		return false
+	}
+	format.Strict = strict
+	schemaFormats[name] = format
+	return true
+}
+
+// GetSchemaFormat returns the format registered under name
+func GetSchemaFormat(name string) (SchemaFormat, bool) {
+	schemaFormatsMu.RLock()
+	defer schemaFormatsMu.RUnlock()
+	format, ok := schemaFormats[name]
+	return format, ok
+}
+
+// SchemaFormatNames returns the names of all registered formats in sorted order
+func SchemaFormatNames() []string {
+	schemaFormatsMu.RLock()
+	defer schemaFormatsMu.RUnlock()
+	names := make([]string, 0, len(schemaFormats))
+	for name := range schemaFormats {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// ValidateFormat checks a string against a strict format.
+// Unknown formats, like int32 or byte in Kubernetes schemas, accept any string.
+func ValidateFormat(name, value string) error {
+	format, ok := GetSchemaFormat(name)
+	if !ok || !format.Strict || format.Validate == nil {
+		return nil
+	}
+	if err := format.Validate(value); err != nil {
+		return fmt.Errorf("string %q is not a valid %s: %v", value, name, err)
+	}
+	return nil
+}
+
+// quantityPattern matches Kubernetes resource quantities: a decimal number with a binary SI, decimal SI or exponent suffix
+var quantityPattern = regexp.MustCompile(`^[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)(Ki|Mi|Gi|Ti|Pi|Ei|n|u|m|k|M|G|T|P|E|[eE][+-]?[0-9]+)?$`)
+
+func validateQuantity(value string) error {
+	if !quantityPattern.MatchString(value) {
+		return fmt.Errorf("expected a number with an optional suffix like Mi, G or m")
+	}
+	return nil
+}
+
+// isoDurationPattern matches ISO 8601 durations, which JSON Schema uses for the duration format
+var isoDurationPattern = regexp.MustCompile(`^P([0-9]+W|([0-9]+Y)?([0-9]+M)?([0-9]+D)?(T([0-9]+H)?([0-9]+M)?([0-9]+S)?)?)$`)
+
+// validateDuration accepts Go durations like 1h30m, which Kubernetes uses, and ISO 8601 durations like PT1H30M
+func validateDuration(value string) error {
+	if _, err := time.ParseDuration(value); err == nil {
+		return nil
+	}
+	if isoDurationPattern.MatchString(value) && value != "P" && !strings.HasSuffix(value, "T") {
+		return nil
+	}
+	return fmt.Errorf("expected a duration like 1h30m or PT1H30M")
+}
+
+func validateDateTime(value string) error {
+	_, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return fmt.Errorf("expected an RFC 3339 date-time like 2006-01-02T15:04:05Z")
+	}
+	return nil
+}
+
+func validateURI(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" {
+		return fmt.Errorf("missing scheme")
+	}
+	return nil
+}
+
+func validateEmail(value string) error {
+	address, err := mail.ParseAddress(value)
+	if err != nil {
+		return err
+	}
+	if address.Name != "" || address.Address != value {
+		return fmt.Errorf("expected a bare address")
+	}
+	return nil
+}
+
+func validateIPv4(value string) error {
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return err
+	}
+	if !addr.Is4() {
+		return fmt.Errorf("not an IPv4 address")
+	}
+	return nil
+}
+
+func validateIPv6(value string) error {
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return err
+	}
+	if !addr.Is6() || addr.Zone() != "" {
+		return fmt.Errorf("not an IPv6 address")
+	}
+	return nil
+}
+
+func validateCIDR(value string) error {
+	_, err := netip.ParsePrefix(value)
+	return err
+}
+
+var dns1123LabelPattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// validateDNS1123Label accepts names Kubernetes allows for e.g. services and namespaces
+func validateDNS1123Label(value string) error {
+	if len(value) > 63 {
+		return fmt.Errorf("longer than 63 characters")
+	}
+	if !dns1123LabelPattern.MatchString(value) {
+		return fmt.Errorf("expected lowercase alphanumeric characters or '-', starting and ending with an alphanumeric character")
+	}
+	return nil
+}
+
+// validateDNS1123Subdomain accepts names Kubernetes allows for most resources, like deployments and config maps
+func validateDNS1123Subdomain(value string) error {
+	if len(value) > 253 {
+		return fmt.Errorf("longer than 253 characters")
+	}
+	for _, label := range strings.Split(value, ".") {
+		if !dns1123LabelPattern.MatchString(label) {
+			return fmt.Errorf("expected lowercase alphanumeric characters, '-' or '.', starting and ending with an alphanumeric character")
+		}
+	}
+	return nil
+}
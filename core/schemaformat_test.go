@@ -0,0 +1,76 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateFormat(t *testing.T) {
+	tests := []struct {
+		format  string
+		valid   []string
+		invalid []string
+	}{
+		{"quantity", []string{"1", "100m", "1.5Gi", "2e3", "+.5", "512Ki"}, []string{"", "1.5 Gi", "Gi", "1gi", "1..5"}},
+		{"duration", []string{"1h30m", "10s", "-5m", "PT1H30M", "P1D", "P2W"}, []string{"", "1 hour", "P", "PT", "P1H"}},
+		{"date-time", []string{"2024-01-02T03:04:05Z", "2024-01-02T03:04:05.123+09:00"}, []string{"2024-01-02", "2024-01-02 03:04:05Z", "2024-13-02T03:04:05Z"}},
+		{"uri", []string{"https://example.com/a?b=c", "urn:isbn:0451450523"}, []string{"/relative/path", "example.com", "http://[::1"}},
+		{"email", []string{"alice@example.com"}, []string{"alice", "Alice <alice@example.com>", "@example.com"}},
+		{"ipv4", []string{"10.0.0.1"}, []string{"10.0.0.256", "::1", "10.0.0"}},
+		{"ipv6", []string{"::1", "2001:db8::1", "::ffff:10.0.0.1"}, []string{"10.0.0.1", "fe80::1%eth0", "2001:db8:::1"}},
+		{"cidr", []string{"10.0.0.0/8", "2001:db8::/32"}, []string{"10.0.0.0", "10.0.0.0/33"}},
+		{"dns-1123-label", []string{"web", "my-app-1", "1a"}, []string{"My-App", "-web", "web-", "a.b", strings.Repeat("a", 64)}},
+		{"dns-1123-subdomain", []string{"web", "my-app.example.com"}, []string{"my_app", "a..b", ".a", strings.Repeat("a.", 127)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			for _, value := range test.valid {
+				if err := ValidateFormat(test.format, value); err != nil {
+					t.Errorf("expected %q to be valid: %v", value, err)
+				}
+			}
+			for _, value := range test.invalid {
+				if err := ValidateFormat(test.format, value); err == nil {
+					t.Errorf("expected %q to be invalid", value)
+				}
+			}
+		})
+	}
+
+	if err := ValidateFormat("int32", "anything"); err != nil {
+		t.Errorf("expected unknown formats to accept any string: %v", err)
+	}
+}
+
+func TestRegisterSchemaFormat(t *testing.T) {
+	RegisterSchemaFormat("test-upper", SchemaFormat{
+		Validate: func(value string) error {
+			if strings.ToUpper(value) != value {
+				return errors.New("expected uppercase")
+			}
+			return nil
+		},
+		Strict: true,
+	})
+	t.Cleanup(func() { unregisterSchemaFormat("test-upper") })
+
+	schema := &Schema{Type: "string", Format: "test-upper"}
+	if err := schema.Validate(&YispNode{Kind: KindString, Value: "ABC"}); err != nil {
+		t.Errorf("expected ABC to be valid: %v", err)
+	}
+	if err := schema.Validate(&YispNode{Kind: KindString, Value: "abc"}); err == nil {
+		t.Error("expected abc to be invalid")
+	}
+
+	if !SetSchemaFormatStrict("test-upper", false) {
+		t.Fatal("expected the format to be registered")
+	}
+	if err := schema.Validate(&YispNode{Kind: KindString, Value: "abc"}); err != nil {
+		t.Errorf("expected formats that are not strict to accept any string: %v", err)
+	}
+	if SetSchemaFormatStrict("test-missing", true) {
+		t.Error("expected an unregistered format to be reported")
+	}
+}
@@ -0,0 +1,333 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrSchemaNotFound is returned by registries that do not have a schema, so that the next source can be tried
+var ErrSchemaNotFound = errors.New("schema not found")
+
+// SchemaRegistry looks up the schemas of manifests and of $refs.
+// Schemas returned by a registry resolve their $refs through it.
+type SchemaRegistry interface {
+	// SchemaByID returns the schema with an $id, e.g. a definition name of the Kubernetes OpenAPI spec
+	SchemaByID(id string) (*Schema, error)
+	// SchemaByGVK returns the schema of a Kubernetes group, version and kind. The core group is empty.
+	SchemaByGVK(group, version, kind string) (*Schema, error)
+	// SchemaByURL returns the schema named by the $schema key of a document
+	SchemaByURL(url string) (*Schema, error)
+}
+
+// SchemaSources are the places the default registry looks for schemas, in order.
+// Directories and the bundle use the layout of the cache: schemas/<id>.json, and gvk/<group>_<version>_<kind>.txt
+// holding the id of the schema of a kind.
+type SchemaSources struct {
+	// ProjectDir holds schemas checked in with the project
+	ProjectDir string
+	// Bundle holds the schemas of a Kubernetes version, see OpenSchemaBundle. It comes before the cache,
+	// so that the version asked for is used even if the schemas of a cluster are cached.
+	Bundle fs.FS
+	// CacheDir holds the schemas written by yisp cache-kube-schemas and those fetched by URL
+	CacheDir string
+	// Offline skips fetching schemas named by URL, which are then only found if they were cached before
+	Offline bool
+}
+
+// NewDefaultSchemaRegistry returns a registry looking up schemas in the project directory, the bundle,
+// the cache and finally over HTTP, for schemas named by URL unless offline. Sources that are not set are skipped.
+// Schemas are loaded once and shared by everything using the registry.
+func NewDefaultSchemaRegistry(sources SchemaSources) SchemaRegistry {
+	layers := make([]SchemaRegistry, 0, 4)
+	if sources.ProjectDir != "" {
+		layers = append(layers, NewDirSchemaRegistry(sources.ProjectDir))
+	}
+	if sources.Bundle != nil {
+		layers = append(layers, NewFSSchemaRegistry(sources.Bundle))
+	}
+	if sources.CacheDir != "" {
+		layers = append(layers, NewDirSchemaRegistry(sources.CacheDir))
+	}
+	if !sources.Offline {
+		layers = append(layers, NewHTTPSchemaRegistry(sources.CacheDir))
+	}
+	return NewCachedSchemaRegistry(NewLayeredSchemaRegistry(layers...))
+}
+
+// DefaultCacheDir returns ~/.cache/yisp
+func DefaultCacheDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+	return filepath.Join(home, ".cache", "yisp"), nil
+}
+
+// SchemaIDFromRef returns the id a $ref points to. References into the definitions of a document,
+// like #/definitions/io.k8s.api.core.v1.PodSpec, name the definition.
+func SchemaIDFromRef(ref string) string {
+	if strings.HasPrefix(ref, "#") {
+		split := strings.Split(ref, "/")
+		return split[len(split)-1]
+	}
+	return ref
+}
+
+// LayeredSchemaRegistry looks up schemas in several registries in order.
+// Schemas resolve their $refs through the whole stack, so a project schema can refer to a cached Kubernetes type.
+type LayeredSchemaRegistry struct {
+	layers []SchemaRegistry
+}
+
+func NewLayeredSchemaRegistry(layers ...SchemaRegistry) *LayeredSchemaRegistry {
+	return &LayeredSchemaRegistry{layers: layers}
+}
+
+func (r *LayeredSchemaRegistry) SchemaByID(id string) (*Schema, error) {
+	return r.lookup(func(layer SchemaRegistry) (*Schema, error) {
+		return layer.SchemaByID(id)
+	}, id)
+}
+
+func (r *LayeredSchemaRegistry) SchemaByGVK(group, version, kind string) (*Schema, error) {
+	return r.lookup(func(layer SchemaRegistry) (*Schema, error) {
+		return layer.SchemaByGVK(group, version, kind)
+	}, group+"/"+version+"/"+kind)
+}
+
+func (r *LayeredSchemaRegistry) SchemaByURL(url string) (*Schema, error) {
+	return r.lookup(func(layer SchemaRegistry) (*Schema, error) {
+		return layer.SchemaByURL(url)
+	}, url)
+}
+
+func (r *LayeredSchemaRegistry) lookup(find func(layer SchemaRegistry) (*Schema, error), name string) (*Schema, error) {
+	for _, layer := range r.layers {
+		schema, err := find(layer)
+		if errors.Is(err, ErrSchemaNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		schema.SetRegistry(r)
+		return schema, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrSchemaNotFound, name)
+}
+
+// FSSchemaRegistry reads schemas from a file system in the layout of the cache
+type FSSchemaRegistry struct {
+	fsys fs.FS
+}
+
+func NewFSSchemaRegistry(fsys fs.FS) *FSSchemaRegistry {
+	return &FSSchemaRegistry{fsys: fsys}
+}
+
+// NewDirSchemaRegistry reads schemas from a directory in the layout of the cache
+func NewDirSchemaRegistry(dir string) *FSSchemaRegistry {
+	return NewFSSchemaRegistry(os.DirFS(dir))
+}
+
+// SchemaByID reads schemas/<id>.json. A schema without an $id gets the id it was looked up by.
+func (r *FSSchemaRegistry) SchemaByID(id string) (*Schema, error) {
+	schema, err := r.read(path.Join("schemas", id+".json"), id)
+	if err != nil {
+		return nil, err
+	}
+	if schema.ID == "" {
+		schema.ID = id
+	}
+	return schema, nil
+}
+
+func (r *FSSchemaRegistry) SchemaByGVK(group, version, kind string) (*Schema, error) {
+	name := group + "/" + version + "/" + kind
+	filename := path.Join("gvk", fmt.Sprintf("%s_%s_%s.txt", group, version, kind))
+	if !fs.ValidPath(filename) {
+		return nil, fmt.Errorf("%w: %s", ErrSchemaNotFound, name)
+	}
+	id, err := fs.ReadFile(r.fsys, filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrSchemaNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.SchemaByID(strings.TrimSpace(string(id)))
+}
+
+func (r *FSSchemaRegistry) SchemaByURL(url string) (*Schema, error) {
+	return r.read(path.Join("schemas", urlCacheKey(url)+".json"), url)
+}
+
+func (r *FSSchemaRegistry) read(filename, name string) (*Schema, error) {
+	if !fs.ValidPath(filename) {
+		return nil, fmt.Errorf("%w: %s", ErrSchemaNotFound, name)
+	}
+	data, err := fs.ReadFile(r.fsys, filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrSchemaNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var schema Schema
+	err = json.Unmarshal(data, &schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema %s: %v", filename, err)
+	}
+	schema.SetRegistry(r)
+	return &schema, nil
+}
+
+// HTTPSchemaRegistry fetches schemas named by URL. If cacheDir is set, fetched schemas are stored there,
+// where a registry for the cache directory finds them the next time.
+type HTTPSchemaRegistry struct {
+	cacheDir string
+}
+
+func NewHTTPSchemaRegistry(cacheDir string) *HTTPSchemaRegistry {
+	return &HTTPSchemaRegistry{cacheDir: cacheDir}
+}
+
+func (r *HTTPSchemaRegistry) SchemaByID(id string) (*Schema, error) {
+	return nil, fmt.Errorf("%w: %s", ErrSchemaNotFound, id)
+}
+
+func (r *HTTPSchemaRegistry) SchemaByGVK(group, version, kind string) (*Schema, error) {
+	return nil, fmt.Errorf("%w: %s/%s/%s", ErrSchemaNotFound, group, version, kind)
+}
+
+func (r *HTTPSchemaRegistry) SchemaByURL(url string) (*Schema, error) {
+	data, err := FetchRemote(url)
+	if err != nil {
+		return nil, err
+	}
+
+	var schema Schema
+	err = json.Unmarshal(data, &schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema %s: %v", url, err)
+	}
+
+	if r.cacheDir != "" {
+		filename := filepath.Join(r.cacheDir, "schemas", urlCacheKey(url)+".json")
+		err = os.MkdirAll(filepath.Dir(filename), 0755)
+		if err != nil {
+			return nil, err
+		}
+		err = os.WriteFile(filename, data, 0644)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	schema.SetRegistry(r)
+	return &schema, nil
+}
+
+// MemorySchemaRegistry holds schemas added from Go, e.g. in tests
+type MemorySchemaRegistry struct {
+	mu      sync.RWMutex
+	schemas map[string]*Schema
+	gvks    map[string]string
+	urls    map[string]*Schema
+}
+
+func NewMemorySchemaRegistry() *MemorySchemaRegistry {
+	return &MemorySchemaRegistry{
+		schemas: make(map[string]*Schema),
+		gvks:    make(map[string]string),
+		urls:    make(map[string]*Schema),
+	}
+}
+
+// Add stores a schema under an id
+func (r *MemorySchemaRegistry) Add(id string, schema *Schema) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schemas[id] = schema
+}
+
+// AddGVK makes the schema with an id the schema of a Kubernetes group, version and kind
+func (r *MemorySchemaRegistry) AddGVK(group, version, kind, id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gvks[group+"/"+version+"/"+kind] = id
+}
+
+// AddURL stores a schema under a URL
+func (r *MemorySchemaRegistry) AddURL(url string, schema *Schema) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.urls[url] = schema
+}
+
+func (r *MemorySchemaRegistry) SchemaByID(id string) (*Schema, error) {
+	r.mu.RLock()
+	schema, ok := r.schemas[id]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSchemaNotFound, id)
+	}
+	copied, err := r.copy(schema)
+	if err != nil {
+		return nil, err
+	}
+	if copied.ID == "" {
+		copied.ID = id
+	}
+	return copied, nil
+}
+
+func (r *MemorySchemaRegistry) SchemaByGVK(group, version, kind string) (*Schema, error) {
+	name := group + "/" + version + "/" + kind
+	r.mu.RLock()
+	id, ok := r.gvks[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSchemaNotFound, name)
+	}
+	return r.SchemaByID(id)
+}
+
+func (r *MemorySchemaRegistry) SchemaByURL(url string) (*Schema, error) {
+	r.mu.RLock()
+	schema, ok := r.urls[url]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSchemaNotFound, url)
+	}
+	return r.copy(schema)
+}
+
+// copy returns a copy of a stored schema, so that binding it to a registry does not change the stored one
+func (r *MemorySchemaRegistry) copy(schema *Schema) (*Schema, error) {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	var copied Schema
+	err = json.Unmarshal(data, &copied)
+	if err != nil {
+		return nil, err
+	}
+	copied.SetRegistry(r)
+	return &copied, nil
+}
+
+// urlCacheKey is the name schemas fetched from a URL are stored under in the cache
+func urlCacheKey(url string) string {
+	return base64.URLEncoding.EncodeToString([]byte(url))
+}
@@ -0,0 +1,117 @@
+package core
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSchemaRegistry(t *testing.T) {
+	cache := NewFSSchemaRegistry(fstest.MapFS{
+		"schemas/io.k8s.api.core.v1.Container.json": {Data: []byte(`{"type": "object", "properties": {"image": {"type": "string"}}}`)},
+		"gvk/_v1_Pod.txt": {Data: []byte("io.k8s.api.core.v1.Pod\n")},
+		"schemas/io.k8s.api.core.v1.Pod.json": {Data: []byte(`{
+			"type": "object",
+			"properties": {"containers": {"type": "array", "items": {"$ref": "#/definitions/io.k8s.api.core.v1.Container"}}}
+		}`)},
+	})
+	project := NewMemorySchemaRegistry()
+	project.Add("example.com.App", &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"main": {Ref: "io.k8s.api.core.v1.Container"},
+		},
+	})
+	project.AddGVK("example.com", "v1", "App", "example.com.App")
+	registry := NewLayeredSchemaRegistry(project, cache)
+
+	pod, err := registry.SchemaByGVK("", "v1", "Pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	properties, err := pod.GetProperties()
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := properties["containers"].GetItems()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items.Properties["image"] == nil {
+		t.Errorf("expected the container schema, got %+v", items)
+	}
+
+	// a project schema can refer to a schema of another layer
+	app, err := registry.SchemaByGVK("example.com", "v1", "App")
+	if err != nil {
+		t.Fatal(err)
+	}
+	properties, err = app.GetProperties()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if properties["main"].Properties["image"] == nil {
+		t.Errorf("expected the container schema, got %+v", properties["main"])
+	}
+
+	_, err = registry.SchemaByGVK("apps", "v1", "Deployment")
+	if !errors.Is(err, ErrSchemaNotFound) {
+		t.Errorf("expected ErrSchemaNotFound, got %v", err)
+	}
+
+	// OpenAPI v3 wraps $refs in allOf
+	wrapped := &Schema{Properties: map[string]*Schema{"main": {AllOf: []*Schema{{Ref: "#/components/schemas/io.k8s.api.core.v1.Container"}}}}}
+	wrapped.SetRegistry(registry)
+	node, err := ParseAny("", map[string]any{"main": map[string]any{"image": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wrapped.Validate(node); err == nil {
+		t.Error("expected the image to be checked against the referenced schema")
+	}
+
+	broken := &Schema{Properties: map[string]*Schema{"a": {Ref: "missing"}}}
+	broken.SetRegistry(registry)
+	if _, err := broken.GetProperties(); err == nil {
+		t.Error("expected an error for an unresolvable $ref")
+	}
+}
+
+func TestDefaultSchemaRegistryOffline(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(`{"type": "object"}`))
+	}))
+	defer server.Close()
+	url := server.URL + "/app.json"
+	cache := t.TempDir()
+
+	_, err := NewDefaultSchemaRegistry(SchemaSources{CacheDir: cache, Offline: true}).SchemaByURL(url)
+	if !errors.Is(err, ErrSchemaNotFound) {
+		t.Errorf("expected ErrSchemaNotFound, got %v", err)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("expected no requests while offline, got %d", n)
+	}
+
+	_, err = NewDefaultSchemaRegistry(SchemaSources{CacheDir: cache}).SchemaByURL(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// schemas fetched before are found in the cache
+	schema, err := NewDefaultSchemaRegistry(SchemaSources{CacheDir: cache, Offline: true}).SchemaByURL(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.Type != "object" {
+		t.Errorf("expected the cached schema, got %+v", schema)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected a single request, got %d", n)
+	}
+}
@@ -242,6 +242,7 @@ type TypedSymbol struct {
 }
 
 type Lambda struct {
+	Name      string
 	Arguments []TypedSymbol
 	Returns   *Schema
 	Body      *YispNode
@@ -2,6 +2,7 @@ package core
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -95,7 +96,11 @@ func DeepMergeYispNode(dst, src *YispNode, schema *Schema) (*YispNode, error) {
 
 		properties := make(map[string]*Schema)
 		if schema != nil {
-			properties = schema.GetProperties()
+			var err error
+			properties, err = schema.GetProperties()
+			if err != nil {
+				return nil, err
+			}
 		}
 
 		result := NewYispMap()
@@ -137,7 +142,11 @@ func DeepMergeYispNode(dst, src *YispNode, schema *Schema) (*YispNode, error) {
 
 		var subSchema *Schema
 		if schema != nil {
-			subSchema = schema.GetItems()
+			var err error
+			subSchema, err = schema.GetItems()
+			if err != nil {
+				return nil, err
+			}
 		}
 
 		var result []any
@@ -305,6 +314,12 @@ func RenderCode(file string, line, after, before int, comments []Comment) (strin
 }
 
 func CallEngineByPath(path, base string, env *Env, e Engine) (*YispNode, error) {
+	return CallEngineByPathWithFormat(path, base, "", env, e)
+}
+
+// CallEngineByPathWithFormat is CallEngineByPath with an explicit format (see FormatExtension)
+// that overrides the one guessed from the extension of path
+func CallEngineByPathWithFormat(path, base, format string, env *Env, e Engine) (*YispNode, error) {
 
 	var reader io.Reader
 
@@ -333,10 +348,16 @@ func CallEngineByPath(path, base string, env *Env, e Engine) (*YispNode, error)
 		}
 
 		if targetURL.Scheme == "http" || targetURL.Scheme == "https" {
-			reader, err = fetchRemote(targetURL.String())
+			err := checkRemoteEnabled(e)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch remote file %s: %v", targetURL, err)
+			}
+			body, err := FetchRemote(targetURL.String())
 			if err != nil {
 				return nil, fmt.Errorf("failed to fetch remote file: %v", err)
 			}
+			RecordInput(e, InputRemote, targetURL.String(), body)
+			reader = bytes.NewReader(body)
 		} else {
 
 			stat, err := os.Stat(targetURL.Path)
@@ -351,11 +372,20 @@ func CallEngineByPath(path, base string, env *Env, e Engine) (*YispNode, error)
 			if err != nil {
 				return nil, fmt.Errorf("failed to open file: %v", err)
 			}
+			RecordFile(e, targetURL.Path)
 		}
 		extension = filepath.Ext(targetURL.Path)
 		source = targetURL.String()
 	}
 
+	if format != "" {
+		var err error
+		extension, err = FormatExtension(format)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	switch extension {
 	case ".yisp":
 		return e.Run(reader, env, source)
@@ -363,6 +393,16 @@ func CallEngineByPath(path, base string, env *Env, e Engine) (*YispNode, error)
 		return ParseYaml(source, reader)
 	case ".json":
 		return ParseJson(source, reader)
+	case ".toml":
+		return ParseToml(source, reader)
+	case ".env":
+		return ParseDotenv(source, reader)
+	case ".ini":
+		return ParseIni(source, reader)
+	case ".properties":
+		return ParseProperties(source, reader)
+	case ".csv":
+		return ParseCsv(source, reader)
 	default:
 		text, err := io.ReadAll(reader)
 		if err != nil {
@@ -377,16 +417,34 @@ func CallEngineByPath(path, base string, env *Env, e Engine) (*YispNode, error)
 
 }
 
-func fetchRemote(rawURL string) (io.ReadCloser, error) {
+// FetchRemote downloads the content of an http or https URL
+func FetchRemote(rawURL string) ([]byte, error) {
 	resp, err := http.Get(rawURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch remote file: %v", err)
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		resp.Body.Close()
 		return nil, fmt.Errorf("failed to fetch remote file: %s", resp.Status)
 	}
-	return resp.Body, nil
+	return io.ReadAll(resp.Body)
+}
+
+// checkRemoteEnabled fails if the engine does not fetch remote files, e.g. in the language server,
+// which evaluates on every edit
+func checkRemoteEnabled(e Engine) error {
+	disabledAny, ok := e.GetOption("net.gammalab.yisp.remote.disabled")
+	if !ok {
+		return nil
+	}
+	disabled, ok := disabledAny.(bool)
+	if !ok {
+		return fmt.Errorf("invalid net.gammalab.yisp.remote.disabled option type: %T", disabledAny)
+	}
+	if disabled {
+		return fmt.Errorf("remote files are not fetched here")
+	}
+	return nil
 }
 
 // isTruthy determines if a value is considered "truthy" in a boolean context
@@ -0,0 +1,307 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ParseScalar types a string the way a plain YAML scalar would be: true, 1, 1.5 and null
+// become a bool, int, float and null, anything else stays a string
+func ParseScalar(s string, pos FilePos) *YispNode {
+	attr := Attribute{Sources: []FilePos{pos}}
+
+	var value any
+	err := yaml.Unmarshal([]byte(s), &value)
+	if err != nil {
+		return &YispNode{Kind: KindString, Value: s, Attr: attr}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		if s == "" {
+			return &YispNode{Kind: KindString, Value: s, Attr: attr}
+		}
+		return &YispNode{Kind: KindNull, Attr: attr}
+	case bool:
+		return &YispNode{Kind: KindBool, Value: v, Attr: attr}
+	case int:
+		return &YispNode{Kind: KindInt, Value: v, Attr: attr}
+	case float64:
+		return &YispNode{Kind: KindFloat, Value: v, Attr: attr}
+	default:
+		return &YispNode{Kind: KindString, Value: s, Attr: attr}
+	}
+}
+
+// ParseSetValues parses Helm style assignments like a.b=1,c[0]=x,d={e,f} into a map.
+// Values are typed with ParseScalar unless typed is false, in which case they are strings.
+// Commas, dots, brackets and equal signs in keys or values can be escaped with a backslash.
+func ParseSetValues(s string, typed bool, pos FilePos) (*YispNode, error) {
+	root := &YispNode{Kind: KindMap, Value: NewYispMap(), Attr: Attribute{Sources: []FilePos{pos}}}
+
+	for _, assignment := range splitUnescaped(s, ',', true) {
+		key, value, ok := cutUnescaped(assignment, '=')
+		if !ok {
+			return nil, fmt.Errorf("invalid assignment %q, expected key=value", assignment)
+		}
+
+		var node *YispNode
+		if strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}") {
+			items := make([]any, 0)
+			if inner := value[1 : len(value)-1]; inner != "" {
+				for _, item := range splitUnescaped(inner, ',', false) {
+					items = append(items, setValueNode(unescape(item), typed, pos))
+				}
+			}
+			node = &YispNode{Kind: KindArray, Value: items, Attr: Attribute{Sources: []FilePos{pos}}}
+		} else {
+			node = setValueNode(unescape(value), typed, pos)
+		}
+
+		err := SetValuePath(root, key, node)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return root, nil
+}
+
+func setValueNode(value string, typed bool, pos FilePos) *YispNode {
+	if typed {
+		return ParseScalar(value, pos)
+	}
+	return &YispNode{Kind: KindString, Value: value, Attr: Attribute{Sources: []FilePos{pos}}}
+}
+
+// SetValuePath sets the value at a path like a.b[0].c below root, creating maps and sequences on the way.
+// Sequences are padded with nulls up to the index.
+func SetValuePath(root *YispNode, path string, value *YispNode) error {
+	segments, err := parseValuePath(path)
+	if err != nil {
+		return err
+	}
+
+	current := root
+	for i, segment := range segments {
+		last := i == len(segments)-1
+
+		var next *YispNode
+		if last {
+			next = value
+		} else if _, isIndex := segments[i+1].(int); isIndex {
+			next = &YispNode{Kind: KindArray, Value: []any{}, Attr: value.Attr}
+		} else {
+			next = &YispNode{Kind: KindMap, Value: NewYispMap(), Attr: value.Attr}
+		}
+
+		switch key := segment.(type) {
+		case string:
+			if current.Kind != KindMap {
+				return fmt.Errorf("invalid path %q: %s is not a map", path, key)
+			}
+			m := current.Value.(*YispMap)
+			if existing, ok := m.Get(key); ok && !last {
+				if existingNode, ok := existing.(*YispNode); ok && existingNode.Kind == next.Kind {
+					next = existingNode
+				}
+			}
+			m.Set(key, next)
+		case int:
+			if current.Kind != KindArray {
+				return fmt.Errorf("invalid path %q: index %d of something that is not a sequence", path, key)
+			}
+			items := current.Value.([]any)
+			for len(items) <= key {
+				items = append(items, &YispNode{Kind: KindNull, Attr: value.Attr})
+			}
+			if existingNode, ok := items[key].(*YispNode); ok && !last && existingNode.Kind == next.Kind {
+				next = existingNode
+			}
+			items[key] = next
+			current.Value = items
+		}
+		current = next
+	}
+	return nil
+}
+
+// parseValuePath splits a.b[0].c into map keys (strings) and sequence indexes (ints)
+func parseValuePath(path string) ([]any, error) {
+	segments := make([]any, 0)
+	for _, part := range splitUnescaped(path, '.', true) {
+		key := part
+		indexes := make([]any, 0)
+		for strings.HasSuffix(key, "]") && !strings.HasSuffix(key, `\]`) {
+			open := strings.LastIndex(key, "[")
+			if open < 0 {
+				return nil, fmt.Errorf("invalid path %q: unbalanced brackets", path)
+			}
+			index, err := strconv.Atoi(key[open+1 : len(key)-1])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid path %q: bad index %q", path, key[open+1:len(key)-1])
+			}
+			indexes = append([]any{index}, indexes...)
+			key = key[:open]
+		}
+		if key == "" && len(segments) == 0 {
+			return nil, fmt.Errorf("invalid path %q: empty key", path)
+		}
+		if key != "" {
+			segments = append(segments, unescape(key))
+		}
+		segments = append(segments, indexes...)
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("invalid path %q: empty key", path)
+	}
+	if _, ok := segments[0].(int); ok {
+		return nil, fmt.Errorf("invalid path %q: values must start with a key", path)
+	}
+	return segments, nil
+}
+
+// splitUnescaped splits s at sep, skipping escaped separators and, if braces is set, separators inside {}.
+// Escapes are kept for unescape.
+func splitUnescaped(s string, sep byte, braces bool) []string {
+	parts := make([]string, 0)
+	depth := 0
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case braces && s[i] == '{':
+			depth++
+		case braces && s[i] == '}' && depth > 0:
+			depth--
+		case s[i] == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func cutUnescaped(s string, sep byte) (string, string, bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// ParseValuesFile parses a values file. Unlike ParseYaml, keys keep their order,
+// merge keys are resolved and every node records its position, so errors can point into the file.
+func ParseValuesFile(filename string, reader io.Reader) (*YispNode, error) {
+	var document yaml.Node
+	decoder := yaml.NewDecoder(reader)
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("failed to decode YAML: %v", err)
+	}
+
+	node, err := parseValuesNode(filename, &document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %v", err)
+	}
+
+	return node, nil
+}
+
+func parseValuesNode(filename string, node *yaml.Node) (*YispNode, error) {
+	attr := Attribute{
+		Sources: []FilePos{
+			{
+				File:   filename,
+				Line:   node.Line,
+				Column: node.Column,
+			},
+		},
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return &YispNode{Kind: KindNull, Attr: attr}, nil
+		}
+		return parseValuesNode(filename, node.Content[0])
+	case yaml.AliasNode:
+		return parseValuesNode(filename, node.Alias)
+	case yaml.SequenceNode:
+		items := make([]any, len(node.Content))
+		for i, item := range node.Content {
+			itemNode, err := parseValuesNode(filename, item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = itemNode
+		}
+		return &YispNode{Kind: KindArray, Value: items, Attr: attr}, nil
+	case yaml.MappingNode:
+		m := NewYispMap()
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			valueNode, err := parseValuesNode(filename, value)
+			if err != nil {
+				return nil, err
+			}
+			if key.Tag == "!!merge" {
+				// a merge key adds the keys of the referenced maps that are not set explicitly
+				merged := []*YispNode{valueNode}
+				if valueNode.Kind == KindArray {
+					merged = merged[:0]
+					for _, item := range valueNode.Value.([]any) {
+						merged = append(merged, item.(*YispNode))
+					}
+				}
+				for _, mergedNode := range merged {
+					mergedMap, ok := mergedNode.Value.(*YispMap)
+					if !ok {
+						return nil, fmt.Errorf("line %d: merge key requires a map", key.Line)
+					}
+					for mergedKey, mergedValue := range mergedMap.AllFromFront() {
+						if _, exists := m.Get(mergedKey); !exists {
+							m.Set(mergedKey, mergedValue)
+						}
+					}
+				}
+				continue
+			}
+			m.Set(key.Value, valueNode)
+		}
+		return &YispNode{Kind: KindMap, Value: m, Attr: attr}, nil
+	default:
+		var value any
+		if err := node.Decode(&value); err != nil {
+			return nil, fmt.Errorf("line %d: %v", node.Line, err)
+		}
+		scalar, err := ParseAny(filename, value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", node.Line, err)
+		}
+		scalar.Attr = attr
+		return scalar, nil
+	}
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSetValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		typed    bool
+		expected map[string]any
+	}{
+		{"a.b=1,c=true,d=1.5,e=null,f=text", true, map[string]any{"a": map[string]any{"b": 1}, "c": true, "d": 1.5, "e": nil, "f": "text"}},
+		{"a.b=1,c=true", false, map[string]any{"a": map[string]any{"b": "1"}, "c": "true"}},
+		{"list={x,2},items[1].name=y", true, map[string]any{"list": []any{"x", 2}, "items": []any{nil, map[string]any{"name": "y"}}}},
+		{`a\.b=x\,y,c=k=v`, true, map[string]any{"a.b": "x,y", "c": "k=v"}},
+		{"a.b=1,a.c=2", true, map[string]any{"a": map[string]any{"b": 1, "c": 2}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			node, err := ParseSetValues(test.input, test.typed, FilePos{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := node.ToNative()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("expected %#v, got %#v", test.expected, got)
+			}
+		})
+	}
+
+	for _, input := range []string{"novalue", "[0]=x", "a[x]=1"} {
+		if _, err := ParseSetValues(input, true, FilePos{}); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
+
+func TestParseValuesFile(t *testing.T) {
+	src := `zeta: 1
+defaults: &defaults
+  image: nginx
+  replicas: 1
+app:
+  <<: *defaults
+  replicas: 3
+alpha: [x, y]
+`
+
+	node, err := ParseValuesFile("values.yaml", strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := node.Value.(*YispMap)
+	keys := make([]string, 0)
+	for key := range m.AllFromFront() {
+		keys = append(keys, key)
+	}
+	if !reflect.DeepEqual(keys, []string{"zeta", "defaults", "app", "alpha"}) {
+		t.Errorf("keys lost their order: %v", keys)
+	}
+
+	got, err := node.ToNative()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := got.(map[string]any)["app"]
+	if !reflect.DeepEqual(app, map[string]any{"image": "nginx", "replicas": 3}) {
+		t.Errorf("merge key not resolved: %#v", app)
+	}
+
+	alpha, _ := m.Get("alpha")
+	if line := alpha.(*YispNode).Attr.Line(); line != 8 {
+		t.Errorf("expected alpha on line 8, got %d", line)
+	}
+
+	if _, err := ParseValuesFile("values.yaml", strings.NewReader("a: 1\n<<: [1]\n")); err == nil {
+		t.Error("expected an error for a merge key of a list of scalars")
+	}
+}
@@ -0,0 +1,135 @@
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type Op string
+
+const (
+	OpAdd     Op = "add"
+	OpRemove  Op = "remove"
+	OpReplace Op = "replace"
+)
+
+// Change is a difference between two values at a JSON pointer path
+type Change struct {
+	Op   Op     `json:"op"`
+	Path string `json:"path"`
+	From any    `json:"from,omitempty"`
+	To   any    `json:"to,omitempty"`
+	// Comment marks a change of the comments attached to the node at Path rather than its value
+	Comment bool `json:"comment,omitempty"`
+}
+
+func (c Change) String() string {
+	path := c.Path
+	if path == "" {
+		path = "(root)"
+	}
+	if c.Comment {
+		path += " (comment)"
+	}
+	switch c.Op {
+	case OpAdd:
+		return fmt.Sprintf("+ %s: %s", path, Format(c.To))
+	case OpRemove:
+		return fmt.Sprintf("- %s: %s", path, Format(c.From))
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", path, Format(c.From), Format(c.To))
+	}
+}
+
+// Values compares two decoded YAML or JSON values structurally.
+// Maps are compared key by key and sequences index by index; the changes turn from into to.
+func Values(from, to any) []Change {
+	changes := make([]Change, 0)
+	compare("", from, to, &changes)
+	return changes
+}
+
+func compare(path string, from, to any, changes *[]Change) {
+	switch f := from.(type) {
+	case map[string]any:
+		t, ok := to.(map[string]any)
+		if !ok {
+			break
+		}
+		for _, key := range sortedKeys(f) {
+			if tv, ok := t[key]; ok {
+				compare(path+"/"+EscapePointer(key), f[key], tv, changes)
+			} else {
+				*changes = append(*changes, Change{Op: OpRemove, Path: path + "/" + EscapePointer(key), From: f[key]})
+			}
+		}
+		for _, key := range sortedKeys(t) {
+			if _, ok := f[key]; !ok {
+				*changes = append(*changes, Change{Op: OpAdd, Path: path + "/" + EscapePointer(key), To: t[key]})
+			}
+		}
+		return
+	case []any:
+		t, ok := to.([]any)
+		if !ok {
+			break
+		}
+		for i := range max(len(f), len(t)) {
+			itemPath := path + "/" + strconv.Itoa(i)
+			switch {
+			case i >= len(t):
+				*changes = append(*changes, Change{Op: OpRemove, Path: itemPath, From: f[i]})
+			case i >= len(f):
+				*changes = append(*changes, Change{Op: OpAdd, Path: itemPath, To: t[i]})
+			default:
+				compare(itemPath, f[i], t[i], changes)
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		*changes = append(*changes, Change{Op: OpReplace, Path: path, From: from, To: to})
+	}
+}
+
+// EscapePointer escapes a map key for use as a JSON pointer token (RFC 6901)
+func EscapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+// Format renders a value compactly for diff output
+func Format(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(v)
+	case map[string]any:
+		parts := make([]string, 0, len(v))
+		for _, key := range sortedKeys(v) {
+			parts = append(parts, key+": "+Format(v[key]))
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, Format(item))
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,216 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/totegamma/yisp/internal/yaml"
+)
+
+// ID identifies a Kubernetes manifest, like lib.getManifestID does for yisp nodes
+type ID struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name,omitempty"`
+}
+
+func (id ID) String() string {
+	if id.Namespace != "" {
+		return fmt.Sprintf("%s/%s/%s/%s", id.APIVersion, id.Kind, id.Namespace, id.Name)
+	}
+	return fmt.Sprintf("%s/%s/%s", id.APIVersion, id.Kind, id.Name)
+}
+
+// IsZero reports whether the document has no identity, i.e. it is not a manifest
+func (id ID) IsZero() bool {
+	return id == ID{}
+}
+
+// IdentityOf reads the apiVersion, kind, namespace and name of a decoded document
+func IdentityOf(document any) ID {
+	var id ID
+	m, ok := document.(map[string]any)
+	if !ok {
+		return id
+	}
+	id.APIVersion, _ = m["apiVersion"].(string)
+	id.Kind, _ = m["kind"].(string)
+	if metadata, ok := m["metadata"].(map[string]any); ok {
+		id.Namespace, _ = metadata["namespace"].(string)
+		id.Name, _ = metadata["name"].(string)
+	}
+	return id
+}
+
+// DocumentChange is a document that was added, removed or changed between two document streams
+type DocumentChange struct {
+	Op Op `json:"op"`
+	ID ID `json:"id"`
+	// Index is the position of the document in the stream it was taken from
+	Index int `json:"index"`
+	// From is the removed document, To the added one
+	From    any      `json:"from,omitempty"`
+	To      any      `json:"to,omitempty"`
+	Changes []Change `json:"changes,omitempty"`
+}
+
+func (c DocumentChange) String() string {
+	name := c.ID.String()
+	if c.ID.IsZero() {
+		name = fmt.Sprintf("document %d", c.Index)
+	}
+	switch c.Op {
+	case OpAdd:
+		return "+ " + name
+	case OpRemove:
+		return "- " + name
+	default:
+		return "~ " + name
+	}
+}
+
+// Documents compares two streams of decoded documents.
+// Documents are paired by their identity rather than their position, so reordering manifests is not a change.
+// Documents sharing an identity, and documents without one, are paired in the order they appear.
+func Documents(from, to []any) []DocumentChange {
+	return documents(from, to, func(i, j int) []Change {
+		return Values(from[i], to[j])
+	})
+}
+
+// DocumentsWithComments is Documents that also reports changed comments, as returned by DecodeDocumentsWithComments
+func DocumentsWithComments(from, to []any, fromComments, toComments []map[string]string) []DocumentChange {
+	return documents(from, to, func(i, j int) []Change {
+		changes := Values(from[i], to[j])
+		return append(changes, compareComments(fromComments[i], toComments[j])...)
+	})
+}
+
+func documents(from, to []any, compare func(i, j int) []Change) []DocumentChange {
+	unpaired := make(map[ID][]int)
+	for i, document := range to {
+		id := IdentityOf(document)
+		unpaired[id] = append(unpaired[id], i)
+	}
+
+	changes := make([]DocumentChange, 0)
+	paired := make([]bool, len(to))
+	for i, document := range from {
+		id := IdentityOf(document)
+		candidates := unpaired[id]
+		if len(candidates) == 0 {
+			changes = append(changes, DocumentChange{Op: OpRemove, ID: id, Index: i, From: document})
+			continue
+		}
+		j := candidates[0]
+		unpaired[id] = candidates[1:]
+		paired[j] = true
+
+		fieldChanges := compare(i, j)
+		if len(fieldChanges) > 0 {
+			changes = append(changes, DocumentChange{Op: OpReplace, ID: id, Index: j, Changes: fieldChanges})
+		}
+	}
+
+	for j, document := range to {
+		if !paired[j] {
+			changes = append(changes, DocumentChange{Op: OpAdd, ID: IdentityOf(document), Index: j, To: document})
+		}
+	}
+	return changes
+}
+
+func compareComments(from, to map[string]string) []Change {
+	paths := make(map[string]any)
+	for path := range from {
+		paths[path] = nil
+	}
+	for path := range to {
+		paths[path] = nil
+	}
+
+	changes := make([]Change, 0)
+	for _, path := range sortedKeys(paths) {
+		fromComment, inFrom := from[path]
+		toComment, inTo := to[path]
+		switch {
+		case !inTo:
+			changes = append(changes, Change{Op: OpRemove, Path: path, From: fromComment, Comment: true})
+		case !inFrom:
+			changes = append(changes, Change{Op: OpAdd, Path: path, To: toComment, Comment: true})
+		case fromComment != toComment:
+			changes = append(changes, Change{Op: OpReplace, Path: path, From: fromComment, To: toComment, Comment: true})
+		}
+	}
+	return changes
+}
+
+// DecodeDocuments decodes every document of a YAML stream, so that outputs compare semantically.
+// Empty documents are skipped.
+func DecodeDocuments(r io.Reader) ([]any, error) {
+	documents, _, err := DecodeDocumentsWithComments(r)
+	return documents, err
+}
+
+// DecodeDocumentsWithComments is DecodeDocuments that also collects the comments of every document,
+// keyed by the JSON pointer path of the node they are attached to
+func DecodeDocumentsWithComments(r io.Reader) ([]any, []map[string]string, error) {
+	decoder := yaml.NewDecoder(r)
+
+	documents := make([]any, 0)
+	comments := make([]map[string]string, 0)
+	for {
+		var node yaml.Node
+		err := decoder.Decode(&node)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, nil, err
+		}
+
+		var document any
+		err = node.Decode(&document)
+		if err != nil {
+			return nil, nil, err
+		}
+		if document == nil {
+			continue
+		}
+		documents = append(documents, document)
+
+		documentComments := make(map[string]string)
+		collectComments("", &node, documentComments)
+		comments = append(comments, documentComments)
+	}
+	return documents, comments, nil
+}
+
+func collectComments(path string, node *yaml.Node, comments map[string]string, extra ...string) {
+	parts := append(extra, node.HeadComment, node.LineComment, node.FootComment)
+	comment := strings.Join(slices.DeleteFunc(parts, func(s string) bool { return s == "" }), "\n")
+	if comment != "" {
+		comments[path] = comment
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			collectComments(path, child, comments)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			collectComments(path+"/"+EscapePointer(key.Value), value, comments, key.HeadComment, key.LineComment, key.FootComment)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			collectComments(path+"/"+strconv.Itoa(i), child, comments)
+		}
+	}
+}
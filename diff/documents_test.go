@@ -0,0 +1,60 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDocuments(t *testing.T) {
+	from, err := DecodeDocuments(strings.NewReader(`
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: a, namespace: default}
+data: {x: "1"}
+---
+apiVersion: v1
+kind: Service
+metadata: {name: old}
+---
+plain: 1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := DecodeDocuments(strings.NewReader(`
+plain: 2
+---
+apiVersion: v1
+kind: Secret
+metadata: {name: new}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: a, namespace: default}
+data: {x: "1", y/z: "2"}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := Documents(from, to)
+	lines := make([]string, 0)
+	for _, change := range changes {
+		lines = append(lines, change.String())
+		for _, fieldChange := range change.Changes {
+			lines = append(lines, "  "+fieldChange.String())
+		}
+	}
+
+	expected := []string{
+		`~ v1/ConfigMap/default/a`,
+		`  + /data/y~1z: "2"`,
+		`- v1/Service/old`,
+		`~ document 0`,
+		`  ~ /plain: 1 -> 2`,
+		`+ v1/Secret/new`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected changes:\n%s\nexpected:\n%s", strings.Join(lines, "\n"), strings.Join(expected, "\n"))
+	}
+}
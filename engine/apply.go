@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/bmatcuk/doublestar/v4"
@@ -35,7 +36,14 @@ func (e *engine) Apply(car *core.YispNode, cdr []*core.YispNode, env *core.Env,
 			newEnv.Vars[lambda.Arguments[i].Name] = node
 		}
 
-		return e.Eval(lambda.Body, newEnv, mode)
+		if e.coverage != nil {
+			e.coverage.hitFunction(car)
+		}
+
+		e.enter(FrameKindLambda, lambdaName(car, lambda), car)
+		result, err := e.Eval(lambda.Body, newEnv, mode)
+		e.exit(FrameKindLambda, err)
+		return result, err
 
 	case core.KindString:
 		op, ok := car.Value.(string)
@@ -51,7 +59,10 @@ func (e *engine) Apply(car *core.YispNode, cdr []*core.YispNode, env *core.Env,
 			}
 
 			// Call the operator function with the arguments
-			return fn(cdr, env.CreateChild(), mode, e)
+			e.enter(FrameKindOperator, op, car)
+			result, err := fn(cdr, env.CreateChild(), mode, e)
+			e.exit(FrameKindOperator, err)
+			return result, err
 
 		} else { // built-in operator
 			fn, ok := operators[op]
@@ -60,7 +71,10 @@ func (e *engine) Apply(car *core.YispNode, cdr []*core.YispNode, env *core.Env,
 			}
 
 			// Call the operator function with the arguments
-			return fn(cdr, env.CreateChild(), mode, e)
+			e.enter(FrameKindOperator, op, car)
+			result, err := fn(cdr, env.CreateChild(), mode, e)
+			e.exit(FrameKindOperator, err)
+			return result, err
 		}
 
 	default:
@@ -68,6 +82,14 @@ func (e *engine) Apply(car *core.YispNode, cdr []*core.YispNode, env *core.Env,
 	}
 }
 
+// lambdaName names a lambda by its anchor, or by its definition site if it has none
+func lambdaName(node *core.YispNode, lambda *core.Lambda) string {
+	if lambda.Name != "" {
+		return lambda.Name
+	}
+	return fmt.Sprintf("(anonymous) %s:%d", node.Attr.File(), node.Attr.Line())
+}
+
 // operators is a map of operator names to their implementations
 var operators = make(map[string]core.YispOperator)
 
@@ -329,13 +351,14 @@ func opNot(cdr []*core.YispNode, env *core.Env, mode core.EvalMode, e core.Engin
 	}, nil
 }
 
-// opInclude includes files
+// opInclude includes files. An entry is a path or glob, or a map {path: ..., format: ...}
+// that reads the files in the given format regardless of their extension.
 func opInclude(cdr []*core.YispNode, env *core.Env, mode core.EvalMode, e core.Engine) (*core.YispNode, error) {
 	results := make([]any, 0)
 	for _, node := range cdr {
-		entry, ok := node.Value.(string)
-		if !ok {
-			return nil, core.NewEvaluationError(node, fmt.Sprintf("invalid path type: %T", node.Value))
+		entry, format, err := fileEntry(node, "include")
+		if err != nil {
+			return nil, err
 		}
 
 		if after, ok := strings.CutPrefix(entry, "./"); ok {
@@ -348,6 +371,7 @@ func opInclude(cdr []*core.YispNode, env *core.Env, mode core.EvalMode, e core.E
 		if err != nil {
 			return nil, core.NewEvaluationError(node, fmt.Sprintf("failed to glob path: %s", entry))
 		}
+		core.RecordGlob(e, filepath.Dir(node.Attr.File()), entry)
 
 		if len(paths) == 0 {
 			paths = []string{entry}
@@ -362,7 +386,15 @@ func opInclude(cdr []*core.YispNode, env *core.Env, mode core.EvalMode, e core.E
 				continue
 			}
 
-			evaluated, err := core.CallEngineByPath(path, node.Attr.File(), core.NewEnv(), e)
+			// data files are not run by the engine, so this is the only frame they get
+			eng, traced := e.(*engine)
+			if traced {
+				eng.enter(FrameKindInclude, includedFile, node)
+			}
+			evaluated, err := core.CallEngineByPathWithFormat(path, node.Attr.File(), format, core.NewEnv(), e)
+			if traced {
+				eng.exit(FrameKindInclude, err)
+			}
 			if err != nil {
 				return nil, core.NewEvaluationErrorWithParent(node, fmt.Sprintf("failed to include file: %s", path), err)
 			}
@@ -395,6 +427,47 @@ func opInclude(cdr []*core.YispNode, env *core.Env, mode core.EvalMode, e core.E
 	}, nil
 }
 
+// fileEntry reads an entry of include or import: a path, or a map {path: ..., format: ...}
+func fileEntry(node *core.YispNode, op string) (string, string, error) {
+	if node.Kind != core.KindMap {
+		entry, ok := node.Value.(string)
+		if !ok {
+			return "", "", core.NewEvaluationError(node, fmt.Sprintf("invalid path type: %T", node.Value))
+		}
+		return entry, "", nil
+	}
+
+	m, ok := node.Value.(*core.YispMap)
+	if !ok {
+		return "", "", core.NewEvaluationError(node, fmt.Sprintf("invalid map value: %T", node.Value))
+	}
+
+	fields := make(map[string]string, 2)
+	for _, key := range []string{"path", "format"} {
+		value, ok := m.Get(key)
+		if !ok {
+			continue
+		}
+		valueNode, ok := value.(*core.YispNode)
+		if !ok {
+			return "", "", core.NewEvaluationError(node, fmt.Sprintf("invalid %s type: %T", key, value))
+		}
+		fields[key], ok = valueNode.Value.(string)
+		if !ok {
+			return "", "", core.NewEvaluationError(valueNode, fmt.Sprintf("invalid %s type: %T", key, valueNode.Value))
+		}
+	}
+	if fields["path"] == "" {
+		return "", "", core.NewEvaluationError(node, op+" entry requires a path")
+	}
+	if fields["format"] != "" {
+		if _, err := core.FormatExtension(fields["format"]); err != nil {
+			return "", "", core.NewEvaluationError(node, err.Error())
+		}
+	}
+	return fields["path"], fields["format"], nil
+}
+
 func opProgn(cdr []*core.YispNode, env *core.Env, mode core.EvalMode, e core.Engine) (*core.YispNode, error) {
 	return cdr[len(cdr)-1], nil
 }
@@ -437,6 +510,7 @@ func opSchema(cdr []*core.YispNode, env *core.Env, mode core.EvalMode, e core.En
 	if err != nil {
 		return nil, core.NewEvaluationErrorWithParent(node, "failed to unmarshal schema", err)
 	}
+	schema.SetRegistry(core.SchemaRegistryOf(e))
 
 	return &core.YispNode{
 		Kind:  core.KindType,
@@ -445,3 +519,16 @@ func opSchema(cdr []*core.YispNode, env *core.Env, mode core.EvalMode, e core.En
 	}, nil
 
 }
+
+// specialForms are evaluated by Eval itself rather than through the operators map
+var specialForms = []string{"if", "lambda", "import", "deftest", "assert", "assert-equal", "assert-error"}
+
+// OperatorNames returns the names of built-in operators and special forms, sorted
+func OperatorNames() []string {
+	names := slices.Clone(specialForms)
+	for name := range operators {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,225 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/totegamma/yisp/core"
+)
+
+// BuildCache stores the rendered output of entry files together with the hashes of everything read to render them,
+// so that a build can be skipped when nothing changed. There is one entry per entry file.
+type BuildCache struct {
+	dir     string
+	schemas core.SchemaRegistry
+}
+
+type buildCacheEntry struct {
+	Path   string                   `json:"path"`
+	Key    string                   `json:"key"`
+	Files  map[string]string        `json:"files"`
+	Dirs   map[string]buildCacheDir `json:"dirs"`
+	Inputs []Input                  `json:"inputs"`
+	Output string                   `json:"output"`
+}
+
+type buildCacheDir struct {
+	Recursive bool   `json:"recursive"`
+	Hash      string `json:"hash"`
+}
+
+// NewBuildCache returns a cache storing its entries in dir.
+// Schemas recorded by builds are looked up in schemas again to check whether they changed.
+func NewBuildCache(dir string, schemas core.SchemaRegistry) *BuildCache {
+	return &BuildCache{dir: dir, schemas: schemas}
+}
+
+// Get returns the cached output of the entry file at path if it was rendered with the same key,
+// e.g. a hash of the options and the yisp version, and none of the files and inputs it read changed
+func (c *BuildCache) Get(path, key string) (string, bool) {
+	data, err := os.ReadFile(c.entryPath(path))
+	if err != nil {
+		return "", false
+	}
+
+	var entry buildCacheEntry
+	err = json.Unmarshal(data, &entry)
+	if err != nil || entry.Path != path || entry.Key != key {
+		return "", false
+	}
+
+	for file, hash := range entry.Files {
+		if hashFile(file) != hash {
+			return "", false
+		}
+	}
+	for dir, listing := range entry.Dirs {
+		if hashDir(dir, listing.Recursive) != listing.Hash {
+			return "", false
+		}
+	}
+	for _, input := range entry.Inputs {
+		current, ok := c.hashInput(input)
+		if !ok || current != input.Hash {
+			return "", false
+		}
+	}
+
+	return entry.Output, true
+}
+
+// Put stores the output of the entry file at path with the dependencies recorded while rendering it.
+// Nothing is stored if the dependencies are volatile or a file changed after the build started,
+// since the output could not be reproduced from the current state of the inputs.
+func (c *BuildCache) Put(path, key string, deps *Dependencies, output string, started time.Time) error {
+	if len(deps.Volatile()) > 0 {
+		return nil
+	}
+
+	entry := buildCacheEntry{
+		Path:   path,
+		Key:    key,
+		Files:  make(map[string]string),
+		Dirs:   make(map[string]buildCacheDir),
+		Inputs: deps.Inputs(),
+		Output: output,
+	}
+	for _, file := range deps.Files() {
+		stat, err := os.Stat(file)
+		if err == nil && stat.ModTime().After(started) {
+			return nil
+		}
+		entry.Files[file] = hashFile(file)
+	}
+	for dir, recursive := range deps.Dirs() {
+		entry.Dirs[dir] = buildCacheDir{Recursive: recursive, Hash: hashDir(dir, recursive)}
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(c.dir, 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.dir, ".entry-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.entryPath(path))
+}
+
+// Clean removes all cached builds
+func (c *BuildCache) Clean() error {
+	err := os.RemoveAll(c.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (c *BuildCache) entryPath(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// hashFile returns the hash of a file, or an empty string if it cannot be read
+func hashFile(path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return hashContent(content)
+}
+
+// hashDir returns the hash of the names in a directory, or an empty string if it cannot be read.
+// Only names are hashed, since the content of matched files is recorded separately.
+func hashDir(dir string, recursive bool) string {
+	names := make([]string, 0)
+	if recursive {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				rel += "/"
+			}
+			names = append(names, rel)
+			return nil
+		})
+		if err != nil {
+			return ""
+		}
+	} else {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return ""
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() {
+				name += "/"
+			}
+			names = append(names, name)
+		}
+	}
+	return hashContent([]byte(strings.Join(names, "\n")))
+}
+
+// hashInput reads an input again and returns the hash of its current content
+func (c *BuildCache) hashInput(input Input) (string, bool) {
+	switch input.Kind {
+	case core.InputRemote:
+		content, err := core.FetchRemote(input.Name)
+		if err != nil {
+			return "", false
+		}
+		return hashContent(content), true
+	case core.InputEnv:
+		value, ok := os.LookupEnv(input.Name)
+		if !ok {
+			return "", true
+		}
+		return hashContent([]byte(value)), true
+	case core.InputSchemaURL:
+		if c.schemas == nil {
+			return "", false
+		}
+		schema, _ := c.schemas.SchemaByURL(input.Name)
+		return hashContent(schemaContent(schema)), true
+	case core.InputSchemaGVK:
+		gvk := strings.SplitN(input.Name, "/", 3)
+		if len(gvk) != 3 {
+			return "", false
+		}
+		if c.schemas == nil {
+			return "", false
+		}
+		schema, _ := c.schemas.SchemaByGVK(gvk[0], gvk[1], gvk[2])
+		return hashContent(schemaContent(schema)), true
+	default:
+		return "", false
+	}
+}
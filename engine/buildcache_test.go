@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/totegamma/yisp/core"
+)
+
+func TestBuildCache(t *testing.T) {
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "index.yisp")
+	write := func(name, content string) {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("Error writing test file: %v", err)
+		}
+	}
+	write("index.yisp", "!yisp\n- include\n- ./parts/*.yaml\n")
+	os.Mkdir(filepath.Join(dir, "parts"), 0755)
+	write("parts/a.yaml", "a: 1\n")
+
+	cache := NewBuildCache(filepath.Join(t.TempDir(), "builds"), nil)
+	build := func() {
+		deps := NewDependencies()
+		e := NewEngine(Options{AllowUntypedManifest: true, Dependencies: deps})
+		started := time.Now()
+		output, err := e.EvaluateFileToYaml(path)
+		if err != nil {
+			t.Fatalf("Error evaluating file: %v", err)
+		}
+		err = cache.Put(path, "key", deps, output, started)
+		if err != nil {
+			t.Fatalf("Error writing cache: %v", err)
+		}
+	}
+
+	_, ok := cache.Get(path, "key")
+	assert.False(t, ok)
+
+	build()
+	output, ok := cache.Get(path, "key")
+	assert.True(t, ok)
+	assert.Equal(t, "a: 1\n", output)
+
+	_, ok = cache.Get(path, "other")
+	assert.False(t, ok, "a different key is a miss")
+
+	write("parts/a.yaml", "a: 2\n")
+	_, ok = cache.Get(path, "key")
+	assert.False(t, ok, "a changed file is a miss")
+
+	build()
+	write("parts/b.yaml", "b: 3\n")
+	_, ok = cache.Get(path, "key")
+	assert.False(t, ok, "a new file in a globbed directory is a miss")
+
+	deps := NewDependencies()
+	deps.AddVolatile("exec.cmd")
+	err := cache.Put(path, "volatile", deps, "output", time.Now())
+	assert.NoError(t, err)
+	_, ok = cache.Get(path, "volatile")
+	assert.False(t, ok, "volatile builds are not cached")
+
+	assert.NoError(t, cache.Clean())
+	_, ok = cache.Get(path, "key")
+	assert.False(t, ok)
+}
+
+func TestBuildCacheReferencedSchema(t *testing.T) {
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "index.yisp")
+	err := os.WriteFile(path, []byte("apiVersion: v1\nkind: Pod\nspec:\n  image: nginx\n"), 0644)
+	if err != nil {
+		t.Fatalf("Error writing test file: %v", err)
+	}
+
+	schemaDir := t.TempDir()
+	write := func(name, content string) {
+		err := os.MkdirAll(filepath.Dir(filepath.Join(schemaDir, name)), 0755)
+		if err == nil {
+			err = os.WriteFile(filepath.Join(schemaDir, name), []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatalf("Error writing schema: %v", err)
+		}
+	}
+	write("gvk/_v1_Pod.txt", "io.k8s.api.core.v1.Pod")
+	write("schemas/io.k8s.api.core.v1.Pod.json", `{"type": "object", "properties": {
+		"apiVersion": {"type": "string"}, "kind": {"type": "string"},
+		"spec": {"$ref": "#/definitions/io.k8s.api.core.v1.PodSpec"}}}`)
+	write("schemas/io.k8s.api.core.v1.PodSpec.json", `{"type": "object", "properties": {"image": {"type": "string"}}}`)
+
+	cacheDir := filepath.Join(t.TempDir(), "builds")
+	// every build and lookup is a new process, with the schemas as they are cached at that time
+	registry := func() core.SchemaRegistry {
+		return core.NewCachedSchemaRegistry(core.NewDirSchemaRegistry(schemaDir))
+	}
+
+	deps := NewDependencies()
+	e := NewEngine(Options{Dependencies: deps, SchemaRegistry: registry()})
+	started := time.Now()
+	output, err := e.EvaluateFileToYaml(path)
+	if err != nil {
+		t.Fatalf("Error evaluating file: %v", err)
+	}
+	err = NewBuildCache(cacheDir, registry()).Put(path, "key", deps, output, started)
+	if err != nil {
+		t.Fatalf("Error writing cache: %v", err)
+	}
+
+	_, ok := NewBuildCache(cacheDir, registry()).Get(path, "key")
+	assert.True(t, ok)
+
+	write("schemas/io.k8s.api.core.v1.PodSpec.json", `{"type": "object", "properties": {"image": {"type": "integer"}}}`)
+	_, ok = NewBuildCache(cacheDir, registry()).Get(path, "key")
+	assert.False(t, ok, "a changed referenced schema is a miss")
+}
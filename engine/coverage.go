@@ -0,0 +1,272 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/totegamma/yisp/core"
+)
+
+// Coverage records which parsed nodes are evaluated: every source line, every lambda and both branches of every if.
+// Files are registered when they are parsed, so that code that never runs is reported too.
+// A Coverage can be shared by several engines and written as an lcov tracefile.
+type Coverage struct {
+	mu    sync.Mutex
+	files map[string]*fileCoverage
+}
+
+type fileCoverage struct {
+	lines     map[int]int
+	functions map[core.FilePos]*coveredFunction
+	branches  map[core.FilePos]*coveredBranch
+}
+
+type coveredFunction struct {
+	name string
+	line int
+	hits int
+}
+
+type coveredBranch struct {
+	line      int
+	evaluated bool
+	taken     [2]int // then, else
+}
+
+func NewCoverage() *Coverage {
+	return &Coverage{
+		files: make(map[string]*fileCoverage),
+	}
+}
+
+func (c *Coverage) file(name string) *fileCoverage {
+	f, ok := c.files[name]
+	if !ok {
+		f = &fileCoverage{
+			lines:     make(map[int]int),
+			functions: make(map[core.FilePos]*coveredFunction),
+			branches:  make(map[core.FilePos]*coveredBranch),
+		}
+		c.files[name] = f
+	}
+	return f
+}
+
+// register adds the lines, lambdas and if forms of a parsed document
+func (c *Coverage) register(node *core.YispNode) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.registerNode(node, false)
+}
+
+func (c *Coverage) registerNode(node *core.YispNode, evaluated bool) {
+	switch node.Tag {
+	case "!yisp":
+		evaluated = true
+	case "!quote":
+		evaluated = false
+	}
+
+	if len(node.Attr.Sources) == 0 {
+		return
+	}
+	pos := node.Attr.Sources[0]
+	f := c.file(pos.File)
+	if _, ok := f.lines[pos.Line]; !ok {
+		f.lines[pos.Line] = 0
+	}
+
+	switch node.Kind {
+	case core.KindArray:
+		items, _ := node.Value.([]any)
+		if evaluated && len(items) > 0 {
+			if head, ok := items[0].(*core.YispNode); ok {
+				// the parts of special forms that are never evaluated themselves are not counted as lines
+				switch head.Value {
+				case "import":
+					items = nil
+				case "lambda", "deftest":
+					items = items[min(2, len(items)):]
+				case "if", "assert", "assert-equal", "assert-error":
+					items = items[1:]
+				}
+
+				switch head.Value {
+				case "lambda":
+					if _, ok := f.functions[pos]; !ok {
+						name := node.Anchor
+						if name == "" {
+							name = fmt.Sprintf("(anonymous):%d:%d", pos.Line, pos.Column)
+						}
+						f.functions[pos] = &coveredFunction{name: name, line: pos.Line}
+					}
+				case "if":
+					if _, ok := f.branches[pos]; !ok {
+						f.branches[pos] = &coveredBranch{line: pos.Line}
+					}
+				}
+			}
+		}
+		for _, item := range items {
+			if itemNode, ok := item.(*core.YispNode); ok {
+				c.registerNode(itemNode, evaluated)
+			}
+		}
+	case core.KindMap:
+		m, ok := node.Value.(*core.YispMap)
+		if !ok {
+			return
+		}
+		for _, item := range m.AllFromFront() {
+			if itemNode, ok := item.(*core.YispNode); ok {
+				c.registerNode(itemNode, evaluated)
+			}
+		}
+	}
+}
+
+// hitLine records the evaluation of a node
+func (c *Coverage) hitLine(node *core.YispNode) {
+	if len(node.Attr.Sources) == 0 {
+		return
+	}
+	pos := node.Attr.Sources[0]
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, ok := c.files[pos.File]
+	if !ok {
+		return
+	}
+	if hits, ok := f.lines[pos.Line]; ok {
+		f.lines[pos.Line] = hits + 1
+	}
+}
+
+// hitFunction records a call of the lambda defined at node
+func (c *Coverage) hitFunction(node *core.YispNode) {
+	if len(node.Attr.Sources) == 0 {
+		return
+	}
+	pos := node.Attr.Sources[0]
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f, ok := c.files[pos.File]; ok {
+		if fn, ok := f.functions[pos]; ok {
+			fn.hits++
+		}
+	}
+}
+
+// hitBranch records which branch of the if form at node was taken
+func (c *Coverage) hitBranch(node *core.YispNode, taken bool) {
+	if len(node.Attr.Sources) == 0 {
+		return
+	}
+	pos := node.Attr.Sources[0]
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f, ok := c.files[pos.File]; ok {
+		if branch, ok := f.branches[pos]; ok {
+			branch.evaluated = true
+			if taken {
+				branch.taken[0]++
+			} else {
+				branch.taken[1]++
+			}
+		}
+	}
+}
+
+// WriteLcov writes the coverage as an lcov tracefile
+func (c *Coverage) WriteLcov(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	files := make([]string, 0, len(c.files))
+	for name := range c.files {
+		files = append(files, name)
+	}
+	slices.Sort(files)
+
+	for _, name := range files {
+		f := c.files[name]
+		fmt.Fprintf(bw, "TN:\nSF:%s\n", name)
+
+		functions := make([]*coveredFunction, 0, len(f.functions))
+		for _, fn := range f.functions {
+			functions = append(functions, fn)
+		}
+		slices.SortFunc(functions, func(a, b *coveredFunction) int {
+			if a.line != b.line {
+				return a.line - b.line
+			}
+			if a.name < b.name {
+				return -1
+			}
+			if a.name > b.name {
+				return 1
+			}
+			return 0
+		})
+		hitFunctions := 0
+		for _, fn := range functions {
+			fmt.Fprintf(bw, "FN:%d,%s\n", fn.line, fn.name)
+		}
+		for _, fn := range functions {
+			fmt.Fprintf(bw, "FNDA:%d,%s\n", fn.hits, fn.name)
+			if fn.hits > 0 {
+				hitFunctions++
+			}
+		}
+		fmt.Fprintf(bw, "FNF:%d\nFNH:%d\n", len(functions), hitFunctions)
+
+		positions := make([]core.FilePos, 0, len(f.branches))
+		for pos := range f.branches {
+			positions = append(positions, pos)
+		}
+		slices.SortFunc(positions, func(a, b core.FilePos) int {
+			if a.Line != b.Line {
+				return a.Line - b.Line
+			}
+			return a.Column - b.Column
+		})
+		hitBranches := 0
+		for block, pos := range positions {
+			branch := f.branches[pos]
+			for i, taken := range branch.taken {
+				if !branch.evaluated {
+					fmt.Fprintf(bw, "BRDA:%d,%d,%d,-\n", branch.line, block, i)
+					continue
+				}
+				fmt.Fprintf(bw, "BRDA:%d,%d,%d,%d\n", branch.line, block, i, taken)
+				if taken > 0 {
+					hitBranches++
+				}
+			}
+		}
+		fmt.Fprintf(bw, "BRF:%d\nBRH:%d\n", len(positions)*2, hitBranches)
+
+		lines := make([]int, 0, len(f.lines))
+		for line := range f.lines {
+			lines = append(lines, line)
+		}
+		slices.Sort(lines)
+		hitLines := 0
+		for _, line := range lines {
+			fmt.Fprintf(bw, "DA:%d,%d\n", line, f.lines[line])
+			if f.lines[line] > 0 {
+				hitLines++
+			}
+		}
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", len(lines), hitLines)
+	}
+
+	return bw.Flush()
+}
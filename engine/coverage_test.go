@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoverage(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "cov.yisp")
+	err := os.WriteFile(path, []byte(`!yisp &pick
+- lambda
+- [flag]
+- - if
+  - *flag
+  - "yes"
+  - "no"
+---
+value: !yisp [*pick, true]
+`), 0644)
+	if err != nil {
+		t.Fatalf("Error writing test file: %v", err)
+	}
+
+	coverage := NewCoverage()
+	e := NewEngine(Options{AllowUntypedManifest: true, Coverage: coverage})
+	_, err = e.EvaluateFileToYaml(path)
+	if err != nil {
+		t.Fatalf("Error evaluating file: %v", err)
+	}
+
+	var report strings.Builder
+	err = coverage.WriteLcov(&report)
+	if err != nil {
+		t.Fatalf("Error writing lcov: %v", err)
+	}
+
+	assert.Equal(t, `TN:
+SF:`+path+`
+FN:1,pick
+FNDA:1,pick
+FNF:1
+FNH:1
+BRDA:4,0,0,1
+BRDA:4,0,1,0
+BRF:2
+BRH:1
+DA:1,1
+DA:4,1
+DA:5,1
+DA:6,1
+DA:7,0
+DA:8,1
+DA:9,3
+LF:7
+LH:6
+end_of_record
+`, report.String())
+}
@@ -0,0 +1,213 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/totegamma/yisp/core"
+)
+
+// Dependencies records what was read while evaluating: entry files, includes, imports, the files and directories
+// of files.read, files.glob and env.load-dotenv, and inputs that are not local files, like remote content,
+// environment variables and schemas.
+// A Dependencies can be shared by several engines.
+type Dependencies struct {
+	mu       sync.Mutex
+	files    map[string]struct{}
+	dirs     map[string]bool
+	inputs   map[string]Input
+	volatile []string
+}
+
+// Input is something other than a local file that was read, with the hash of its content.
+// The hash is empty if the input did not exist.
+type Input struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+}
+
+func NewDependencies() *Dependencies {
+	return &Dependencies{
+		files:  make(map[string]struct{}),
+		dirs:   make(map[string]bool),
+		inputs: make(map[string]Input),
+	}
+}
+
+// AddFile records a file that was read, e.g. a values file read outside of the engine
+func (d *Dependencies) AddFile(path string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.files[absPath(path)] = struct{}{}
+}
+
+// AddDir records a directory that was listed, including its subdirectories if recursive
+func (d *Dependencies) AddDir(path string, recursive bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	path = absPath(path)
+	d.dirs[path] = d.dirs[path] || recursive
+}
+
+// AddInput records an input other than a local file. Nil content means the input did not exist.
+func (d *Dependencies) AddInput(kind, name string, content []byte) {
+	d.addInput(Input{Kind: kind, Name: name, Hash: hashContent(content)})
+}
+
+func (d *Dependencies) addInput(input Input) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.inputs[input.Kind+"\x00"+input.Name] = input
+}
+
+// AddVolatile records that the result depends on something that cannot be tracked
+func (d *Dependencies) AddVolatile(reason string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !slices.Contains(d.volatile, reason) {
+		d.volatile = append(d.volatile, reason)
+	}
+}
+
+// Merge adds the dependencies of other
+func (d *Dependencies) Merge(other *Dependencies) {
+	for _, file := range other.Files() {
+		d.AddFile(file)
+	}
+	for dir, recursive := range other.Dirs() {
+		d.AddDir(dir, recursive)
+	}
+	for _, input := range other.Inputs() {
+		d.addInput(input)
+	}
+	for _, reason := range other.Volatile() {
+		d.AddVolatile(reason)
+	}
+}
+
+// Files returns the absolute paths of the files read, in sorted order
+func (d *Dependencies) Files() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	files := make([]string, 0, len(d.files))
+	for file := range d.files {
+		files = append(files, file)
+	}
+	slices.Sort(files)
+	return files
+}
+
+// Dirs returns the absolute paths of the directories listed, mapped to whether their subdirectories were listed too
+func (d *Dependencies) Dirs() map[string]bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dirs := make(map[string]bool, len(d.dirs))
+	for dir, recursive := range d.dirs {
+		dirs[dir] = recursive
+	}
+	return dirs
+}
+
+// Inputs returns the inputs other than local files, sorted by kind and name
+func (d *Dependencies) Inputs() []Input {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	inputs := make([]Input, 0, len(d.inputs))
+	for _, input := range d.inputs {
+		inputs = append(inputs, input)
+	}
+	slices.SortFunc(inputs, func(a, b Input) int {
+		return strings.Compare(a.Kind+"\x00"+a.Name, b.Kind+"\x00"+b.Name)
+	})
+	return inputs
+}
+
+// Volatile returns the reasons why the result cannot be reproduced from the recorded dependencies
+func (d *Dependencies) Volatile() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.volatile)
+}
+
+// RecordFile implements core.DependencyRecorder
+func (e *engine) RecordFile(path string) {
+	if e.dependencies != nil {
+		e.dependencies.AddFile(path)
+	}
+}
+
+// RecordDir implements core.DependencyRecorder
+func (e *engine) RecordDir(path string, recursive bool) {
+	if e.dependencies != nil {
+		e.dependencies.AddDir(path, recursive)
+	}
+}
+
+// RecordInput implements core.DependencyRecorder
+func (e *engine) RecordInput(kind, name string, content []byte) {
+	if e.dependencies != nil {
+		e.dependencies.AddInput(kind, name, content)
+	}
+}
+
+// RecordVolatile implements core.DependencyRecorder
+func (e *engine) RecordVolatile(reason string) {
+	if e.dependencies != nil {
+		e.dependencies.AddVolatile(reason)
+	}
+}
+
+// recordSchema records a schema the evaluation resolved, so that updating the schema cache invalidates cached builds
+func (e *engine) recordSchema(kind, name string, schema *core.Schema) {
+	if e.dependencies != nil {
+		e.dependencies.AddInput(kind, name, schemaContent(schema))
+	}
+}
+
+// schemaContent returns what a schema validates by: the schema and the schemas it refers to with $ref,
+// which are linked rather than serialized with it
+func schemaContent(schema *core.Schema) []byte {
+	if schema == nil {
+		return nil
+	}
+	content, err := json.Marshal(schema)
+	if err != nil {
+		return nil
+	}
+
+	targets := schema.RefTargets()
+	for _, ref := range slices.Sorted(maps.Keys(targets)) {
+		target, err := json.Marshal(targets[ref])
+		if err != nil {
+			return nil
+		}
+		content = append(content, '\n')
+		content = append(content, ref...)
+		content = append(content, '\n')
+		content = append(content, target...)
+	}
+	return content
+}
+
+func hashContent(content []byte) string {
+	if content == nil {
+		return ""
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return abs
+}
@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDependencies(t *testing.T) {
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"index.yisp": `!yisp
+- import
+- ["lib", "./lib.yisp"]
+---
+!yisp
+- include
+- ./parts/**/*.yaml
+- ./single.yaml
+`,
+		"lib.yisp":         "!yisp &name\n- lambda\n- []\n- !quote cm\n",
+		"parts/a.yaml":     "a: 1\n",
+		"parts/sub/b.yaml": "b: 2\n",
+		"single.yaml":      "c: 3\n",
+		"unused.yaml":      "d: 4\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatalf("Error creating directory: %v", err)
+		}
+		err = os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("Error writing test file: %v", err)
+		}
+	}
+
+	deps := NewDependencies()
+	e := NewEngine(Options{AllowUntypedManifest: true, Dependencies: deps})
+	_, err := e.EvaluateFileToYaml(filepath.Join(dir, "index.yisp"))
+	if err != nil {
+		t.Fatalf("Error evaluating file: %v", err)
+	}
+
+	assert.Equal(t, []string{
+		filepath.Join(dir, "index.yisp"),
+		filepath.Join(dir, "lib.yisp"),
+		filepath.Join(dir, "parts/a.yaml"),
+		filepath.Join(dir, "parts/sub/b.yaml"),
+		filepath.Join(dir, "single.yaml"),
+	}, deps.Files())
+	assert.Equal(t, map[string]bool{filepath.Join(dir, "parts"): true}, deps.Dirs())
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 
 	"github.com/totegamma/yisp/core"
 	"github.com/totegamma/yisp/internal/yaml"
@@ -12,29 +13,77 @@ import (
 
 type engine struct {
 	execOptions          map[string]any
-	showTrace            bool
+	tracer               *Tracer
 	renderSources        bool
 	renderSpecialObjects bool
 	allowUntypedManifest bool
 	disableTypeCheck     bool
+	profiler             *Profiler
+	collectTests         bool
+	tests                []*TestCase
+	failures             *[]AssertionFailure
+	coverage             *Coverage
+	globals              map[string]*core.YispNode
+	dependencies         *Dependencies
+	schemas              core.SchemaRegistry
+	registered           map[string]*core.Schema
 }
 
 type Options struct {
 	ShowTrace            bool
+	Tracer               *Tracer
 	RenderSources        bool
 	RenderSpecialObjects bool
 	AllowUntypedManifest bool
 	DisableTypeCheck     bool
+	Profiler             *Profiler
+	// CollectTests records deftest forms to be run with RunTest instead of ignoring them
+	CollectTests bool
+	// Coverage records the evaluated nodes of every file the engine parses
+	Coverage *Coverage
+	// Globals are bound in the root environment of every evaluated entry file, e.g. values from the command line
+	Globals map[string]*core.YispNode
+	// Dependencies records the files and directories read while evaluating, e.g. to rebuild when they change
+	Dependencies *Dependencies
+	// SchemaRegistry looks up the schemas of manifests. core.DefaultSchemaRegistry is used if nil.
+	SchemaRegistry core.SchemaRegistry
 }
 
+// Kinds of evaluation frames reported to the profiler and the tracer
+const (
+	FrameKindEval     = "eval"
+	FrameKindFile     = "file"
+	FrameKindInclude  = "include"
+	FrameKindLambda   = "lambda"
+	FrameKindOperator = "operator"
+	FrameKindSchema   = "schema"
+)
+
 func NewEngine(opts Options) *engine {
+	tracer := opts.Tracer
+	if tracer == nil && opts.ShowTrace {
+		tracer = NewTracer(os.Stderr, TraceFilter{})
+	}
+
+	schemas := opts.SchemaRegistry
+	if schemas == nil {
+		schemas = core.DefaultSchemaRegistry()
+	}
+
 	return &engine{
+		tracer:               tracer,
 		execOptions:          make(map[string]any),
-		showTrace:            opts.ShowTrace,
 		renderSpecialObjects: opts.RenderSpecialObjects,
 		renderSources:        opts.RenderSources,
 		allowUntypedManifest: opts.AllowUntypedManifest,
 		disableTypeCheck:     opts.DisableTypeCheck,
+		profiler:             opts.Profiler,
+		collectTests:         opts.CollectTests,
+		coverage:             opts.Coverage,
+		globals:              opts.Globals,
+		dependencies:         opts.Dependencies,
+		schemas:              schemas,
+		registered:           make(map[string]*core.Schema),
 	}
 }
 
@@ -42,6 +91,23 @@ func (e *engine) SetOption(key string, value any) {
 	e.execOptions[key] = value
 }
 
+// SchemaRegistry implements core.SchemaResolver
+func (e *engine) SchemaRegistry() core.SchemaRegistry {
+	return e.schemas
+}
+
+// RegisterSchema implements core.SchemaRegistrar.
+// Registered schemas take precedence over those of the registry for the rest of the evaluation.
+// They are bound once, so that lookups return them as they are, and resolve $refs through the registry.
+func (e *engine) RegisterSchema(group, version, kind string, schema *core.Schema) {
+	name := group + "/" + version + "/" + kind
+	if schema.ID == "" {
+		schema.ID = name
+	}
+	schema.SetRegistry(e.schemas)
+	e.registered[name] = schema
+}
+
 func (e *engine) GetOption(key string) (any, bool) {
 	if value, ok := e.execOptions[key]; ok {
 		return value, true
@@ -56,7 +122,7 @@ func (e *engine) EvaluateFileToYamlWithEnv(path string, env *core.Env) (string,
 	}
 
 	if !e.disableTypeCheck {
-		err = core.VerifyTypes(evaluated, e.allowUntypedManifest)
+		err = e.verifyTypes(evaluated)
 		if err != nil {
 			return "", err
 		}
@@ -70,8 +136,17 @@ func (e *engine) EvaluateFileToYamlWithEnv(path string, env *core.Env) (string,
 	return result, nil
 }
 
-func (e *engine) EvaluateFileToYaml(path string) (string, error) {
+// newEnv creates the root environment of an entry file, with the globals bound
+func (e *engine) newEnv() *core.Env {
 	env := core.NewEnv()
+	for key, value := range e.globals {
+		env.Set(key, value)
+	}
+	return env
+}
+
+func (e *engine) EvaluateFileToYaml(path string) (string, error) {
+	env := e.newEnv()
 	return e.EvaluateFileToYamlWithEnv(path, env)
 }
 
@@ -82,7 +157,7 @@ func (e *engine) EvaluateReaderToYamlWithEnv(reader io.Reader, env *core.Env, lo
 	}
 
 	if !e.disableTypeCheck {
-		err = core.VerifyTypes(evaluated, e.allowUntypedManifest)
+		err = e.verifyTypes(evaluated)
 		if err != nil {
 			return "", err
 		}
@@ -97,19 +172,19 @@ func (e *engine) EvaluateReaderToYamlWithEnv(reader io.Reader, env *core.Env, lo
 }
 
 func (e *engine) EvaluateReaderToYaml(reader io.Reader, location string) (string, error) {
-	env := core.NewEnv()
+	env := e.newEnv()
 	return e.EvaluateReaderToYamlWithEnv(reader, env, location)
 }
 
 func (e *engine) EvaluateFileToAny(path string) (any, error) {
-	env := core.NewEnv()
+	env := e.newEnv()
 	evaluated, err := core.CallEngineByPath(path, "", env, e)
 	if err != nil {
 		return "", err
 	}
 
 	if !e.disableTypeCheck {
-		err = core.VerifyTypes(evaluated, e.allowUntypedManifest)
+		err = e.verifyTypes(evaluated)
 		if err != nil {
 			return "", err
 		}
@@ -124,7 +199,7 @@ func (e *engine) EvaluateFileToAny(path string) (any, error) {
 }
 
 func (e *engine) EvaluateBytesToYaml(data []byte, global map[string]any) (string, error) {
-	env := core.NewEnv()
+	env := e.newEnv()
 
 	for key, value := range global {
 		node, err := core.ParseAny("", value)
@@ -141,7 +216,7 @@ func (e *engine) EvaluateBytesToYaml(data []byte, global map[string]any) (string
 	}
 
 	if !e.disableTypeCheck {
-		err = core.VerifyTypes(evaluated, e.allowUntypedManifest)
+		err = e.verifyTypes(evaluated)
 		if err != nil {
 			return "", err
 		}
@@ -155,7 +230,40 @@ func (e *engine) EvaluateBytesToYaml(data []byte, global map[string]any) (string
 	return result, nil
 }
 
+func (e *engine) verifyTypes(node *core.YispNode) error {
+	e.enter(FrameKindSchema, "(verify types)", node)
+	err := core.VerifyTypes(node, e.allowUntypedManifest)
+	e.exit(FrameKindSchema, err)
+
+	return err
+}
+
+func (e *engine) enter(kind, name string, node *core.YispNode) {
+	if e.profiler != nil && kind != FrameKindEval {
+		e.profiler.Enter(kind, name)
+	}
+	if e.tracer != nil {
+		e.tracer.Enter(kind, name, node)
+	}
+}
+
+func (e *engine) exit(kind string, err error) {
+	if e.profiler != nil && kind != FrameKindEval {
+		e.profiler.Exit()
+	}
+	if e.tracer != nil {
+		e.tracer.Exit(err)
+	}
+}
+
 func (e *engine) Run(document io.Reader, env *core.Env, location string) (*core.YispNode, error) {
+	e.enter(FrameKindFile, location, nil)
+	result, err := e.run(document, env, location)
+	e.exit(FrameKindFile, err)
+	return result, err
+}
+
+func (e *engine) run(document io.Reader, env *core.Env, location string) (*core.YispNode, error) {
 
 	decoder := yaml.NewDecoder(document)
 	if decoder == nil {
@@ -178,6 +286,10 @@ func (e *engine) Run(document io.Reader, env *core.Env, location string) (*core.
 			return nil, err
 		}
 
+		if e.coverage != nil && parsed != nil {
+			e.coverage.register(parsed)
+		}
+
 		evaluated, err := e.Eval(parsed, env, core.EvalModeQuote)
 		if err != nil {
 			return nil, err
@@ -10,15 +10,22 @@ import (
 
 // Eval evaluates a core.YispNode in the given environment
 func (e *engine) Eval(node *core.YispNode, env *core.Env, mode core.EvalMode) (*core.YispNode, error) {
+	if e.coverage != nil {
+		e.coverage.hitLine(node)
+	}
 
-	if e.showTrace {
-		val, err := node.ToNative()
-		if err != nil {
-			return nil, core.NewEvaluationError(node, fmt.Sprintf("failed to convert node to native: %v", err))
-		}
-		fmt.Printf("%sEVAL: %v\n", pad(env.Depth()), val)
+	if e.tracer == nil {
+		return e.eval(node, env, mode)
 	}
 
+	e.enter(FrameKindEval, "", node)
+	result, err := e.eval(node, env, mode)
+	e.exit(FrameKindEval, err)
+	return result, err
+}
+
+func (e *engine) eval(node *core.YispNode, env *core.Env, mode core.EvalMode) (*core.YispNode, error) {
+
 	if node.Tag == "!yisp" {
 		mode = core.EvalModeEval
 	}
@@ -164,6 +171,10 @@ func (e *engine) Eval(node *core.YispNode, env *core.Env, mode core.EvalMode) (*
 					return nil, core.NewEvaluationErrorWithParent(nodes[1], "failed to evaluate condition", err)
 				}
 
+				if e.coverage != nil {
+					e.coverage.hitBranch(node, cond)
+				}
+
 				if cond {
 					result, err = e.Eval(nodes[2], env, mode)
 					if err != nil {
@@ -272,15 +283,18 @@ func (e *engine) Eval(node *core.YispNode, env *core.Env, mode core.EvalMode) (*
 						return nil, core.NewEvaluationError(node, fmt.Sprintf("invalid path type: %T", tuple[1]))
 					}
 
-					relpath, ok := relpathNode.Value.(string)
-					if !ok {
-						return nil, core.NewEvaluationError(node, fmt.Sprintf("invalid path type: %T", relpathNode.Value))
+					relpath, format, err := fileEntry(relpathNode, "import")
+					if err != nil {
+						return nil, err
+					}
+					// only yisp files define anything, so the format can only make a file of another extension a module
+					if format != "" && format != "yisp" {
+						return nil, core.NewEvaluationError(relpathNode, fmt.Sprintf("import only reads yisp modules, got format %s", format))
 					}
 
 					newEnv := core.NewEnv()
 
-					var err error
-					_, err = core.CallEngineByPath(relpath, node.Attr.File(), newEnv, e)
+					_, err = core.CallEngineByPathWithFormat(relpath, node.Attr.File(), format, newEnv, e)
 					if err != nil {
 						return nil, core.NewEvaluationErrorWithParent(node, "failed to include file", err)
 					}
@@ -294,6 +308,30 @@ func (e *engine) Eval(node *core.YispNode, env *core.Env, mode core.EvalMode) (*
 				result = &core.YispNode{
 					Kind: core.KindNull,
 				}
+			case "deftest":
+				var err error
+				result, err = e.evalDeftest(nodes, env)
+				if err != nil {
+					return nil, err
+				}
+			case "assert":
+				var err error
+				result, err = e.evalAssert(nodes, env, mode)
+				if err != nil {
+					return nil, err
+				}
+			case "assert-equal":
+				var err error
+				result, err = e.evalAssertEqual(nodes, env, mode)
+				if err != nil {
+					return nil, err
+				}
+			case "assert-error":
+				var err error
+				result, err = e.evalAssertError(nodes, env, mode)
+				if err != nil {
+					return nil, err
+				}
 			default:
 				evaluated := make([]*core.YispNode, len(nodes))
 				for i, item := range nodes {
@@ -414,7 +452,10 @@ func (e *engine) Eval(node *core.YispNode, env *core.Env, mode core.EvalMode) (*
 		}
 
 		if schemaID != "" {
-			schema, err := core.LoadSchemaFromURL(schemaID)
+			e.enter(FrameKindSchema, schemaID, node)
+			schema, err := e.schemas.SchemaByURL(schemaID)
+			e.exit(FrameKindSchema, err)
+			e.recordSchema(core.InputSchemaURL, schemaID, schema)
 			if err != nil && !e.allowUntypedManifest {
 				return nil, core.NewEvaluationError(
 					node,
@@ -435,7 +476,15 @@ func (e *engine) Eval(node *core.YispNode, env *core.Env, mode core.EvalMode) (*
 				group = split[0]
 				version = split[1]
 			}
-			schema, err := core.LoadSchemaFromGVK(group, version, kind)
+			e.enter(FrameKindSchema, apiVersion+"/"+kind, node)
+			var err error
+			schema, ok := e.registered[group+"/"+version+"/"+kind]
+			if !ok {
+				// schemas registered by the evaluation itself are not inputs of the build
+				schema, err = e.schemas.SchemaByGVK(group, version, kind)
+				e.recordSchema(core.InputSchemaGVK, group+"/"+version+"/"+kind, schema)
+			}
+			e.exit(FrameKindSchema, err)
 			if err != nil && !e.allowUntypedManifest {
 				return nil, core.NewEvaluationError(
 					node,
@@ -459,6 +508,9 @@ func (e *engine) Eval(node *core.YispNode, env *core.Env, mode core.EvalMode) (*
 			lambda, ok := result.Value.(*core.Lambda)
 			if ok {
 				lambda.Clojure.Set(node.Anchor, result)
+				if lambda.Name == "" {
+					lambda.Name = node.Anchor
+				}
 			}
 		}
 	}
@@ -0,0 +1,773 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/totegamma/yisp/internal/yaml"
+)
+
+// FormatFlowWidth is the longest line that Format keeps a call on in flow style
+const FormatFlowWidth = 80
+
+// FormatIndent is the number of spaces Format indents the entries of nested block collections by
+const FormatIndent = 2
+
+// Format rewrites yisp source in its canonical layout.
+// Block mappings and sequences are indented by FormatIndent spaces per level, with a single space
+// after the dash of an entry and after the colon of a key; comments and multi-line scalars move along
+// with the entries they belong to. Calls (sequences evaluated under !yisp) that fit within FormatFlowWidth
+// and carry no comments are then written in flow style, longer ones in block style.
+// All other text, including comments, anchors, tags, quotes and merge keys, is kept as written.
+// Formatting already formatted source is a no-op; source that would format differently a second time,
+// or that would read differently once formatted, is reported as an error rather than written.
+func Format(src []byte) ([]byte, error) {
+	formatted, err := formatOnce(src)
+	if err != nil {
+		return nil, err
+	}
+	again, err := formatOnce(formatted)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(again, formatted) {
+		return nil, errors.New("formatting is not stable for this source, so it was left unchanged; please report it as a bug")
+	}
+	same, err := sameDocuments(src, formatted)
+	if err != nil || !same {
+		return nil, errors.New("formatting would change the meaning of this source, so it was left unchanged; please report it as a bug")
+	}
+	return formatted, nil
+}
+
+func formatOnce(src []byte) ([]byte, error) {
+	indented, err := reformat(src, (*formatter).reindent)
+	if err != nil {
+		return nil, err
+	}
+	return reformat(indented, func(f *formatter, document *yaml.Node) {
+		f.format(document, false, 0, nil)
+	})
+}
+
+// reformat returns src with the edits a pass makes to each of its documents
+func reformat(src []byte, pass func(f *formatter, document *yaml.Node)) ([]byte, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(src))
+
+	f := &formatter{lines: strings.SplitAfter(string(src), "\n")}
+	for {
+		var document yaml.Node
+		err := decoder.Decode(&document)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		pass(f, &document)
+	}
+
+	return f.apply(), nil
+}
+
+// sourcePos is a position in the source: a line index and a byte offset in that line
+type sourcePos struct {
+	line, offset int
+}
+
+// formatEdit replaces the source from start up to end with text
+type formatEdit struct {
+	start, end sourcePos
+	text       string
+}
+
+type formatter struct {
+	lines []string
+	edits []formatEdit
+	// shifts are the changes in indentation of the lines, set by reindent
+	shifts []int
+	// verbatim marks the lines inside multi-line scalars and flow collections, which are never comment lines
+	verbatim []bool
+}
+
+// reindent lines up the entries of the block collections of a document
+func (f *formatter) reindent(document *yaml.Node) {
+	if f.shifts == nil {
+		f.shifts = make([]int, len(f.lines))
+		f.verbatim = make([]bool, len(f.lines))
+	}
+	for _, child := range document.Content {
+		last := child.Line - 1
+		for last+1 < len(f.lines) && !isDocumentMarker(f.lines[last+1]) {
+			last++
+		}
+		f.indent(child, 0, last)
+	}
+}
+
+// indent lines up node, whose entries start at column want if it is a block collection.
+// The source of node ends at line index last at the latest.
+func (f *formatter) indent(node *yaml.Node, want, last int) {
+	switch node.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		if node.Style&yaml.FlowStyle != 0 {
+			f.markVerbatim(node, last)
+			return
+		}
+		if len(node.Content) == 0 {
+			return
+		}
+		// a tag or anchor on a line of its own lines up with the entries
+		if node.Content[0].Line > node.Line && f.startsLine(node) {
+			f.shifts[node.Line-1] = want - (node.Column - 1)
+		}
+		if node.Kind == yaml.MappingNode {
+			f.indentMapping(node, want, last)
+		} else {
+			f.indentSequence(node, want, last)
+		}
+	case yaml.ScalarNode:
+		f.markVerbatim(node, last)
+	}
+}
+
+func (f *formatter) indentMapping(node *yaml.Node, want, last int) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		end := last
+		if i+2 < len(node.Content) {
+			end = node.Content[i+2].Line - 2
+		}
+		if f.startsLine(key) {
+			f.shift(key.Line-1, end, want-(key.Column-1))
+		}
+		if colon, ok := f.afterColon(key); ok {
+			f.singleSpace(colon, value)
+		}
+		f.indent(value, want+FormatIndent, end)
+	}
+}
+
+func (f *formatter) indentSequence(node *yaml.Node, want, last int) {
+	dashes := make([]sourcePos, len(node.Content))
+	for i, item := range node.Content {
+		dash, ok := f.dash(item)
+		if !ok {
+			return
+		}
+		dashes[i] = dash
+	}
+
+	for i, item := range node.Content {
+		end := last
+		if i+1 < len(node.Content) {
+			end = dashes[i+1].line - 1
+		}
+		dash := dashes[i]
+		if strings.TrimLeft(f.lines[dash.line][:dash.offset], " ") == "" {
+			f.shift(dash.line, end, want-dash.offset)
+		}
+		f.singleSpace(sourcePos{line: dash.line, offset: dash.offset + 1}, item)
+		f.indent(item, want+FormatIndent, end)
+	}
+}
+
+// shift sets the change in indentation of the lines from index from to index to
+func (f *formatter) shift(from, to, by int) {
+	for line := from; line <= to && line < len(f.shifts); line++ {
+		f.shifts[line] = by
+	}
+}
+
+// markVerbatim marks the lines after the first one of a scalar or flow collection,
+// which move along with the entry they belong to
+func (f *formatter) markVerbatim(node *yaml.Node, last int) {
+	if node.Kind == yaml.ScalarNode && node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		// the content of a block scalar ends at the first line indented less than its first line
+		indent := -1
+		for line := node.Line; line <= last && line < len(f.lines); line++ {
+			text := f.lines[line]
+			if strings.TrimSpace(text) != "" {
+				if indent < 0 {
+					indent = indentOf(text)
+				}
+				if indentOf(text) < indent {
+					return
+				}
+			}
+			f.verbatim[line] = true
+		}
+		return
+	}
+
+	end, ok := f.end(node)
+	if !ok {
+		return
+	}
+	for line := node.Line; line <= end.line; line++ {
+		f.verbatim[line] = true
+	}
+}
+
+// dash returns the position of the dash of a block sequence entry
+func (f *formatter) dash(item *yaml.Node) (sourcePos, bool) {
+	p := f.pos(item.Line, item.Column)
+	for line := p.line; line >= 0; line-- {
+		text := f.lines[line]
+		if line == p.line {
+			text = text[:p.offset]
+		} else if i := strings.Index(text, " #"); i >= 0 {
+			text = text[:i]
+		}
+		text = strings.TrimRight(text, " \t\r\n")
+		if text == "" || strings.HasPrefix(strings.TrimSpace(text), "#") {
+			continue
+		}
+		if strings.HasSuffix(text, "-") && (len(text) == 1 || text[len(text)-2] == ' ') {
+			return sourcePos{line: line, offset: len(text) - 1}, true
+		}
+		return sourcePos{}, false
+	}
+	return sourcePos{}, false
+}
+
+// singleSpace replaces the spaces from p up to node, if node follows them on the same line, with a single space
+func (f *formatter) singleSpace(p sourcePos, node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" && node.Value == "" {
+		return
+	}
+	to := f.pos(node.Line, node.Column)
+	text := f.lines[p.line]
+	if to.line != p.line || to.offset <= p.offset+1 || to.offset >= len(text) || strings.Trim(text[p.offset:to.offset], " ") != "" {
+		return
+	}
+	if strings.ContainsRune("#\r\n", rune(text[to.offset])) {
+		return
+	}
+	f.edits = append(f.edits, formatEdit{start: p, end: to, text: " "})
+}
+
+// startsLine reports whether node is the first thing on its line
+func (f *formatter) startsLine(node *yaml.Node) bool {
+	return indentOf(f.lines[node.Line-1]) == node.Column-1
+}
+
+// indentLines applies the shifts of reindent to lines. A comment line moves along with the line below it,
+// or with the line above it if it is indented deeper than the line below.
+func (f *formatter) indentLines(lines []string) {
+	content := func(line int) bool {
+		text := strings.TrimSpace(lines[line])
+		return f.verbatim[line] || text != "" && !strings.HasPrefix(text, "#")
+	}
+
+	shifts := slices.Clone(f.shifts)
+	for line, text := range lines {
+		if content(line) || strings.TrimSpace(text) == "" {
+			continue
+		}
+		next := line + 1
+		for next < len(lines) && !content(next) {
+			next++
+		}
+		prev := line - 1
+		for prev >= 0 && !content(prev) {
+			prev--
+		}
+		switch {
+		case next < len(lines) && (indentOf(text) <= indentOf(lines[next]) || prev < 0):
+			shifts[line] = f.shifts[next]
+		case prev >= 0:
+			shifts[line] = f.shifts[prev]
+		}
+	}
+
+	for line, text := range lines {
+		by := shifts[line]
+		if by == 0 || strings.TrimSpace(text) == "" || isDocumentMarker(text) {
+			continue
+		}
+		if by > 0 {
+			lines[line] = strings.Repeat(" ", by) + text
+		} else {
+			lines[line] = text[min(-by, indentOf(text)):]
+		}
+	}
+}
+
+func indentOf(text string) int {
+	return len(text) - len(strings.TrimLeft(text, " "))
+}
+
+func isDocumentMarker(text string) bool {
+	return strings.HasPrefix(text, "---") || strings.HasPrefix(text, "...") || strings.HasPrefix(text, "%")
+}
+
+// format restyles the calls below node. evaluated tells whether node is in an evaluated position,
+// indent is the column the entries of node start at when it is written in block style,
+// and key is the key of node if it is the value of a mapping.
+func (f *formatter) format(node *yaml.Node, evaluated bool, indent int, key *yaml.Node) {
+	switch node.Tag {
+	case "!yisp":
+		evaluated = true
+	case "!quote":
+		evaluated = false
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			f.format(child, evaluated, 0, nil)
+		}
+	case yaml.MappingNode:
+		if node.Style&yaml.FlowStyle != 0 {
+			return
+		}
+		for i := 1; i < len(node.Content); i += 2 {
+			f.format(node.Content[i], evaluated, node.Content[i-1].Column-1+FormatIndent, node.Content[i-1])
+		}
+	case yaml.SequenceNode:
+		if node.Style&yaml.FlowStyle != 0 {
+			if evaluated {
+				f.toBlock(node, indent, key)
+			}
+			return
+		}
+		if evaluated && f.toFlow(node, key) {
+			return
+		}
+		for _, child := range node.Content {
+			f.format(child, evaluated, child.Column-1, nil)
+		}
+	}
+}
+
+// toFlow rewrites a call in block style in flow style if it fits on its line
+func (f *formatter) toFlow(node *yaml.Node, key *yaml.Node) bool {
+	// the head comment of a document is read as the one of its first entry, but it stays above the call
+	first := node.Content[0]
+	if first.HeadComment != "" && !f.commentBetween(node.Line, first.Line) {
+		stripped := *node
+		stripped.Content = slices.Clone(node.Content)
+		stripped.Content[0] = &yaml.Node{}
+		*stripped.Content[0] = *first
+		stripped.Content[0].HeadComment = ""
+		node = &stripped
+	}
+	if commentsInside(node) || !flowable(node, true) {
+		return false
+	}
+	text, ok := f.flowText(node)
+	if !ok {
+		return false
+	}
+
+	// a call below its key moves up next to it
+	start := f.pos(node.Line, node.Column)
+	if key != nil && node.Line > key.Line {
+		start, ok = f.afterKey(key)
+		if !ok {
+			return false
+		}
+		text = " " + text
+	}
+	if utf8.RuneCountInString(f.lines[start.line][:start.offset]+text) > FormatFlowWidth {
+		return false
+	}
+
+	end, ok := f.end(node)
+	if !ok {
+		return false
+	}
+
+	// a comment after the tag of the call stays behind it
+	if node.Content[0].Line > node.Line {
+		props := f.pos(node.Line, node.Column)
+		rest := strings.TrimSpace(f.lines[props.line][f.skipProperties(props).offset:])
+		if rest != "" && !strings.HasPrefix(rest, "#") {
+			return false
+		}
+		if rest != "" {
+			text += " " + rest
+		}
+	}
+
+	f.edits = append(f.edits, formatEdit{start: start, end: end, text: text})
+	return true
+}
+
+// toBlock rewrites a call in flow style in block style if it does not fit on its line
+func (f *formatter) toBlock(node *yaml.Node, indent int, key *yaml.Node) {
+	text, ok := f.sourceText(node)
+	if ok && node.Column-1+utf8.RuneCountInString(text) <= FormatFlowWidth {
+		return
+	}
+	for _, child := range node.Content {
+		if hasComments(child) {
+			return
+		}
+	}
+
+	start := f.pos(node.Line, node.Column)
+	end, ok := f.end(node)
+	if !ok {
+		return
+	}
+
+	// a comment after the call stays on its first line
+	comment := ""
+	rest := strings.TrimSpace(f.lines[end.line][end.offset:])
+	if rest != "" {
+		if !strings.HasPrefix(rest, "#") {
+			return
+		}
+		comment = " " + rest
+		end.offset = len(strings.TrimRight(f.lines[end.line], "\r\n"))
+	}
+
+	block, ok := f.blockText(node, indent)
+	if !ok {
+		return
+	}
+	below := "\n" + strings.Repeat(" ", indent) + block
+	switch props := f.properties(node); {
+	case props != "":
+		text = props + comment + below
+	case key != nil:
+		// the entries of an untagged value of a mapping start below its key
+		start.offset = len(strings.TrimRight(f.lines[start.line][:start.offset], " "))
+		text = comment + below
+	default:
+		first, rest, _ := strings.Cut(block, "\n")
+		text = first + comment + "\n" + rest
+	}
+	f.edits = append(f.edits, formatEdit{start: start, end: end, text: text})
+}
+
+// blockText returns the entries of a call in flow style written in block style, the ones after the first
+// at column indent. The calls in it that do not fit on their line are written in block style too.
+func (f *formatter) blockText(node *yaml.Node, indent int) (string, bool) {
+	entries := make([]string, 0, len(node.Content))
+	for _, child := range node.Content {
+		text, ok := f.sourceText(child)
+		if !ok {
+			return "", false
+		}
+		nested := child.Kind == yaml.SequenceNode && child.Tag != "!quote" && child.Style&yaml.FlowStyle != 0
+		if nested && indent+FormatIndent+utf8.RuneCountInString(text) > FormatFlowWidth {
+			block, ok := f.blockText(child, indent+FormatIndent)
+			if !ok {
+				return "", false
+			}
+			text = block
+			if props := f.properties(child); props != "" {
+				text = props + "\n" + strings.Repeat(" ", indent+FormatIndent) + block
+			}
+		}
+		entries = append(entries, "- "+text)
+	}
+	return strings.Join(entries, "\n"+strings.Repeat(" ", indent)), true
+}
+
+// commentBetween reports whether there is a comment line after line from and before line to
+func (f *formatter) commentBetween(from, to int) bool {
+	for line := from + 1; line < to; line++ {
+		if strings.HasPrefix(strings.TrimSpace(f.lines[line-1]), "#") {
+			return true
+		}
+	}
+	return false
+}
+
+// afterKey returns the position after the colon following key, if nothing but spaces follow it on its line
+func (f *formatter) afterKey(key *yaml.Node) (sourcePos, bool) {
+	p, ok := f.afterColon(key)
+	if !ok || strings.TrimSpace(f.lines[p.line][p.offset:]) != "" {
+		return sourcePos{}, false
+	}
+	return p, true
+}
+
+// afterColon returns the position after the colon following key
+func (f *formatter) afterColon(key *yaml.Node) (sourcePos, bool) {
+	p := f.skipProperties(f.pos(key.Line, key.Column))
+	text := f.lines[p.line]
+	if key.Kind == yaml.ScalarNode && key.Style&^yaml.TaggedStyle == 0 && strings.HasPrefix(text[p.offset:], key.Value) {
+		p.offset += len(key.Value)
+	} else {
+		var ok bool
+		if p, ok = f.end(key); !ok {
+			return sourcePos{}, false
+		}
+		text = f.lines[p.line]
+	}
+	for p.offset < len(text) && text[p.offset] == ' ' {
+		p.offset++
+	}
+	if p.offset >= len(text) || text[p.offset] != ':' {
+		return sourcePos{}, false
+	}
+	p.offset++
+	return p, true
+}
+
+// flowText returns a call in block style written in flow style, keeping the text of its entries
+func (f *formatter) flowText(node *yaml.Node) (string, bool) {
+	if node.Kind != yaml.SequenceNode || node.Style&yaml.FlowStyle != 0 {
+		// plain scalars with flow indicators read differently in flow style
+		plain := node.Kind == yaml.ScalarNode && node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) == 0
+		if plain && strings.ContainsAny(node.Value, ",[]{}") {
+			return "", false
+		}
+		return f.sourceText(node)
+	}
+
+	entries := make([]string, len(node.Content))
+	for i, child := range node.Content {
+		text, ok := f.flowText(child)
+		if !ok {
+			return "", false
+		}
+		entries[i] = text
+	}
+	text := "[" + strings.Join(entries, ", ") + "]"
+	if props := f.properties(node); props != "" {
+		text = props + " " + text
+	}
+	return text, true
+}
+
+// sourceText returns the source of a node that is on a single line, with its tag and anchor
+func (f *formatter) sourceText(node *yaml.Node) (string, bool) {
+	start := f.pos(node.Line, node.Column)
+	end, ok := f.end(node)
+	if !ok || end.line != start.line {
+		return "", false
+	}
+	return f.lines[start.line][start.offset:end.offset], true
+}
+
+// properties returns the tag and anchor of a node as they are written
+func (f *formatter) properties(node *yaml.Node) string {
+	start := f.pos(node.Line, node.Column)
+	end := f.skipProperties(start)
+	return strings.TrimSpace(f.lines[start.line][start.offset:end.offset])
+}
+
+// apply returns the source with the edits made
+func (f *formatter) apply() []byte {
+	sort.Slice(f.edits, func(i, j int) bool {
+		a, b := f.edits[i].start, f.edits[j].start
+		return a.line > b.line || a.line == b.line && a.offset > b.offset
+	})
+	lines := f.lines
+	for _, edit := range f.edits {
+		replaced := lines[edit.start.line][:edit.start.offset] + edit.text + lines[edit.end.line][edit.end.offset:]
+		lines = append(lines[:edit.start.line], append([]string{replaced}, lines[edit.end.line+1:]...)...)
+	}
+	// the edits of reindent stay within their lines, so the shifts still apply to the same lines
+	if f.shifts != nil {
+		f.indentLines(lines)
+	}
+	return []byte(strings.Join(lines, ""))
+}
+
+// pos converts the 1-based line and column of a node, counted in characters, to a source position
+func (f *formatter) pos(line, column int) sourcePos {
+	text := f.lines[line-1]
+	offset := 0
+	for i := 1; i < column && offset < len(text); i++ {
+		_, size := utf8.DecodeRuneInString(text[offset:])
+		offset += size
+	}
+	return sourcePos{line: line - 1, offset: offset}
+}
+
+// skipProperties returns the position after the tag and anchor at p
+func (f *formatter) skipProperties(p sourcePos) sourcePos {
+	for {
+		text := f.lines[p.line]
+		for p.offset < len(text) && text[p.offset] == ' ' {
+			p.offset++
+		}
+		if p.offset >= len(text) || text[p.offset] != '!' && text[p.offset] != '&' {
+			return p
+		}
+		for p.offset < len(text) && !strings.ContainsRune(" \t\r\n", rune(text[p.offset])) {
+			p.offset++
+		}
+	}
+}
+
+// end returns the position after the source of node. It fails for nodes it cannot find the end of,
+// like plain scalars that continue on the next line.
+func (f *formatter) end(node *yaml.Node) (sourcePos, bool) {
+	p := f.skipProperties(f.pos(node.Line, node.Column))
+	text := f.lines[p.line]
+
+	switch node.Kind {
+	case yaml.AliasNode:
+		return sourcePos{line: p.line, offset: p.offset + 1 + len(node.Value)}, true
+	case yaml.SequenceNode, yaml.MappingNode:
+		if node.Style&yaml.FlowStyle != 0 {
+			return f.closing(p)
+		}
+		if len(node.Content) == 0 {
+			return sourcePos{}, false
+		}
+		return f.end(node.Content[len(node.Content)-1])
+	case yaml.ScalarNode:
+		switch {
+		case node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0:
+			return f.closing(p)
+		case node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0:
+			return sourcePos{}, false
+		}
+		// a plain scalar on a single line is written as its value, followed by a space or an indicator
+		rest, ok := strings.CutPrefix(text[p.offset:], node.Value)
+		if !ok || rest != "" && !strings.ContainsRune(" \t\r\n,]}:", rune(rest[0])) {
+			return sourcePos{}, false
+		}
+		return sourcePos{line: p.line, offset: p.offset + len(node.Value)}, true
+	}
+	return sourcePos{}, false
+}
+
+// closing returns the position after the flow collection or quoted scalar starting at p
+func (f *formatter) closing(p sourcePos) (sourcePos, bool) {
+	depth := 0
+	var quote byte
+	for ; p.line < len(f.lines); p.line, p.offset = p.line+1, 0 {
+		text := f.lines[p.line]
+		for ; p.offset < len(text); p.offset++ {
+			c := text[p.offset]
+			switch {
+			case quote == '"' && c == '\\':
+				p.offset++
+			case quote == '\'' && c == '\'' && p.offset+1 < len(text) && text[p.offset+1] == '\'':
+				p.offset++
+			case quote != 0:
+				if c == quote {
+					quote = 0
+					if depth == 0 {
+						return sourcePos{line: p.line, offset: p.offset + 1}, true
+					}
+				}
+			case (c == '"' || c == '\'') && (p.offset == 0 || strings.IndexByte(" \t[{,:", text[p.offset-1]) >= 0):
+				quote = c
+			case c == '#' && (p.offset == 0 || text[p.offset-1] == ' ' || text[p.offset-1] == '\t'):
+				p.offset = len(text)
+			case c == '[' || c == '{':
+				depth++
+			case c == ']' || c == '}':
+				depth--
+				if depth == 0 {
+					return sourcePos{line: p.line, offset: p.offset + 1}, true
+				}
+			}
+		}
+	}
+	return sourcePos{}, false
+}
+
+// commentsInside reports whether there are comments in the source of a call in block style.
+// A foot comment of the last entry follows the call, so it stays where it is.
+func commentsInside(node *yaml.Node) bool {
+	for i, child := range node.Content {
+		if child.HeadComment != "" || child.LineComment != "" {
+			return true
+		}
+		last := i == len(node.Content)-1
+		if !last && hasComments(child) || last && commentsInside(child) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasComments(node *yaml.Node) bool {
+	if node.HeadComment != "" || node.LineComment != "" || node.FootComment != "" {
+		return true
+	}
+	for _, child := range node.Content {
+		if hasComments(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// flowable reports whether node can be written in flow style without changing its meaning.
+// Only calls change style: quoted data and maps must already be in flow style,
+// because the style of data is carried over to the rendered output.
+func flowable(node *yaml.Node, evaluated bool) bool {
+	switch node.Tag {
+	case "!yisp":
+		evaluated = true
+	case "!quote":
+		evaluated = false
+	}
+
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+			return false
+		}
+		return !strings.Contains(node.Value, "\n")
+	case yaml.MappingNode:
+		if node.Style&yaml.FlowStyle == 0 {
+			return false
+		}
+	case yaml.SequenceNode:
+		if !evaluated && node.Style&yaml.FlowStyle == 0 {
+			return false
+		}
+	}
+
+	for _, child := range node.Content {
+		if !flowable(child, evaluated) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameDocuments reports whether a and b hold the same documents, regardless of their layout and comments
+func sameDocuments(a, b []byte) (bool, error) {
+	decodeAll := func(src []byte) ([]*yaml.Node, error) {
+		decoder := yaml.NewDecoder(bytes.NewReader(src))
+		documents := make([]*yaml.Node, 0)
+		for {
+			var document yaml.Node
+			err := decoder.Decode(&document)
+			if errors.Is(err, io.EOF) {
+				return documents, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			documents = append(documents, &document)
+		}
+	}
+
+	as, err := decodeAll(a)
+	if err != nil {
+		return false, err
+	}
+	bs, err := decodeAll(b)
+	if err != nil {
+		return false, err
+	}
+	return slices.EqualFunc(as, bs, sameNode), nil
+}
+
+func sameNode(a, b *yaml.Node) bool {
+	if a.Kind != b.Kind || a.ShortTag() != b.ShortTag() || a.Value != b.Value || a.Anchor != b.Anchor {
+		return false
+	}
+	return slices.EqualFunc(a.Content, b.Content, sameNode)
+}
@@ -0,0 +1,307 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatIdempotent(t *testing.T) {
+
+	files, err := filepath.Glob("../testdata/*.yisp")
+	if err != nil {
+		t.Fatalf("Error finding test files: %v", err)
+	}
+
+	for _, file := range files {
+		t.Run(file, func(t *testing.T) {
+			src, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("Error reading file %s: %v", file, err)
+			}
+
+			once, err := Format(src)
+			if err != nil {
+				t.Fatalf("Error formatting file %s: %v", file, err)
+			}
+
+			twice, err := Format(once)
+			if err != nil {
+				t.Fatalf("Error formatting formatted file %s: %v", file, err)
+			}
+
+			assert.Equal(t, string(once), string(twice))
+		})
+	}
+}
+
+func TestFormatCallStyle(t *testing.T) {
+	src := `# sum
+result: !yisp
+  - +
+  - 1
+  - 2
+long: !yisp
+  - strings.concat
+  - "a string that is long enough"
+  - "to push this call past the width limit"
+data: !yisp [lists.car, !quote [1, 2]]
+`
+
+	expected := `# sum
+result: !yisp [+, 1, 2]
+long: !yisp
+  - strings.concat
+  - "a string that is long enough"
+  - "to push this call past the width limit"
+data: !yisp [lists.car, !quote [1, 2]]
+`
+
+	formatted, err := Format([]byte(src))
+	if err != nil {
+		t.Fatalf("Error formatting: %v", err)
+	}
+
+	assert.Equal(t, expected, string(formatted))
+}
+
+func TestFormatIndentation(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected string
+	}{
+		{
+			name: "nested blocks",
+			src: `a:
+    b:   1
+    c:
+        -   x
+`,
+			expected: `a:
+  b: 1
+  c:
+    - x
+`,
+		},
+		{
+			name: "entries of a sequence",
+			src: `list:
+-   name: a
+    spec:
+          x: 1
+-   - nested
+    -   entries
+`,
+			expected: `list:
+  - name: a
+    spec:
+      x: 1
+  - - nested
+    - entries
+`,
+		},
+		{
+			name: "comments and scalars move with their entries",
+			src: `top:
+      # about list
+      list:
+          - |
+            line one
+              # not a comment
+          - "quoted
+             scalar"
+          # after the list
+# about next
+next: 1
+`,
+			expected: `top:
+  # about list
+  list:
+    - |
+      line one
+        # not a comment
+    - "quoted
+       scalar"
+    # after the list
+# about next
+next: 1
+`,
+		},
+		{
+			name: "tag on a line of its own",
+			src: `a:
+    !quote
+    - x
+`,
+			expected: `a:
+  !quote
+  - x
+`,
+		},
+		{
+			name: "documents",
+			src: `a:
+- x
+---
+b:
+    c: 1
+`,
+			expected: `a:
+  - x
+---
+b:
+  c: 1
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			formatted, err := Format([]byte(test.src))
+			if err != nil {
+				t.Fatalf("Error formatting: %v", err)
+			}
+			assert.Equal(t, test.expected, string(formatted))
+		})
+	}
+}
+
+func TestFormatKeepsSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected string
+	}{
+		{
+			name: "merge keys",
+			src: `base: &base
+  a: 1
+merged:
+  <<: *base
+  b: !yisp
+    - +
+    - 1
+    - 2
+`,
+			expected: `base: &base
+  a: 1
+merged:
+  <<: *base
+  b: !yisp [+, 1, 2]
+`,
+		},
+		{
+			name: "merge key in a converted call",
+			src: `result: !yisp
+  - maps.merge
+  - !quote
+    <<: {a: 1}
+    b: "a value that is long enough to keep this call in block style"
+`,
+			expected: `result: !yisp
+  - maps.merge
+  - !quote
+    <<: {a: 1}
+    b: "a value that is long enough to keep this call in block style"
+`,
+		},
+		{
+			name: "tag before anchor",
+			src: `!yisp &main
+- +
+- 1
+- 2
+`,
+			expected: `!yisp &main [+, 1, 2]
+`,
+		},
+		{
+			name: "anchor before tag",
+			src: `&main !yisp
+- +
+- 1
+- 2
+`,
+			expected: `&main !yisp [+, 1, 2]
+`,
+		},
+		{
+			name: "head comment above the document tag",
+			src: `# RFC6902
+!yisp
+- +
+- 1
+- 2
+`,
+			expected: `# RFC6902
+!yisp [+, 1, 2]
+`,
+		},
+		{
+			name: "comments around calls",
+			src: `a: 1 # one
+b: !yisp [+, 1, 2]   # sum
+
+# trailing
+`,
+			expected: `a: 1 # one
+b: !yisp [+, 1, 2]   # sum
+
+# trailing
+`,
+		},
+		{
+			name: "call below its key",
+			src: `!yisp
+result:
+- +
+- 1
+- 2
+`,
+			expected: `!yisp
+result: [+, 1, 2]
+`,
+		},
+		{
+			name: "quotes and plain scalars with flow indicators",
+			src: `a: !yisp
+  - strings.concat
+  - 'single'
+  - a,b
+b: !yisp
+  - strings.concat
+  - 'single'
+  - "double"
+`,
+			expected: `a: !yisp
+  - strings.concat
+  - 'single'
+  - a,b
+b: !yisp [strings.concat, 'single', "double"]
+`,
+		},
+		{
+			name: "long call to block",
+			src: `long: !yisp [strings.concat, "a string that is long enough", "to push this call past the limit"] # long
+`,
+			expected: `long: !yisp # long
+  - strings.concat
+  - "a string that is long enough"
+  - "to push this call past the limit"
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			formatted, err := Format([]byte(test.src))
+			if err != nil {
+				t.Fatalf("Error formatting: %v", err)
+			}
+			assert.Equal(t, test.expected, string(formatted))
+		})
+	}
+}
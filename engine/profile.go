@@ -0,0 +1,212 @@
+package engine
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// ProfileEntry is the accumulated cost of one lambda, operator, file or schema lookup
+type ProfileEntry struct {
+	Kind       string
+	Name       string
+	Calls      int
+	Cumulative time.Duration
+	Self       time.Duration
+}
+
+type profileKey struct {
+	kind string
+	name string
+}
+
+type profileFrame struct {
+	key       profileKey
+	start     time.Time
+	childTime time.Duration
+}
+
+// Profiler records time and call counts of evaluation frames
+type Profiler struct {
+	stack   []*profileFrame
+	entries map[profileKey]*ProfileEntry
+	active  map[profileKey]int
+	folded  map[string]time.Duration
+	started time.Time
+	now     func() time.Time
+}
+
+func NewProfiler() *Profiler {
+	return &Profiler{
+		entries: make(map[profileKey]*ProfileEntry),
+		active:  make(map[profileKey]int),
+		folded:  make(map[string]time.Duration),
+		started: time.Now(),
+		now:     time.Now,
+	}
+}
+
+// Enter starts a frame. Every Enter must be paired with an Exit.
+func (p *Profiler) Enter(kind, name string) {
+	key := profileKey{kind: kind, name: name}
+	p.active[key]++
+	p.stack = append(p.stack, &profileFrame{
+		key:   key,
+		start: p.now(),
+	})
+}
+
+// Exit ends the innermost frame
+func (p *Profiler) Exit() {
+	if len(p.stack) == 0 {
+		return
+	}
+
+	frame := p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+
+	elapsed := p.now().Sub(frame.start)
+
+	entry, ok := p.entries[frame.key]
+	if !ok {
+		entry = &ProfileEntry{Kind: frame.key.kind, Name: frame.key.name}
+		p.entries[frame.key] = entry
+	}
+	entry.Calls++
+	entry.Self += max(elapsed-frame.childTime, 0)
+
+	// recursive frames are only counted once towards the cumulative time
+	p.active[frame.key]--
+	if p.active[frame.key] == 0 {
+		entry.Cumulative += elapsed
+	}
+
+	names := make([]string, 0, len(p.stack)+1)
+	for _, f := range p.stack {
+		names = append(names, f.key.String())
+	}
+	names = append(names, frame.key.String())
+	p.folded[strings.Join(names, ";")] += max(elapsed-frame.childTime, 0)
+
+	if len(p.stack) > 0 {
+		parent := p.stack[len(p.stack)-1]
+		parent.childTime += elapsed
+	}
+}
+
+func (k profileKey) String() string {
+	return k.kind + ":" + strings.ReplaceAll(k.name, ";", ",")
+}
+
+// Entries returns the recorded entries sorted by cumulative time, longest first
+func (p *Profiler) Entries() []ProfileEntry {
+	entries := make([]ProfileEntry, 0, len(p.entries))
+	for _, entry := range p.entries {
+		entries = append(entries, *entry)
+	}
+	slices.SortFunc(entries, func(a, b ProfileEntry) int {
+		return cmp.Or(
+			cmp.Compare(b.Cumulative, a.Cumulative),
+			cmp.Compare(b.Self, a.Self),
+			cmp.Compare(a.Kind, b.Kind),
+			cmp.Compare(a.Name, b.Name),
+		)
+	})
+	return entries
+}
+
+// WriteReport writes a human readable table of the recorded entries
+func (p *Profiler) WriteReport(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "CUMULATIVE\tSELF\tCALLS\tKIND\tNAME\n")
+	for _, entry := range p.Entries() {
+		fmt.Fprintf(
+			tw,
+			"%s\t%s\t%d\t%s\t%s\n",
+			entry.Cumulative.Round(time.Microsecond),
+			entry.Self.Round(time.Microsecond),
+			entry.Calls,
+			entry.Kind,
+			entry.Name,
+		)
+	}
+	return tw.Flush()
+}
+
+// WriteFolded writes the recorded stacks in the folded format used by flamegraph tools.
+// Values are self time in microseconds.
+func (p *Profiler) WriteFolded(w io.Writer) error {
+	stacks := make([]string, 0, len(p.folded))
+	for stack := range p.folded {
+		stacks = append(stacks, stack)
+	}
+	slices.Sort(stacks)
+
+	for _, stack := range stacks {
+		_, err := fmt.Fprintf(w, "%s %d\n", stack, p.folded[stack].Microseconds())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WritePprof writes the recorded stacks as a gzipped pprof profile of wall time
+func (p *Profiler) WritePprof(w io.Writer) error {
+	prof := &profile.Profile{
+		SampleType:    []*profile.ValueType{{Type: "wall", Unit: "nanoseconds"}},
+		PeriodType:    &profile.ValueType{Type: "wall", Unit: "nanoseconds"},
+		Period:        1,
+		TimeNanos:     p.started.UnixNano(),
+		DurationNanos: p.now().Sub(p.started).Nanoseconds(),
+	}
+
+	functions := make(map[string]*profile.Function)
+	locations := make(map[string]*profile.Location)
+	location := func(name string) *profile.Location {
+		if loc, ok := locations[name]; ok {
+			return loc
+		}
+		fn := &profile.Function{
+			ID:   uint64(len(functions) + 1),
+			Name: name,
+		}
+		functions[name] = fn
+		prof.Function = append(prof.Function, fn)
+
+		loc := &profile.Location{
+			ID:   uint64(len(locations) + 1),
+			Line: []profile.Line{{Function: fn}},
+		}
+		locations[name] = loc
+		prof.Location = append(prof.Location, loc)
+		return loc
+	}
+
+	stacks := make([]string, 0, len(p.folded))
+	for stack := range p.folded {
+		stacks = append(stacks, stack)
+	}
+	slices.Sort(stacks)
+
+	for _, stack := range stacks {
+		names := strings.Split(stack, ";")
+		// pprof expects the leaf frame first
+		locs := make([]*profile.Location, len(names))
+		for i, name := range names {
+			locs[len(names)-1-i] = location(name)
+		}
+		prof.Sample = append(prof.Sample, &profile.Sample{
+			Location: locs,
+			Value:    []int64{p.folded[stack].Nanoseconds()},
+		})
+	}
+
+	return prof.Write(w)
+}
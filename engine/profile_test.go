@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestProfiler returns a profiler whose clock only moves when advance is called
+func newTestProfiler() (*Profiler, func(time.Duration)) {
+	p := NewProfiler()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	p.started = now
+	p.now = func() time.Time { return now }
+	return p, func(d time.Duration) { now = now.Add(d) }
+}
+
+// record runs a file that calls the lambda f twice, once directly and once through the recursive lambda g
+func record() *Profiler {
+	p, advance := newTestProfiler()
+	p.Enter("file", "index.yaml")
+	advance(1 * time.Millisecond)
+	p.Enter("lambda", "f")
+	advance(2 * time.Millisecond)
+	p.Exit()
+	p.Enter("lambda", "g")
+	advance(1 * time.Millisecond)
+	p.Enter("lambda", "g")
+	advance(3 * time.Millisecond)
+	p.Enter("lambda", "f")
+	advance(1 * time.Millisecond)
+	p.Exit()
+	p.Exit()
+	p.Exit()
+	advance(2 * time.Millisecond)
+	p.Exit()
+	return p
+}
+
+func TestProfilerEntries(t *testing.T) {
+	p := record()
+	assert.Equal(t, []ProfileEntry{
+		{Kind: "file", Name: "index.yaml", Calls: 1, Cumulative: 10 * time.Millisecond, Self: 3 * time.Millisecond},
+		{Kind: "lambda", Name: "g", Calls: 2, Cumulative: 5 * time.Millisecond, Self: 4 * time.Millisecond},
+		{Kind: "lambda", Name: "f", Calls: 2, Cumulative: 3 * time.Millisecond, Self: 3 * time.Millisecond},
+	}, p.Entries())
+
+	// an unpaired Exit is ignored
+	p.Exit()
+	assert.Len(t, p.Entries(), 3)
+}
+
+func TestProfilerReport(t *testing.T) {
+	var buf bytes.Buffer
+	err := record().WriteReport(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, `CUMULATIVE  SELF  CALLS  KIND    NAME
+10ms        3ms   1      file    index.yaml
+5ms         4ms   2      lambda  g
+3ms         3ms   2      lambda  f
+`, buf.String())
+}
+
+func TestProfilerFolded(t *testing.T) {
+	var buf bytes.Buffer
+	err := record().WriteFolded(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, `file:index.yaml 3000
+file:index.yaml;lambda:f 2000
+file:index.yaml;lambda:g 1000
+file:index.yaml;lambda:g;lambda:g 3000
+file:index.yaml;lambda:g;lambda:g;lambda:f 1000
+`, buf.String())
+}
+
+func TestProfilerPprof(t *testing.T) {
+	var buf bytes.Buffer
+	err := record().WritePprof(&buf)
+	assert.NoError(t, err)
+
+	prof, err := profile.Parse(&buf)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, int64(10*time.Millisecond), prof.DurationNanos)
+
+	samples := make(map[string]int64)
+	for _, sample := range prof.Sample {
+		// locations are stored leaf first
+		stack := ""
+		for i := len(sample.Location) - 1; i >= 0; i-- {
+			if stack != "" {
+				stack += ";"
+			}
+			stack += sample.Location[i].Line[0].Function.Name
+		}
+		samples[stack] = sample.Value[0]
+	}
+	assert.Equal(t, map[string]int64{
+		"file:index.yaml":                            int64(3 * time.Millisecond),
+		"file:index.yaml;lambda:f":                   int64(2 * time.Millisecond),
+		"file:index.yaml;lambda:g":                   int64(1 * time.Millisecond),
+		"file:index.yaml;lambda:g;lambda:g":          int64(3 * time.Millisecond),
+		"file:index.yaml;lambda:g;lambda:g;lambda:f": int64(1 * time.Millisecond),
+	}, samples)
+}
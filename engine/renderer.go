@@ -0,0 +1,398 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+
+	"github.com/totegamma/yisp/core"
+	"github.com/totegamma/yisp/diff"
+	"github.com/totegamma/yisp/internal/yaml"
+)
+
+// Renderer writes evaluated documents in an output format other than YAML.
+// Documents are the native values returned by YispNode.ToNative.
+type Renderer interface {
+	Render(w io.Writer, documents []any) error
+}
+
+var renderers = map[string]Renderer{
+	"json":       JSONRenderer{},
+	"json-array": JSONArrayRenderer{},
+	"ndjson":     NDJSONRenderer{},
+	"list":       ListRenderer{},
+	"toml":       TOMLRenderer{},
+	"properties": PropertiesRenderer{},
+	"dotenv":     DotenvRenderer{},
+}
+
+// RegisterRenderer makes a renderer available by name, replacing any renderer of the same name
+func RegisterRenderer(name string, renderer Renderer) {
+	renderers[name] = renderer
+}
+
+// GetRenderer returns the renderer registered under name
+func GetRenderer(name string) (Renderer, bool) {
+	renderer, ok := renderers[name]
+	return renderer, ok
+}
+
+// RendererNames returns the names of all registered renderers in sorted order
+func RendererNames() []string {
+	names := make([]string, 0, len(renderers))
+	for name := range renderers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// RenderWith renders an evaluated file with a renderer instead of as YAML
+func (e *engine) RenderWith(w io.Writer, node *core.YispNode, renderer Renderer) error {
+	native, err := node.ToNative()
+	if err != nil {
+		return err
+	}
+	documents, ok := native.([]any)
+	if !ok || !node.IsDocumentRoot {
+		documents = []any{native}
+	}
+	return renderer.Render(w, documents)
+}
+
+// EvaluateFileWithRenderer evaluates a file and renders it with a renderer
+func (e *engine) EvaluateFileWithRenderer(w io.Writer, path string, renderer Renderer) error {
+	env := e.newEnv()
+	evaluated, err := core.CallEngineByPath(path, "", env, e)
+	if err != nil {
+		return err
+	}
+
+	if !e.disableTypeCheck {
+		err = e.verifyTypes(evaluated)
+		if err != nil {
+			return err
+		}
+	}
+
+	return e.RenderWith(w, evaluated, renderer)
+}
+
+// JSONRenderer writes a single document as indented JSON
+type JSONRenderer struct{}
+
+func (JSONRenderer) Render(w io.Writer, documents []any) error {
+	document, err := singleDocument("json", documents)
+	if err != nil {
+		return fmt.Errorf("%w; use json-array or ndjson for several documents", err)
+	}
+	result, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(result))
+	return err
+}
+
+// JSONArrayRenderer writes all documents as one indented JSON array
+type JSONArrayRenderer struct{}
+
+func (JSONArrayRenderer) Render(w io.Writer, documents []any) error {
+	result, err := json.MarshalIndent(documents, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(result))
+	return err
+}
+
+// NDJSONRenderer writes every document as compact JSON on its own line
+type NDJSONRenderer struct{}
+
+func (NDJSONRenderer) Render(w io.Writer, documents []any) error {
+	for _, document := range documents {
+		result, err := json.Marshal(document)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(result))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListRenderer wraps all documents in a Kubernetes v1/List
+type ListRenderer struct{}
+
+func (ListRenderer) Render(w io.Writer, documents []any) error {
+	for i, document := range documents {
+		id := diff.IdentityOf(document)
+		if id.APIVersion == "" || id.Kind == "" {
+			return fmt.Errorf("list output requires Kubernetes manifests, but document %d has no apiVersion or kind", i)
+		}
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	err := enc.Encode(struct {
+		APIVersion string `yaml:"apiVersion"`
+		Kind       string `yaml:"kind"`
+		Items      []any  `yaml:"items"`
+	}{"v1", "List", documents})
+	if err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// TOMLRenderer writes a single map document as TOML
+type TOMLRenderer struct{}
+
+func (TOMLRenderer) Render(w io.Writer, documents []any) error {
+	document, err := singleDocument("toml", documents)
+	if err != nil {
+		return err
+	}
+	if _, ok := document.(map[string]any); !ok {
+		return fmt.Errorf("toml output requires a map document, got %s", describe(document))
+	}
+	err = walkScalars("", document, func(path string, value any) error {
+		if value == nil {
+			return fmt.Errorf("toml cannot represent null at %s", path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	enc := toml.NewEncoder(w)
+	enc.SetIndentTables(true)
+	return enc.Encode(document)
+}
+
+// PropertiesRenderer writes a single map document as a Java properties file.
+// Nested maps are flattened to dotted keys and sequences to indexed keys, e.g. server.hosts[0].
+type PropertiesRenderer struct{}
+
+func (PropertiesRenderer) Render(w io.Writer, documents []any) error {
+	document, err := singleDocument("properties", documents)
+	if err != nil {
+		return err
+	}
+	if _, ok := document.(map[string]any); !ok {
+		return fmt.Errorf("properties output requires a map document, got %s", describe(document))
+	}
+
+	lines := make([]string, 0)
+	err = flatten("", document, func(key string, value any) error {
+		if value == nil {
+			return fmt.Errorf("properties cannot represent null at %s", key)
+		}
+		lines = append(lines, escapeProperty(key, true)+"="+escapeProperty(formatScalar(value), false))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, line := range lines {
+		_, err = fmt.Fprintln(w, line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DotenvRenderer writes a single flat map document as a .env file
+type DotenvRenderer struct{}
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func (DotenvRenderer) Render(w io.Writer, documents []any) error {
+	document, err := singleDocument("dotenv", documents)
+	if err != nil {
+		return err
+	}
+	m, ok := document.(map[string]any)
+	if !ok {
+		return fmt.Errorf("dotenv output requires a map document, got %s", describe(document))
+	}
+
+	buf := bytes.Buffer{}
+	for _, key := range sortedNativeKeys(m) {
+		if !envNamePattern.MatchString(key) {
+			return fmt.Errorf("dotenv output requires variable names, got %q", key)
+		}
+		value := m[key]
+		switch value.(type) {
+		case map[string]any, []any:
+			return fmt.Errorf("dotenv cannot represent %s at %s; only scalar values are allowed", describe(value), key)
+		case nil:
+			fmt.Fprintf(&buf, "%s=\n", key)
+		default:
+			fmt.Fprintf(&buf, "%s=%s\n", key, quoteEnv(formatScalar(value)))
+		}
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func singleDocument(format string, documents []any) (any, error) {
+	if len(documents) != 1 {
+		return nil, fmt.Errorf("%s output only supports a single document, but got %d", format, len(documents))
+	}
+	return documents[0], nil
+}
+
+func describe(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "a map"
+	case []any:
+		return "a sequence"
+	default:
+		return fmt.Sprintf("a scalar (%T)", value)
+	}
+}
+
+func sortedNativeKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// walkScalars calls fn for every scalar with its JSON pointer path
+func walkScalars(path string, value any, fn func(path string, value any) error) error {
+	switch v := value.(type) {
+	case map[string]any:
+		for _, key := range sortedNativeKeys(v) {
+			err := walkScalars(path+"/"+diff.EscapePointer(key), v[key], fn)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case []any:
+		for i, item := range v {
+			err := walkScalars(path+"/"+strconv.Itoa(i), item, fn)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		if path == "" {
+			path = "(root)"
+		}
+		return fn(path, value)
+	}
+}
+
+// flatten calls fn for every scalar with a dotted key, e.g. server.hosts[0].name
+func flatten(prefix string, value any, fn func(key string, value any) error) error {
+	switch v := value.(type) {
+	case map[string]any:
+		for _, key := range sortedNativeKeys(v) {
+			name := key
+			if prefix != "" {
+				name = prefix + "." + key
+			}
+			err := flatten(name, v[key], fn)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case []any:
+		for i, item := range v {
+			err := flatten(fmt.Sprintf("%s[%d]", prefix, i), item, fn)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fn(prefix, value)
+	}
+}
+
+func formatScalar(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// escapeProperty escapes a key or value for a properties file, writing non-ASCII characters as \uXXXX
+func escapeProperty(s string, key bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case r == '=' || r == ':' || r == '#' || r == '!':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r == ' ' && (key || i == 0):
+			b.WriteString(`\ `)
+		case r < 0x20 || r > 0x7e:
+			for _, unit := range utf16Units(r) {
+				fmt.Fprintf(&b, `\u%04x`, unit)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func utf16Units(r rune) []rune {
+	if r < 0x10000 {
+		return []rune{r}
+	}
+	r -= 0x10000
+	return []rune{0xd800 + (r>>10)&0x3ff, 0xdc00 + r&0x3ff}
+}
+
+// quoteEnv double quotes a dotenv value unless it only contains safe characters
+func quoteEnv(s string) string {
+	safe := s != ""
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("_-./:@+,", r)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "$", `\$`).Replace(s) + `"`
+}
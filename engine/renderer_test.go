@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderers(t *testing.T) {
+	config := map[string]any{
+		"name": "web app",
+		"server": map[string]any{
+			"port":  8080,
+			"hosts": []any{"a", "b"},
+		},
+	}
+
+	tests := []struct {
+		renderer  string
+		documents []any
+		expected  string
+		err       string
+	}{
+		{"json", []any{config, config}, "", "json output only supports a single document, but got 2; use json-array or ndjson for several documents"},
+		{"ndjson", []any{map[string]any{"a": 1}, []any{true}}, "{\"a\":1}\n[true]\n", ""},
+		{"list", []any{map[string]any{"apiVersion": "v1", "kind": "Namespace"}}, "apiVersion: v1\nkind: List\nitems:\n  - apiVersion: v1\n    kind: Namespace\n", ""},
+		{"list", []any{config}, "", "list output requires Kubernetes manifests, but document 0 has no apiVersion or kind"},
+		{"toml", []any{config}, "name = 'web app'\n\n[server]\n  hosts = ['a', 'b']\n  port = 8080\n", ""},
+		{"toml", []any{map[string]any{"a": []any{nil}}}, "", "toml cannot represent null at /a/0"},
+		{"properties", []any{config}, "name=web app\nserver.hosts[0]=a\nserver.hosts[1]=b\nserver.port=8080\n", ""},
+		{"properties", []any{map[string]any{"a key": "x=ü\n"}}, "a\\ key=x\\=\\u00fc\\n\n", ""},
+		{"properties", []any{[]any{1}}, "", "properties output requires a map document, got a sequence"},
+		{"dotenv", []any{map[string]any{"PORT": 8080, "GREETING": "hello \"$USER\"", "EMPTY": nil}}, "EMPTY=\nGREETING=\"hello \\\"\\$USER\\\"\"\nPORT=8080\n", ""},
+		{"dotenv", []any{config}, "", "dotenv cannot represent a map at server; only scalar values are allowed"},
+		{"dotenv", []any{map[string]any{"not-a-name": 1}}, "", "dotenv output requires variable names, got \"not-a-name\""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.renderer, func(t *testing.T) {
+			renderer, ok := GetRenderer(test.renderer)
+			if !ok {
+				t.Fatalf("renderer %s is not registered", test.renderer)
+			}
+
+			buf := bytes.Buffer{}
+			err := renderer.Render(&buf, test.documents)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, buf.String())
+		})
+	}
+}
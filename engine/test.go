@@ -0,0 +1,203 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/totegamma/yisp/core"
+	"github.com/totegamma/yisp/diff"
+)
+
+// TestCase is a deftest form collected while evaluating with Options.CollectTests
+type TestCase struct {
+	Name string
+	Node *core.YispNode
+	Body []*core.YispNode
+	Env  *core.Env
+}
+
+// AssertionFailure is a failed assert form inside a test
+type AssertionFailure struct {
+	Message string
+	File    string
+	Line    int
+	Column  int
+}
+
+func (f AssertionFailure) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", f.File, f.Line, f.Column, f.Message)
+}
+
+type TestResult struct {
+	Name     string
+	File     string
+	Line     int
+	Failures []AssertionFailure
+	// Err is an evaluation error that stopped the test
+	Err      error
+	Duration time.Duration
+}
+
+func (r TestResult) Passed() bool {
+	return len(r.Failures) == 0 && r.Err == nil
+}
+
+// Tests returns the deftest forms evaluated so far
+func (e *engine) Tests() []*TestCase {
+	return e.tests
+}
+
+// RunTest evaluates the body of a test, collecting every failed assertion
+func (e *engine) RunTest(test *TestCase) TestResult {
+	start := time.Now()
+
+	failures := make([]AssertionFailure, 0)
+	e.failures = &failures
+	defer func() { e.failures = nil }()
+
+	result := TestResult{
+		Name: test.Name,
+		File: test.Node.Attr.File(),
+		Line: test.Node.Attr.Line(),
+	}
+
+	env := test.Env.CreateChild()
+	for _, node := range test.Body {
+		_, err := e.Eval(node, env, core.EvalModeEval)
+		if err != nil {
+			result.Err = err
+			break
+		}
+	}
+
+	result.Failures = failures
+	result.Duration = time.Since(start)
+	return result
+}
+
+// evalDeftest records a test to be run later. Outside of yisp test it does nothing.
+func (e *engine) evalDeftest(nodes []*core.YispNode, env *core.Env) (*core.YispNode, error) {
+	if len(nodes) < 2 {
+		return nil, core.NewEvaluationError(nodes[0], "deftest requires a name")
+	}
+	name, ok := nodes[1].Value.(string)
+	if !ok {
+		return nil, core.NewEvaluationError(nodes[1], fmt.Sprintf("invalid test name type: %T", nodes[1].Value))
+	}
+
+	if e.collectTests {
+		e.tests = append(e.tests, &TestCase{
+			Name: name,
+			Node: nodes[0],
+			Body: nodes[2:],
+			Env:  env,
+		})
+	}
+
+	return &core.YispNode{Kind: core.KindNull}, nil
+}
+
+// evalAssert checks that a condition is truthy: [assert, cond, message?]
+func (e *engine) evalAssert(nodes []*core.YispNode, env *core.Env, mode core.EvalMode) (*core.YispNode, error) {
+	if len(nodes) != 2 && len(nodes) != 3 {
+		return nil, core.NewEvaluationError(nodes[0], "assert requires a condition and an optional message")
+	}
+
+	condNode, err := e.Eval(nodes[1], env, mode)
+	if err != nil {
+		return nil, core.NewEvaluationErrorWithParent(nodes[1], "failed to evaluate condition", err)
+	}
+	cond, err := core.IsTruthy(condNode)
+	if err != nil {
+		return nil, core.NewEvaluationErrorWithParent(nodes[1], "failed to evaluate condition", err)
+	}
+	if cond {
+		return &core.YispNode{Kind: core.KindNull}, nil
+	}
+
+	message := "assertion failed"
+	if len(nodes) == 3 {
+		messageNode, err := e.Eval(nodes[2], env, mode)
+		if err != nil {
+			return nil, core.NewEvaluationErrorWithParent(nodes[2], "failed to evaluate message", err)
+		}
+		message = fmt.Sprintf("assertion failed: %v", messageNode.Value)
+	}
+	return e.fail(nodes[0], message)
+}
+
+// evalAssertEqual checks that two values are structurally equal: [assert-equal, expected, actual]
+func (e *engine) evalAssertEqual(nodes []*core.YispNode, env *core.Env, mode core.EvalMode) (*core.YispNode, error) {
+	if len(nodes) != 3 {
+		return nil, core.NewEvaluationError(nodes[0], fmt.Sprintf("assert-equal requires 2 arguments, got %d", len(nodes)-1))
+	}
+
+	values := make([]any, 2)
+	for i, node := range nodes[1:] {
+		evaluated, err := e.Eval(node, env, mode)
+		if err != nil {
+			return nil, core.NewEvaluationErrorWithParent(node, "failed to evaluate argument", err)
+		}
+		values[i], err = evaluated.ToNative()
+		if err != nil {
+			return nil, core.NewEvaluationErrorWithParent(node, "failed to convert argument", err)
+		}
+	}
+
+	changes := diff.Values(values[0], values[1])
+	if len(changes) == 0 {
+		return &core.YispNode{Kind: core.KindNull}, nil
+	}
+
+	lines := make([]string, 0, len(changes))
+	for _, change := range changes {
+		lines = append(lines, change.String())
+	}
+	return e.fail(nodes[0], "values differ (expected -> actual):\n"+strings.Join(lines, "\n"))
+}
+
+// evalAssertError checks that evaluating an expression fails: [assert-error, expr, substring?]
+func (e *engine) evalAssertError(nodes []*core.YispNode, env *core.Env, mode core.EvalMode) (*core.YispNode, error) {
+	if len(nodes) != 2 && len(nodes) != 3 {
+		return nil, core.NewEvaluationError(nodes[0], "assert-error requires an expression and an optional message substring")
+	}
+
+	var substring string
+	if len(nodes) == 3 {
+		substringNode, err := e.Eval(nodes[2], env, mode)
+		if err != nil {
+			return nil, core.NewEvaluationErrorWithParent(nodes[2], "failed to evaluate message", err)
+		}
+		substring = fmt.Sprint(substringNode.Value)
+	}
+
+	// failures of nested assertions are part of the expected error
+	failures := e.failures
+	e.failures = nil
+	_, err := e.Eval(nodes[1], env, mode)
+	e.failures = failures
+
+	if err == nil {
+		return e.fail(nodes[0], "expected an error, but evaluation succeeded")
+	}
+	if substring != "" && !strings.Contains(err.Error(), substring) {
+		message, _, _ := strings.Cut(err.Error(), "\n")
+		return e.fail(nodes[0], fmt.Sprintf("expected an error containing %q, got: %s", substring, message))
+	}
+	return &core.YispNode{Kind: core.KindNull}, nil
+}
+
+// fail records an assertion failure when running a test, otherwise it aborts evaluation
+func (e *engine) fail(node *core.YispNode, message string) (*core.YispNode, error) {
+	if e.failures == nil {
+		return nil, core.NewEvaluationError(node, message)
+	}
+	*e.failures = append(*e.failures, AssertionFailure{
+		Message: message,
+		File:    node.Attr.File(),
+		Line:    node.Attr.Line(),
+		Column:  node.Attr.Column(),
+	})
+	return &core.YispNode{Kind: core.KindNull}, nil
+}
@@ -0,0 +1,156 @@
+package engine
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+
+	"github.com/totegamma/yisp/core"
+)
+
+// TraceEvent is a single line of the structured evaluation trace
+type TraceEvent struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"`
+	Kind     string    `json:"kind"`
+	Name     string    `json:"name,omitempty"`
+	Node     string    `json:"node,omitempty"`
+	Tag      string    `json:"tag,omitempty"`
+	File     string    `json:"file,omitempty"`
+	Line     int       `json:"line,omitempty"`
+	Column   int       `json:"column,omitempty"`
+	Depth    int       `json:"depth"`
+	Duration int64     `json:"durationNs,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// TraceFilter limits which events are written.
+// Files are doublestar globs matched against the absolute and the working directory relative path.
+// Operators selects the subtrees below calls of the named operators or lambdas.
+// MaxDepth drops events nested deeper than the given depth when it is positive.
+type TraceFilter struct {
+	Files     []string
+	Operators []string
+	MaxDepth  int
+}
+
+type traceFrame struct {
+	event   TraceEvent
+	start   time.Time
+	matched bool
+	emitted bool
+}
+
+// Tracer writes enter and exit events of evaluation frames as JSON lines
+type Tracer struct {
+	encoder *json.Encoder
+	filter  TraceFilter
+	stack   []*traceFrame
+	wd      string
+}
+
+func NewTracer(w io.Writer, filter TraceFilter) *Tracer {
+	wd, _ := os.Getwd()
+	return &Tracer{
+		encoder: json.NewEncoder(w),
+		filter:  filter,
+		wd:      wd,
+	}
+}
+
+// Enter starts a frame. Every Enter must be paired with an Exit.
+func (t *Tracer) Enter(kind, name string, node *core.YispNode) {
+	event := TraceEvent{
+		Event: "enter",
+		Kind:  kind,
+		Name:  name,
+		Depth: len(t.stack),
+	}
+	if node != nil {
+		event.Node = node.Kind.String()
+		event.Tag = node.Tag
+		event.File = node.Attr.File()
+		event.Line = node.Attr.Line()
+		event.Column = node.Attr.Column()
+	}
+
+	matched := len(t.filter.Operators) == 0
+	if len(t.stack) > 0 && t.stack[len(t.stack)-1].matched {
+		matched = true
+	}
+	if (kind == FrameKindOperator || kind == FrameKindLambda) && slices.Contains(t.filter.Operators, name) {
+		matched = true
+	}
+
+	frame := &traceFrame{
+		event:   event,
+		start:   time.Now(),
+		matched: matched,
+	}
+	frame.emitted = matched && t.accepts(event)
+	t.stack = append(t.stack, frame)
+
+	if frame.emitted {
+		event.Time = frame.start
+		t.encoder.Encode(event)
+	}
+}
+
+// Exit ends the innermost frame and records the error it returned, if any
+func (t *Tracer) Exit(err error) {
+	if len(t.stack) == 0 {
+		return
+	}
+
+	frame := t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+
+	if !frame.emitted {
+		return
+	}
+
+	event := frame.event
+	event.Event = "exit"
+	event.Time = time.Now()
+	event.Duration = event.Time.Sub(frame.start).Nanoseconds()
+	if err != nil {
+		event.Error = err.Error()
+		if evalErr, ok := err.(*core.ErrorTypeEvaluation); ok {
+			event.Error = evalErr.Message
+		}
+	}
+
+	t.encoder.Encode(event)
+}
+
+func (t *Tracer) accepts(event TraceEvent) bool {
+	if t.filter.MaxDepth > 0 && event.Depth > t.filter.MaxDepth {
+		return false
+	}
+
+	if len(t.filter.Files) > 0 {
+		if event.File == "" {
+			return false
+		}
+		rel, err := filepath.Rel(t.wd, event.File)
+		if err != nil {
+			rel = event.File
+		}
+		for _, pattern := range t.filter.Files {
+			if ok, _ := doublestar.Match(pattern, event.File); ok {
+				return true
+			}
+			if ok, _ := doublestar.Match(pattern, rel); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,45 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceInclude(t *testing.T) {
+	var buf bytes.Buffer
+	profiler := NewProfiler()
+	e := NewEngine(Options{
+		AllowUntypedManifest: true,
+		Tracer:               NewTracer(&buf, TraceFilter{}),
+		Profiler:             profiler,
+	})
+
+	file, err := filepath.Abs("../testdata/25_patch-batch.test.yisp")
+	assert.NoError(t, err)
+	_, err = e.EvaluateFileToYaml(file)
+	assert.NoError(t, err)
+
+	included := filepath.Join(filepath.Dir(file), "resource.yaml")
+	events := make(map[string]int)
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		var event TraceEvent
+		assert.NoError(t, decoder.Decode(&event))
+		if event.Kind == FrameKindInclude && event.Name == included {
+			events[event.Event]++
+		}
+	}
+	assert.Equal(t, map[string]int{"enter": 1, "exit": 1}, events)
+
+	found := false
+	for _, entry := range profiler.Entries() {
+		if entry.Kind == FrameKindInclude && entry.Name == included {
+			found = true
+		}
+	}
+	assert.True(t, found, "expected a profile entry for the included file")
+}
@@ -145,11 +145,3 @@ func compareNumbers(cdr []*core.YispNode, opName string, cmp func(float64, float
 		Value: cmp(firstNum, secondNum),
 	}, nil
 }
-
-func pad(length int) string {
-	result := ""
-	for range length {
-		result += "  "
-	}
-	return result
-}
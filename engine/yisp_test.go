@@ -3,6 +3,7 @@ package engine
 import (
 	"errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/totegamma/yisp/core"
 	"github.com/totegamma/yisp/internal/yaml"
 	"io"
 	"os"
@@ -83,3 +84,122 @@ func TestYisp(t *testing.T) {
 	}
 
 }
+
+func TestManifestSchemaFromRegistry(t *testing.T) {
+	schemas := core.NewMemorySchemaRegistry()
+	schemas.Add("example.com.v1.App", &core.Schema{
+		Type: "object",
+		Properties: map[string]*core.Schema{
+			"apiVersion": {Type: "string"},
+			"kind":       {Type: "string"},
+			"replicas":   {Type: "integer"},
+		},
+	})
+	schemas.AddGVK("example.com", "v1", "App", "example.com.v1.App")
+	e := NewEngine(Options{SchemaRegistry: schemas})
+
+	_, err := e.EvaluateReaderToYaml(strings.NewReader("apiVersion: example.com/v1\nkind: App\nreplicas: 2\n"), "app.yaml")
+	assert.NoError(t, err)
+
+	_, err = e.EvaluateReaderToYaml(strings.NewReader("apiVersion: example.com/v1\nkind: App\nreplicas: two\n"), "app.yaml")
+	assert.Error(t, err)
+
+	_, err = e.EvaluateReaderToYaml(strings.NewReader("apiVersion: example.com/v1\nkind: Other\n"), "app.yaml")
+	assert.Error(t, err)
+}
+
+func TestRegisterCRD(t *testing.T) {
+	crd := `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+  versions:
+    - name: v1
+      served: true
+      schema:
+        openAPIV3Schema:
+          type: object
+          properties:
+            spec:
+              type: object
+              properties:
+                size:
+                  x-kubernetes-int-or-string: true
+                ports:
+                  type: array
+                  x-kubernetes-list-type: map
+                  x-kubernetes-list-map-keys: [name]
+                  items:
+                    type: object
+                    properties:
+                      name: {type: string}
+`
+	evaluate := func(spec string) error {
+		schemas := core.NewMemorySchemaRegistry()
+		schemas.Add("crd", &core.Schema{Type: "object", K8sPreserveUnknownFields: true})
+		schemas.AddGVK("apiextensions.k8s.io", "v1", "CustomResourceDefinition", "crd")
+		e := NewEngine(Options{SchemaRegistry: schemas})
+		src := "!yisp\n- progn\n- - k8s.register-crd\n  - !quote\n" + indent(crd, "    ") +
+			"- !quote\n  apiVersion: example.com/v1\n  kind: Widget\n  metadata:\n    name: w\n  spec:\n" + indent(spec, "    ")
+		_, err := e.EvaluateReaderToYaml(strings.NewReader(src), "widget.yisp")
+		return err
+	}
+
+	assert.NoError(t, evaluate("size: 10%\nports:\n- name: http\n- name: https\n"))
+	assert.Error(t, evaluate("size: [1]\n"))
+	assert.Error(t, evaluate("ports:\n- name: http\n- name: http\n"))
+}
+
+func TestRegisteredSchemaRefs(t *testing.T) {
+	schemas := core.NewMemorySchemaRegistry()
+	schemas.Add("io.k8s.api.core.v1.Container", &core.Schema{
+		Type:       "object",
+		Properties: map[string]*core.Schema{"image": {Type: "string"}},
+	})
+	e := NewEngine(Options{SchemaRegistry: schemas})
+	e.RegisterSchema("example.com", "v1", "App", &core.Schema{
+		Type: "object",
+		Properties: map[string]*core.Schema{
+			"apiVersion": {Type: "string"},
+			"kind":       {Type: "string"},
+			"main":       {Ref: "#/definitions/io.k8s.api.core.v1.Container"},
+		},
+	})
+
+	_, err := e.EvaluateReaderToYaml(strings.NewReader("apiVersion: example.com/v1\nkind: App\nmain:\n  image: nginx\n"), "app.yaml")
+	assert.NoError(t, err)
+
+	_, err = e.EvaluateReaderToYaml(strings.NewReader("apiVersion: example.com/v1\nkind: App\nmain:\n  image: 1\n"), "app.yaml")
+	assert.Error(t, err)
+}
+
+func indent(s, prefix string) string {
+	lines := strings.SplitAfter(strings.TrimSuffix(s, "\n"), "\n")
+	return prefix + strings.Join(lines, prefix) + "\n"
+}
+
+func TestImportWithFormat(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "greet.module"), []byte("!yisp &greet\n- lambda\n- [!string name]\n- [strings.concat, \"hello \", *name]\n"), 0644)
+	if err != nil {
+		t.Fatalf("Error writing module: %v", err)
+	}
+
+	e := NewEngine(Options{})
+	rendered, err := e.EvaluateReaderToYaml(strings.NewReader(`!yisp
+- import
+- [greet, {path: greet.module, format: yisp}]
+---
+message: !yisp [*greet.greet, world]
+`), filepath.Join(dir, "main.yisp"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "message: hello world\n", rendered)
+	}
+
+	_, err = e.EvaluateReaderToYaml(strings.NewReader("!yisp\n- import\n- [greet, {path: greet.module, format: json}]\n"), filepath.Join(dir, "main.yisp"))
+	assert.ErrorContains(t, err, "import only reads yisp modules")
+}
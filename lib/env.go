@@ -0,0 +1,160 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/totegamma/yisp/core"
+)
+
+func init() {
+	register("env", "get", opEnvGet)
+	register("env", "require", opEnvRequire)
+	register("env", "lookup", opEnvLookup)
+	register("env", "load-dotenv", opEnvLoadDotenv)
+}
+
+// lookupEnv reads an environment variable if its name matches the allowlist of the engine
+func lookupEnv(node *core.YispNode, e core.Engine) (string, bool, error) {
+	name, ok := node.Value.(string)
+	if !ok {
+		return "", false, core.NewEvaluationError(node, fmt.Sprintf("invalid environment variable name type: %T", node.Value))
+	}
+
+	allowedEnvVars := []string{}
+	allowedEnvVarsAny, ok := e.GetOption("net.gammalab.yisp.env.allowed_vars")
+	if ok {
+		allowedEnvVars, ok = allowedEnvVarsAny.([]string)
+		if !ok {
+			return "", false, core.NewEvaluationError(node, fmt.Sprintf("invalid net.gammalab.yisp.env.allowed_vars option type: %T", allowedEnvVarsAny))
+		}
+	}
+
+	allowed := false
+	for _, stmt := range allowedEnvVars {
+		regex := "^" + strings.ReplaceAll(regexp.QuoteMeta(stmt), "\\*", ".*") + "$"
+		matched, err := regexp.MatchString(regex, name)
+		if err != nil {
+			return "", false, core.NewEvaluationError(node, fmt.Sprintf("failed to match environment variable %s with regex %s: %v", name, regex, err))
+		}
+		if matched {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return "", false, core.NewEvaluationError(node, fmt.Sprintf("environment variable %s is not allowed. Run command below to allow it:\n\nyisp allow --env %s", name, name))
+	}
+
+	value, ok := os.LookupEnv(name)
+	if ok {
+		core.RecordInput(e, core.InputEnv, name, []byte(value))
+	} else {
+		core.RecordInput(e, core.InputEnv, name, nil)
+	}
+	return value, ok, nil
+}
+
+// opEnvGet returns an environment variable, or null if it is not set
+func opEnvGet(cdr []*core.YispNode, env *core.Env, mode core.EvalMode, e core.Engine) (*core.YispNode, error) {
+	if len(cdr) != 1 {
+		return nil, core.NewEvaluationError(nil, fmt.Sprintf("env.get requires 1 argument, got %d", len(cdr)))
+	}
+
+	value, ok, err := lookupEnv(cdr[0], e)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return &core.YispNode{
+			Kind: core.KindNull,
+			Attr: cdr[0].Attr,
+		}, nil
+	}
+
+	return &core.YispNode{
+		Kind:  core.KindString,
+		Value: value,
+		Attr:  cdr[0].Attr,
+	}, nil
+}
+
+// opEnvRequire returns an environment variable and fails if it is not set or empty
+func opEnvRequire(cdr []*core.YispNode, env *core.Env, mode core.EvalMode, e core.Engine) (*core.YispNode, error) {
+	if len(cdr) != 1 && len(cdr) != 2 {
+		return nil, core.NewEvaluationError(nil, fmt.Sprintf("env.require requires a name and an optional message, got %d arguments", len(cdr)))
+	}
+
+	value, ok, err := lookupEnv(cdr[0], e)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || value == "" {
+		message := fmt.Sprintf("environment variable %s is required but not set", cdr[0].Value)
+		if len(cdr) == 2 {
+			message += fmt.Sprintf(": %v", cdr[1].Value)
+		}
+		return nil, core.NewEvaluationError(cdr[0], message)
+	}
+
+	return &core.YispNode{
+		Kind:  core.KindString,
+		Value: value,
+		Attr:  cdr[0].Attr,
+	}, nil
+}
+
+// opEnvLookup returns an environment variable, or the default if it is not set
+func opEnvLookup(cdr []*core.YispNode, env *core.Env, mode core.EvalMode, e core.Engine) (*core.YispNode, error) {
+	if len(cdr) != 2 {
+		return nil, core.NewEvaluationError(nil, fmt.Sprintf("env.lookup requires 2 arguments, got %d", len(cdr)))
+	}
+
+	value, ok, err := lookupEnv(cdr[0], e)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return cdr[1], nil
+	}
+
+	return &core.YispNode{
+		Kind:  core.KindString,
+		Value: value,
+		Attr:  cdr[0].Attr,
+	}, nil
+}
+
+// opEnvLoadDotenv reads a .env file relative to the current file into a map of strings.
+// It does not change the environment, so its values are not subject to the allowlist.
+func opEnvLoadDotenv(cdr []*core.YispNode, env *core.Env, mode core.EvalMode, e core.Engine) (*core.YispNode, error) {
+	if len(cdr) != 1 {
+		return nil, core.NewEvaluationError(nil, fmt.Sprintf("env.load-dotenv requires 1 argument, got %d", len(cdr)))
+	}
+
+	str, ok := cdr[0].Value.(string)
+	if !ok {
+		return nil, core.NewEvaluationError(cdr[0], fmt.Sprintf("invalid argument type for load-dotenv: %T", cdr[0].Value))
+	}
+
+	path := str
+	if cdr[0].Attr.File() != "" {
+		path = filepath.Clean(filepath.Join(filepath.Dir(cdr[0].Attr.File()), str))
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, core.NewEvaluationError(cdr[0], fmt.Sprintf("failed to read file: %s", path))
+	}
+	defer file.Close()
+	core.RecordFile(e, path)
+
+	result, err := core.ParseDotenv(path, file)
+	if err != nil {
+		return nil, core.NewEvaluationErrorWithParent(cdr[0], "failed to parse dotenv file", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,156 @@
+package lib_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/totegamma/yisp/engine"
+)
+
+// evaluateEnv evaluates src as a file in dir, with the environment variables matching allowed readable
+func evaluateEnv(t *testing.T, dir, src string, allowed any) (string, error) {
+	t.Helper()
+	e := engine.NewEngine(engine.Options{AllowUntypedManifest: true})
+	if allowed != nil {
+		e.SetOption("net.gammalab.yisp.env.allowed_vars", allowed)
+	}
+	return e.EvaluateReaderToYaml(strings.NewReader(src), filepath.Join(dir, "index.yisp"))
+}
+
+func TestEnvAllowlist(t *testing.T) {
+	t.Setenv("YISP_TEST_APP_NAME", "web")
+	t.Setenv("YISP_TEST_SECRET", "hunter2")
+
+	tests := []struct {
+		name     string
+		src      string
+		allowed  any
+		expected string
+		err      string
+	}{
+		{
+			name:     "exact name",
+			src:      "!yisp [env.get, YISP_TEST_APP_NAME]",
+			allowed:  []string{"YISP_TEST_APP_NAME"},
+			expected: "web\n",
+		},
+		{
+			name:     "glob",
+			src:      "!yisp [env.get, YISP_TEST_APP_NAME]",
+			allowed:  []string{"YISP_TEST_APP_*"},
+			expected: "web\n",
+		},
+		{
+			name:    "denied name",
+			src:     "!yisp [env.get, YISP_TEST_SECRET]",
+			allowed: []string{"YISP_TEST_APP_*"},
+			err:     "environment variable YISP_TEST_SECRET is not allowed",
+		},
+		{
+			name:    "glob matches whole names only",
+			src:     "!yisp [env.get, YISP_TEST_APP_NAME]",
+			allowed: []string{"APP_*"},
+			err:     "environment variable YISP_TEST_APP_NAME is not allowed",
+		},
+		{
+			name: "no allowlist",
+			src:  "!yisp [env.get, YISP_TEST_APP_NAME]",
+			err:  "environment variable YISP_TEST_APP_NAME is not allowed",
+		},
+		{
+			name:    "invalid allowlist",
+			src:     "!yisp [env.get, YISP_TEST_APP_NAME]",
+			allowed: "YISP_TEST_APP_NAME",
+			err:     "invalid net.gammalab.yisp.env.allowed_vars option type: string",
+		},
+		{
+			name:     "unset variable",
+			src:      "value: !yisp [env.get, YISP_TEST_UNSET]",
+			allowed:  []string{"*"},
+			expected: "value: null\n",
+		},
+		{
+			name:    "require of an unset variable",
+			src:     "!yisp [env.require, YISP_TEST_UNSET, set it in CI]",
+			allowed: []string{"*"},
+			err:     "environment variable YISP_TEST_UNSET is required but not set: set it in CI",
+		},
+		{
+			name:     "require of a set variable",
+			src:      "!yisp [env.require, YISP_TEST_APP_NAME]",
+			allowed:  []string{"*"},
+			expected: "web\n",
+		},
+		{
+			name:    "require of a denied variable",
+			src:     "!yisp [env.require, YISP_TEST_SECRET]",
+			allowed: []string{"YISP_TEST_APP_*"},
+			err:     "environment variable YISP_TEST_SECRET is not allowed",
+		},
+		{
+			name:     "lookup default",
+			src:      "!yisp [env.lookup, YISP_TEST_UNSET, fallback]",
+			allowed:  []string{"*"},
+			expected: "fallback\n",
+		},
+		{
+			name:     "lookup of a set variable",
+			src:      "!yisp [env.lookup, YISP_TEST_APP_NAME, fallback]",
+			allowed:  []string{"*"},
+			expected: "web\n",
+		},
+		{
+			name:    "lookup of a denied variable",
+			src:     "!yisp [env.lookup, YISP_TEST_SECRET, fallback]",
+			allowed: []string{"YISP_TEST_APP_*"},
+			err:     "environment variable YISP_TEST_SECRET is not allowed",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output, err := evaluateEnv(t, t.TempDir(), test.src, test.allowed)
+			if test.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), test.err)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, output)
+		})
+	}
+}
+
+func TestEnvLoadDotenv(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, ".env"), []byte(`# database
+export HOST=db.local
+PORT=5432 # default port
+PASSWORD='p@ss #1'
+GREETING="hello\n\"world\""
+`), 0644)
+	if err != nil {
+		t.Fatalf("Error writing dotenv file: %v", err)
+	}
+
+	// the values of a dotenv file are read without an allowlist, since they are not the environment
+	output, err := evaluateEnv(t, dir, "!yisp [env.load-dotenv, ./.env]", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `HOST: db.local
+PORT: "5432"
+PASSWORD: 'p@ss #1'
+GREETING: |-
+  hello
+  "world"
+`, output)
+
+	_, err = evaluateEnv(t, dir, "!yisp [env.load-dotenv, ./missing.env]", nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "failed to read file")
+	}
+}
@@ -16,11 +16,32 @@ func init() {
 	register("exec", "go", opGoRun)
 }
 
+// checkExecEnabled fails if the engine does not run commands, e.g. in the language server,
+// where there is no one to confirm them and stdin carries the protocol
+func checkExecEnabled(node *core.YispNode, e core.Engine, op string) error {
+	disabledAny, ok := e.GetOption("net.gammalab.yisp.exec.disabled")
+	if !ok {
+		return nil
+	}
+	disabled, ok := disabledAny.(bool)
+	if !ok {
+		return core.NewEvaluationError(node, fmt.Sprintf("invalid net.gammalab.yisp.exec.disabled option type: %T", disabledAny))
+	}
+	if disabled {
+		return core.NewEvaluationError(node, fmt.Sprintf("%s is disabled: commands are not run here", op))
+	}
+	return nil
+}
+
 func opCmd(cdr []*core.YispNode, env *core.Env, mode core.EvalMode, e core.Engine) (*core.YispNode, error) {
+	core.RecordVolatile(e, "exec.cmd")
 
 	if len(cdr) != 1 {
 		return nil, core.NewEvaluationError(nil, fmt.Sprintf("cmdline requires 1 argument, got %d", len(cdr)))
 	}
+	if err := checkExecEnabled(cdr[0], e, "exec.cmd"); err != nil {
+		return nil, err
+	}
 
 	props := cdr[0]
 	if props.Kind != core.KindMap {
@@ -155,9 +176,13 @@ func opCmd(cdr []*core.YispNode, env *core.Env, mode core.EvalMode, e core.Engin
 }
 
 func opGoRun(cdr []*core.YispNode, env *core.Env, mode core.EvalMode, e core.Engine) (*core.YispNode, error) {
+	core.RecordVolatile(e, "exec.go")
 	if len(cdr) != 1 {
 		return nil, core.NewEvaluationError(nil, fmt.Sprintf("gorun requires 1 argument, got %d", len(cdr)))
 	}
+	if err := checkExecEnabled(cdr[0], e, "exec.go"); err != nil {
+		return nil, err
+	}
 	props := cdr[0]
 	if props.Kind != core.KindMap {
 		return nil, core.NewEvaluationError(props, fmt.Sprintf("gorun requires a map argument, got %v", props.Kind))
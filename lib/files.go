@@ -36,6 +36,7 @@ func opGlob(cdr []*core.YispNode, env *core.Env, mode core.EvalMode, e core.Engi
 		if err != nil {
 			return nil, core.NewEvaluationError(node, fmt.Sprintf("failed to glob path: %s", entry))
 		}
+		core.RecordGlob(e, filepath.Dir(node.Attr.File()), entry)
 
 		for _, path := range paths {
 
@@ -50,6 +51,7 @@ func opGlob(cdr []*core.YispNode, env *core.Env, mode core.EvalMode, e core.Engi
 			if err != nil {
 				return nil, core.NewEvaluationError(node, fmt.Sprintf("failed to read file: %s", path))
 			}
+			core.RecordFile(e, includedFile)
 
 			value := core.NewYispMap()
 			value.Set("path", &core.YispNode{
@@ -108,6 +110,7 @@ func opReadAll(cdr []*core.YispNode, env *core.Env, mode core.EvalMode, e core.E
 	if err != nil {
 		return nil, core.NewEvaluationError(cdr[0], fmt.Sprintf("failed to read file: %s", path))
 	}
+	core.RecordFile(e, path)
 
 	return &core.YispNode{
 		Kind:  core.KindString,
@@ -8,6 +8,7 @@ import (
 
 func init() {
 	register("k8s", "patch", opPatch)
+	register("k8s", "register-crd", opRegisterCRD)
 }
 
 func opPatch(cdr []*core.YispNode, env *core.Env, mode core.EvalMode, e core.Engine) (*core.YispNode, error) {
@@ -67,6 +68,51 @@ func opPatch(cdr []*core.YispNode, env *core.Env, mode core.EvalMode, e core.Eng
 	return targets, nil
 }
 
+// opRegisterCRD makes the schemas of CustomResourceDefinitions the schemas of their custom resources
+// for the rest of the build, and returns its argument so that the CRDs can be output as well
+func opRegisterCRD(cdr []*core.YispNode, env *core.Env, mode core.EvalMode, e core.Engine) (*core.YispNode, error) {
+	if len(cdr) != 1 {
+		return nil, core.NewEvaluationError(nil, fmt.Sprintf("register-crd requires 1 argument, got %d", len(cdr)))
+	}
+
+	registrar, ok := e.(core.SchemaRegistrar)
+	if !ok {
+		return nil, core.NewEvaluationError(cdr[0], "register-crd is not supported by this engine")
+	}
+
+	crds := []*core.YispNode{cdr[0]}
+	if cdr[0].Kind == core.KindArray {
+		crds = crds[:0]
+		for _, item := range cdr[0].Value.([]any) {
+			itemNode, ok := item.(*core.YispNode)
+			if !ok {
+				return nil, core.NewEvaluationError(cdr[0], fmt.Sprintf("invalid item type: %T", item))
+			}
+			crds = append(crds, itemNode)
+		}
+	}
+
+	for _, crd := range crds {
+		native, err := crd.ToNative()
+		if err != nil {
+			return nil, core.NewEvaluationErrorWithParent(crd, "failed to read CustomResourceDefinition", err)
+		}
+		manifest, ok := native.(map[string]any)
+		if !ok {
+			return nil, core.NewEvaluationError(crd, fmt.Sprintf("register-crd requires a CustomResourceDefinition, got %s", crd.Kind))
+		}
+		schemas, err := core.CRDSchemas(manifest)
+		if err != nil {
+			return nil, core.NewEvaluationError(crd, err.Error())
+		}
+		for _, schema := range schemas {
+			registrar.RegisterSchema(schema.Group, schema.Version, schema.Kind, schema.Schema)
+		}
+	}
+
+	return cdr[0], nil
+}
+
 type manifestID struct {
 	apiVersion string
 	kind       string
@@ -1,6 +1,8 @@
 package lib
 
 import (
+	"slices"
+
 	"github.com/totegamma/yisp/core"
 )
 
@@ -22,3 +24,13 @@ func GetOperator(module, name string) (core.YispOperator, bool) {
 	op, ok := operators[moduleOperator{Module: module, Name: name}]
 	return op, ok
 }
+
+// OperatorNames returns every registered operator as "module.name", sorted
+func OperatorNames() []string {
+	names := make([]string, 0, len(operators))
+	for key := range operators {
+		names = append(names, key.Module+"."+key.Name)
+	}
+	slices.Sort(names)
+	return names
+}
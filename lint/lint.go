@@ -0,0 +1,724 @@
+package lint
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/totegamma/yisp/core"
+	"github.com/totegamma/yisp/engine"
+	"github.com/totegamma/yisp/internal/yaml"
+	"github.com/totegamma/yisp/lib"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Rules reported by the linter
+const (
+	RuleParseError      = "parse-error"
+	RuleUndefinedSymbol = "undefined-symbol"
+	RuleUnknownOperator = "unknown-operator"
+	RuleArity           = "arity-mismatch"
+	RuleUnusedAnchor    = "unused-anchor"
+	RuleUnusedImport    = "unused-import"
+	RuleShadowed        = "shadowed-name"
+)
+
+var ruleDescriptions = map[string]string{
+	RuleParseError:      "The file is not valid yisp",
+	RuleUndefinedSymbol: "A *reference does not resolve to an anchor, import or lambda parameter",
+	RuleUnknownOperator: "The head of a call is not a known operator",
+	RuleArity:           "A lambda is called with a different number of arguments than it declares",
+	RuleUnusedAnchor:    "An anchor is never referenced",
+	RuleUnusedImport:    "An imported module is never referenced",
+	RuleShadowed:        "A name hides or redefines another name",
+}
+
+// errorLinePattern extracts the line number from yaml syntax errors
+var errorLinePattern = regexp.MustCompile(`line (\d+):`)
+
+// builtinNames are bound in every root environment
+var builtinNames = []string{"null", "bool", "int", "float", "string"}
+
+type Diagnostic struct {
+	Rule     string
+	Severity Severity
+	Message  string
+	File     string
+	Line     int
+	Column   int
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s [%s]", d.File, d.Line, d.Column, d.Severity, d.Message, d.Rule)
+}
+
+type Options struct {
+	// Globals are names provided by the caller's environment, e.g. "items" for krm functions
+	Globals []string
+	// Sources holds file contents by absolute path that take precedence over the files on disk,
+	// e.g. unsaved editor buffers
+	Sources map[string][]byte
+}
+
+// Definition is an anchor defined in a module
+type Definition struct {
+	Name   string
+	Node   *core.YispNode
+	Params []string // parameter names if the anchor is a lambda
+	Lambda bool
+	used   bool
+}
+
+// Import is a module bound by an import form
+type Import struct {
+	Name   string
+	Node   *core.YispNode
+	Module *Module // nil if the module could not be resolved statically
+	used   bool
+}
+
+// Module is the static view of a yisp file
+type Module struct {
+	Path      string
+	Documents []*core.YispNode
+	Anchors   map[string]*Definition
+	Imports   map[string]*Import
+	imported  bool
+	parseErr  *Diagnostic
+}
+
+type scope struct {
+	parent *scope
+	names  map[string]*core.YispNode
+}
+
+func (s *scope) lookup(name string) (*core.YispNode, bool) {
+	for sc := s; sc != nil; sc = sc.parent {
+		if node, ok := sc.names[name]; ok {
+			return node, true
+		}
+	}
+	return nil, false
+}
+
+type linter struct {
+	opts        Options
+	modules     map[string]*Module
+	operators   []string
+	diagnostics []Diagnostic
+}
+
+// Lint statically analyzes the given yisp files without evaluating them.
+// Imported files are parsed to resolve references into them.
+func Lint(paths []string, opts Options) ([]Diagnostic, error) {
+	l := &linter{
+		opts:      opts,
+		modules:   make(map[string]*Module),
+		operators: append(engine.OperatorNames(), lib.OperatorNames()...),
+	}
+
+	entries := make([]*Module, 0, len(paths))
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		m, err := l.load(abs)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, m)
+	}
+
+	for _, m := range entries {
+		if m.parseErr != nil {
+			l.diagnostics = append(l.diagnostics, *m.parseErr)
+			continue
+		}
+		l.analyze(m)
+	}
+
+	slices.SortStableFunc(l.diagnostics, func(a, b Diagnostic) int {
+		if a.File != b.File {
+			return strings.Compare(a.File, b.File)
+		}
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Column - b.Column
+	})
+
+	return l.diagnostics, nil
+}
+
+// Load parses the file at path and the modules it imports without reporting diagnostics
+func Load(path string, opts Options) (*Module, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	l := &linter{
+		opts:    opts,
+		modules: make(map[string]*Module),
+	}
+	return l.load(abs)
+}
+
+// Lookup resolves a reference such as "name" or "module.member" to the anchor it points to
+// and the module defining it
+func (m *Module) Lookup(name string) (*Definition, *Module) {
+	segments := strings.Split(name, ".")
+	first, _ := strings.CutSuffix(segments[0], "?")
+	if def, ok := m.Anchors[first]; ok {
+		return def, m
+	}
+	imp, ok := m.Imports[first]
+	if !ok || imp.Module == nil || len(segments) < 2 {
+		return nil, nil
+	}
+	member, _ := strings.CutSuffix(segments[1], "?")
+	if def, ok := imp.Module.Anchors[member]; ok {
+		return def, imp.Module
+	}
+	return nil, nil
+}
+
+// Signature describes a lambda definition, e.g. "lambda(name: string, image)"
+func (d *Definition) Signature() string {
+	if !d.Lambda {
+		return ""
+	}
+	params := make([]string, 0, len(d.Params))
+	for i, param := range arrayItems(arrayItems(d.Node)[1]) {
+		if typeName := tagType(param); typeName != "" {
+			params = append(params, d.Params[i]+": "+typeName)
+		} else {
+			params = append(params, d.Params[i])
+		}
+	}
+	return "lambda(" + strings.Join(params, ", ") + ")"
+}
+
+// load parses a file and collects its anchors and imports, loading imported files recursively
+func (l *linter) load(path string) (*Module, error) {
+	if m, ok := l.modules[path]; ok {
+		return m, nil
+	}
+
+	m := &Module{
+		Path:    path,
+		Anchors: make(map[string]*Definition),
+		Imports: make(map[string]*Import),
+	}
+	l.modules[path] = m
+
+	var reader io.Reader
+	if src, ok := l.opts.Sources[path]; ok {
+		reader = bytes.NewReader(src)
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	documents, err := parseDocuments(reader, path)
+	if err != nil {
+		line := 1
+		if match := errorLinePattern.FindStringSubmatch(err.Error()); match != nil {
+			line, _ = strconv.Atoi(match[1])
+		}
+		m.parseErr = &Diagnostic{
+			Rule:     RuleParseError,
+			Severity: SeverityError,
+			Message:  err.Error(),
+			File:     path,
+			Line:     line,
+			Column:   1,
+		}
+		return m, nil
+	}
+	m.Documents = documents
+
+	for _, document := range documents {
+		l.collect(m, document, false)
+	}
+
+	return m, nil
+}
+
+func parseDocuments(reader io.Reader, location string) ([]*core.YispNode, error) {
+	decoder := yaml.NewDecoder(reader)
+
+	documents := make([]*core.YispNode, 0)
+	for {
+		var root yaml.Node
+		err := decoder.Decode(&root)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+
+		parsed, err := engine.Parse(location, &root)
+		if err != nil {
+			return nil, err
+		}
+		if parsed != nil {
+			documents = append(documents, parsed)
+		}
+	}
+	return documents, nil
+}
+
+// collect records the anchors and imports defined anywhere below node
+func (l *linter) collect(m *Module, node *core.YispNode, evaluated bool) {
+	evaluated = evaluatedByTag(node, evaluated)
+
+	if node.Anchor != "" {
+		def := &Definition{Name: node.Anchor, Node: node}
+		if params, ok := lambdaParams(node, evaluated); ok {
+			def.Lambda = true
+			def.Params = params
+		}
+		if previous, ok := m.Anchors[node.Anchor]; ok {
+			l.report(node, RuleShadowed, SeverityWarning, fmt.Sprintf("anchor &%s redefines the anchor at line %d", node.Anchor, previous.Node.Attr.Line()))
+			def.used = previous.used
+		}
+		m.Anchors[node.Anchor] = def
+	}
+
+	switch node.Kind {
+	case core.KindArray:
+		items := arrayItems(node)
+		if evaluated && len(items) > 0 && headName(items[0]) == "import" {
+			for _, tupleNode := range items[1:] {
+				l.collectImport(m, tupleNode)
+			}
+			return
+		}
+		for _, item := range items {
+			l.collect(m, item, evaluated)
+		}
+	case core.KindMap:
+		for _, item := range mapItems(node) {
+			l.collect(m, item, evaluated)
+		}
+	}
+}
+
+func (l *linter) collectImport(m *Module, tupleNode *core.YispNode) {
+	tuple := arrayItems(tupleNode)
+	if len(tuple) != 2 {
+		l.report(tupleNode, RuleArity, SeverityError, fmt.Sprintf("import requires [name, path] pairs, got %d items", len(tuple)))
+		return
+	}
+	name, ok := tuple[0].Value.(string)
+	if !ok {
+		return
+	}
+	relpath, format := importPath(tuple[1])
+	if relpath == "" {
+		return
+	}
+
+	if previous, ok := m.Imports[name]; ok {
+		l.report(tupleNode, RuleShadowed, SeverityWarning, fmt.Sprintf("import %s redefines the import at line %d", name, previous.Node.Attr.Line()))
+	}
+
+	imp := &Import{Name: name, Node: tupleNode}
+	m.Imports[name] = imp
+
+	target, err := url.Parse(relpath)
+	if err != nil || target.Scheme != "" {
+		return // remote modules are not resolved statically
+	}
+
+	path := relpath
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(m.Path), relpath)
+	}
+	if stat, err := os.Stat(path); err == nil && stat.IsDir() {
+		path = filepath.Join(path, "index.yisp")
+	}
+	if filepath.Ext(path) != ".yisp" && format != "yisp" {
+		return
+	}
+
+	imported, err := l.load(path)
+	if err != nil {
+		l.report(tupleNode, RuleUndefinedSymbol, SeverityError, fmt.Sprintf("cannot import %s: %v", relpath, err))
+		return
+	}
+	imported.imported = true
+	imp.Module = imported
+}
+
+// analyze checks references, calls and usage in a loaded module
+func (l *linter) analyze(m *Module) {
+	root := &scope{names: map[string]*core.YispNode{}}
+	for _, document := range m.Documents {
+		l.walk(m, document, false, root)
+	}
+
+	if !m.imported {
+		for _, def := range m.Anchors {
+			if !def.used {
+				l.report(def.Node, RuleUnusedAnchor, SeverityWarning, fmt.Sprintf("anchor &%s is never used", def.Name))
+			}
+		}
+	}
+	for _, imp := range m.Imports {
+		if !imp.used {
+			l.report(imp.Node, RuleUnusedImport, SeverityWarning, fmt.Sprintf("import %s is never used", imp.Name))
+		}
+	}
+}
+
+func (l *linter) walk(m *Module, node *core.YispNode, evaluated bool, sc *scope) {
+	evaluated = evaluatedByTag(node, evaluated)
+
+	// casting to an undefined type is a no-op, so only mark defined types as used
+	if typeName := tagType(node); typeName != "" && l.defined(m, typeName, sc) {
+		l.resolve(m, node, typeName, sc)
+	}
+
+	switch node.Kind {
+	case core.KindSymbol:
+		name, _ := node.Value.(string)
+		l.resolve(m, node, name, sc)
+
+	case core.KindArray:
+		items := arrayItems(node)
+		if !evaluated || len(items) == 0 {
+			for _, item := range items {
+				l.walk(m, item, evaluated, sc)
+			}
+			return
+		}
+
+		head := items[0]
+		switch head.Kind {
+		case core.KindString:
+			op := headName(head)
+			switch op {
+			case "import":
+				return
+			case "if":
+				if len(items) != 4 {
+					l.report(head, RuleArity, SeverityError, fmt.Sprintf("if requires 3 arguments, got %d", len(items)-1))
+				}
+			case "lambda":
+				l.walkLambda(m, items, sc)
+				return
+			default:
+				if !slices.Contains(l.operators, op) {
+					message := fmt.Sprintf("unknown operator: %s", op)
+					if l.defined(m, op, sc) {
+						message += fmt.Sprintf(" (did you mean *%s?)", op)
+					} else if suggestion := suggest(op, l.operators); suggestion != "" {
+						message += fmt.Sprintf(" (did you mean %s?)", suggestion)
+					}
+					l.report(head, RuleUnknownOperator, SeverityError, message)
+				}
+			}
+		case core.KindSymbol:
+			name, _ := head.Value.(string)
+			def := l.resolve(m, head, name, sc)
+			if def != nil && def.Lambda && len(def.Params) != len(items)-1 {
+				l.report(head, RuleArity, SeverityError, fmt.Sprintf("%s takes %d arguments, got %d", name, len(def.Params), len(items)-1))
+			}
+		default:
+			l.walk(m, head, evaluated, sc)
+		}
+
+		for _, item := range items[1:] {
+			l.walk(m, item, evaluated, sc)
+		}
+
+	case core.KindMap:
+		for _, item := range mapItems(node) {
+			l.walk(m, item, evaluated, sc)
+		}
+	}
+}
+
+func (l *linter) walkLambda(m *Module, items []*core.YispNode, sc *scope) {
+	if len(items) < 3 {
+		l.report(items[0], RuleArity, SeverityError, fmt.Sprintf("lambda requires parameters and a body, got %d arguments", len(items)-1))
+		return
+	}
+
+	if typeName := tagType(items[1]); typeName != "" {
+		l.resolve(m, items[1], typeName, sc)
+	}
+
+	inner := &scope{parent: sc, names: map[string]*core.YispNode{}}
+	for _, param := range arrayItems(items[1]) {
+		if typeName := tagType(param); typeName != "" {
+			l.resolve(m, param, typeName, sc)
+		}
+		name, ok := param.Value.(string)
+		if !ok {
+			continue
+		}
+		if _, ok := sc.lookup(name); ok {
+			l.report(param, RuleShadowed, SeverityWarning, fmt.Sprintf("parameter %s shadows a parameter of an enclosing lambda", name))
+		} else if _, ok := m.Anchors[name]; ok {
+			l.report(param, RuleShadowed, SeverityWarning, fmt.Sprintf("parameter %s shadows the anchor &%s", name, name))
+		} else if _, ok := m.Imports[name]; ok {
+			l.report(param, RuleShadowed, SeverityWarning, fmt.Sprintf("parameter %s shadows the import %s", name, name))
+		}
+		inner.names[name] = param
+	}
+
+	for _, body := range items[2:] {
+		l.walk(m, body, true, inner)
+	}
+}
+
+// resolve marks the target of a reference as used and reports it if it is undefined.
+// It returns the anchor definition the reference points to, if any.
+func (l *linter) resolve(m *Module, node *core.YispNode, name string, sc *scope) *Definition {
+	segments := strings.Split(name, ".")
+	first, optional := strings.CutSuffix(segments[0], "?")
+
+	if _, ok := sc.lookup(first); ok {
+		return nil
+	}
+
+	if def, ok := m.Anchors[first]; ok {
+		def.used = true
+		if len(segments) == 1 {
+			return def
+		}
+		return nil
+	}
+
+	if imp, ok := m.Imports[first]; ok {
+		imp.used = true
+		if len(segments) == 1 || imp.Module == nil || imp.Module.parseErr != nil {
+			return nil
+		}
+		member, memberOptional := strings.CutSuffix(segments[1], "?")
+		def, ok := imp.Module.Anchors[member]
+		if !ok {
+			if !memberOptional {
+				message := fmt.Sprintf("module %s has no member %s", first, member)
+				if suggestion := suggest(member, mapKeys(imp.Module.Anchors)); suggestion != "" {
+					message += fmt.Sprintf(" (did you mean %s.%s?)", first, suggestion)
+				}
+				l.report(node, RuleUndefinedSymbol, SeverityError, message)
+			}
+			return nil
+		}
+		def.used = true
+		if len(segments) == 2 {
+			return def
+		}
+		return nil
+	}
+
+	if slices.Contains(builtinNames, first) || slices.Contains(l.opts.Globals, first) || optional {
+		return nil
+	}
+
+	candidates := append(mapKeys(m.Anchors), mapKeys(m.Imports)...)
+	for s := sc; s != nil; s = s.parent {
+		candidates = append(candidates, mapKeys(s.names)...)
+	}
+	message := fmt.Sprintf("undefined symbol: %s", first)
+	if suggestion := suggest(first, candidates); suggestion != "" {
+		message += fmt.Sprintf(" (did you mean %s?)", suggestion)
+	}
+	l.report(node, RuleUndefinedSymbol, SeverityError, message)
+	return nil
+}
+
+// defined reports whether name is bound, looking into imported modules for members
+func (l *linter) defined(m *Module, name string, sc *scope) bool {
+	segments := strings.Split(name, ".")
+	first, _ := strings.CutSuffix(segments[0], "?")
+	if _, ok := sc.lookup(first); ok {
+		return true
+	}
+	if _, ok := m.Anchors[first]; ok {
+		return true
+	}
+	if imp, ok := m.Imports[first]; ok {
+		if len(segments) == 1 || imp.Module == nil || imp.Module.parseErr != nil {
+			return true
+		}
+		member, _ := strings.CutSuffix(segments[1], "?")
+		_, ok := imp.Module.Anchors[member]
+		return ok
+	}
+	return slices.Contains(builtinNames, first) || slices.Contains(l.opts.Globals, first)
+}
+
+func (l *linter) report(node *core.YispNode, rule string, severity Severity, message string) {
+	l.diagnostics = append(l.diagnostics, Diagnostic{
+		Rule:     rule,
+		Severity: severity,
+		Message:  message,
+		File:     node.Attr.File(),
+		Line:     node.Attr.Line(),
+		Column:   node.Attr.Column(),
+	})
+}
+
+func evaluatedByTag(node *core.YispNode, evaluated bool) bool {
+	switch node.Tag {
+	case "!yisp":
+		return true
+	case "!quote":
+		return false
+	}
+	return evaluated
+}
+
+// tagType returns the type a tag casts to, if any
+func tagType(node *core.YispNode) string {
+	if node.Tag == "" || node.Tag == "!yisp" || node.Tag == "!quote" {
+		return ""
+	}
+	typeName := strings.TrimPrefix(node.Tag, "!")
+	if strings.HasPrefix(typeName, "!") {
+		return ""
+	}
+	return typeName
+}
+
+func headName(node *core.YispNode) string {
+	if node.Kind != core.KindString {
+		return ""
+	}
+	name, _ := node.Value.(string)
+	return name
+}
+
+// lambdaParams returns the parameter names if node is a lambda definition
+func lambdaParams(node *core.YispNode, evaluated bool) ([]string, bool) {
+	if !evaluated || node.Kind != core.KindArray {
+		return nil, false
+	}
+	items := arrayItems(node)
+	if len(items) < 3 || headName(items[0]) != "lambda" {
+		return nil, false
+	}
+	params := make([]string, 0)
+	for _, param := range arrayItems(items[1]) {
+		name, _ := param.Value.(string)
+		params = append(params, name)
+	}
+	return params, true
+}
+
+// importPath returns the path and the format of the module of an import, which is a path or a map {path: ..., format: ...}
+func importPath(node *core.YispNode) (string, string) {
+	if path, ok := node.Value.(string); ok {
+		return path, ""
+	}
+	m, ok := node.Value.(*core.YispMap)
+	if !ok {
+		return "", ""
+	}
+	fields := make(map[string]string, 2)
+	for _, key := range []string{"path", "format"} {
+		if value, ok := m.Get(key); ok {
+			if valueNode, ok := value.(*core.YispNode); ok {
+				fields[key], _ = valueNode.Value.(string)
+			}
+		}
+	}
+	return fields["path"], fields["format"]
+}
+
+func arrayItems(node *core.YispNode) []*core.YispNode {
+	arr, ok := node.Value.([]any)
+	if !ok {
+		return nil
+	}
+	items := make([]*core.YispNode, 0, len(arr))
+	for _, item := range arr {
+		if itemNode, ok := item.(*core.YispNode); ok {
+			items = append(items, itemNode)
+		}
+	}
+	return items
+}
+
+func mapItems(node *core.YispNode) []*core.YispNode {
+	m, ok := node.Value.(*core.YispMap)
+	if !ok {
+		return nil
+	}
+	items := make([]*core.YispNode, 0, m.Len())
+	for _, item := range m.AllFromFront() {
+		if itemNode, ok := item.(*core.YispNode); ok {
+			items = append(items, itemNode)
+		}
+	}
+	return items
+}
+
+func mapKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// suggest returns the candidate closest to name, if it is close enough to be a likely typo
+func suggest(name string, candidates []string) string {
+	best := ""
+	bestDistance := max(len(name)/3, 2) + 1
+	for _, candidate := range candidates {
+		distance := levenshtein(name, candidate)
+		if distance < bestDistance {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+	return best
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
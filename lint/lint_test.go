@@ -0,0 +1,84 @@
+package lint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLintTestdata(t *testing.T) {
+
+	files, err := filepath.Glob("../testdata/*.test.yisp")
+	if err != nil {
+		t.Fatalf("Error finding test files: %v", err)
+	}
+
+	diagnostics, err := Lint(files, Options{})
+	if err != nil {
+		t.Fatalf("Error linting test files: %v", err)
+	}
+
+	for _, d := range diagnostics {
+		assert.NotEqual(t, SeverityError, d.Severity, d.String())
+	}
+}
+
+func TestLintRules(t *testing.T) {
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "lib.yisp"), `!yisp &greet
+- lambda
+- [name]
+- [strings.concat, "hi ", *name]
+`)
+	main := filepath.Join(dir, "main.yisp")
+	writeFile(t, main, `!yisp
+- import
+- [lib, ./lib.yisp]
+- [unused, ./lib.yisp]
+---
+!yisp &mk
+- lambda
+- [name, greet]
+- [*lib.gret, *nme]
+---
+!yisp
+- [*mk, a]
+- [strings.concatt, *lib.greet]
+- [*lib.greet, a, b]
+`)
+
+	diagnostics, err := Lint([]string{main}, Options{})
+	if err != nil {
+		t.Fatalf("Error linting: %v", err)
+	}
+
+	type finding struct {
+		Line    int
+		Rule    string
+		Message string
+	}
+	findings := make([]finding, 0, len(diagnostics))
+	for _, d := range diagnostics {
+		findings = append(findings, finding{d.Line, d.Rule, d.Message})
+	}
+
+	assert.Equal(t, []finding{
+		{4, RuleUnusedImport, "import unused is never used"},
+		{9, RuleUndefinedSymbol, "module lib has no member gret (did you mean lib.greet?)"},
+		{9, RuleUndefinedSymbol, "undefined symbol: nme (did you mean name?)"},
+		{12, RuleArity, "mk takes 2 arguments, got 1"},
+		{13, RuleUnknownOperator, "unknown operator: strings.concatt (did you mean strings.concat?)"},
+		{14, RuleArity, "lib.greet takes 1 arguments, got 2"},
+	}, findings)
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	err := os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("Error writing %s: %v", path, err)
+	}
+}
@@ -0,0 +1,405 @@
+package lsp
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/totegamma/yisp/core"
+	"github.com/totegamma/yisp/engine"
+	"github.com/totegamma/yisp/lib"
+	"github.com/totegamma/yisp/lint"
+)
+
+var (
+	symbolPrefixPattern   = regexp.MustCompile(`\*([A-Za-z0-9_.?-]*)$`)
+	typePrefixPattern     = regexp.MustCompile(`!([A-Za-z0-9_.-]*)$`)
+	operatorPrefixPattern = regexp.MustCompile(`(^\s*-\s+|\[\s*)[A-Za-z0-9_.-]*$`)
+	keyPrefixPattern      = regexp.MustCompile(`^(\s*)((?:-\s+)*)[A-Za-z0-9_.-]*$`)
+	mapKeyPattern         = regexp.MustCompile(`^("[^"]*"|'[^']*'|[^\s#:'"][^:#]*?)\s*:(\s|$)`)
+	topLevelPattern       = regexp.MustCompile(`^(apiVersion|kind):\s*["']?([^"'\s#]+)`)
+)
+
+// builtinTypes are the type names bound in every root environment
+var builtinTypes = []string{"null", "bool", "int", "float", "string"}
+
+func (s *Server) definition(params textDocumentPositionParams) (any, error) {
+	doc, opts, err := s.snapshot(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(doc.text, "\n")
+	word, sigil, _ := wordAt(lines, params.Position)
+	if sigil != '*' && sigil != '!' {
+		return nil, nil
+	}
+
+	m, err := lint.Load(doc.path, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if def, defModule := m.Lookup(word); def != nil {
+		defLines := lines
+		if defModule.Path != doc.path {
+			defLines = fileLines(defModule.Path)
+		}
+		return Location{
+			URI:   pathToURI(defModule.Path),
+			Range: pointRange(defLines, def.Node.Attr.Line(), def.Node.Attr.Column()),
+		}, nil
+	}
+
+	name, _ := strings.CutSuffix(strings.Split(word, ".")[0], "?")
+	if imp, ok := m.Imports[name]; ok && imp.Module != nil {
+		return Location{URI: pathToURI(imp.Module.Path), Range: pointRange(nil, 1, 1)}, nil
+	}
+
+	return nil, nil
+}
+
+func (s *Server) hover(params textDocumentPositionParams) (any, error) {
+	doc, opts, err := s.snapshot(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(doc.text, "\n")
+	word, sigil, start := wordAt(lines, params.Position)
+	if word == "" {
+		return nil, nil
+	}
+
+	switch sigil {
+	case '*', '!':
+		m, err := lint.Load(doc.path, opts)
+		if err != nil {
+			return nil, err
+		}
+		if def, defModule := m.Lookup(word); def != nil {
+			return markdownHover(describeDefinition(def, defModule)), nil
+		}
+		name, _ := strings.CutSuffix(strings.Split(word, ".")[0], "?")
+		if imp, ok := m.Imports[name]; ok {
+			text := fmt.Sprintf("```yisp\nimport %s\n```", imp.Name)
+			if imp.Module != nil {
+				text += fmt.Sprintf("\n\n%s", imp.Module.Path)
+			}
+			return markdownHover(text), nil
+		}
+		if sigil == '!' && slices.Contains(builtinTypes, word) {
+			return markdownHover(fmt.Sprintf("```yisp\ntype %s\n```", word)), nil
+		}
+		return nil, nil
+	}
+
+	line := lines[params.Position.Line]
+	rest := strings.TrimLeft(line[min(start+len(word), len(line)):], " ")
+	if strings.HasPrefix(rest, ":") {
+		schema := documentSchema(s.opts.Engine.SchemaRegistry, lines, params.Position.Line)
+		field := schemaAt(schema, append(fieldPath(lines, params.Position.Line, start), word))
+		if field == nil {
+			return nil, nil
+		}
+		return markdownHover(describeSchema(word, field)), nil
+	}
+
+	if slices.Contains(operatorNames(), word) {
+		return markdownHover(fmt.Sprintf("```yisp\n%s\n```\nbuilt-in operator", word)), nil
+	}
+
+	return nil, nil
+}
+
+func (s *Server) completion(params textDocumentPositionParams) (any, error) {
+	doc, opts, err := s.snapshot(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(doc.text, "\n")
+	if params.Position.Line >= len(lines) {
+		return []CompletionItem{}, nil
+	}
+	line := lines[params.Position.Line]
+	prefix := line[:characterOffset(line, params.Position.Character)]
+
+	if match := symbolPrefixPattern.FindStringSubmatch(prefix); match != nil {
+		m, err := lint.Load(doc.path, opts)
+		if err != nil {
+			return nil, err
+		}
+		return symbolCompletions(m, match[1], false), nil
+	}
+
+	if match := typePrefixPattern.FindStringSubmatch(prefix); match != nil {
+		m, err := lint.Load(doc.path, opts)
+		if err != nil {
+			return nil, err
+		}
+		items := symbolCompletions(m, match[1], true)
+		for _, name := range builtinTypes {
+			items = append(items, CompletionItem{Label: name, Kind: completionKindVariable, Detail: "type"})
+		}
+		return items, nil
+	}
+
+	items := make([]CompletionItem, 0)
+	if operatorPrefixPattern.MatchString(prefix) {
+		for _, name := range operatorNames() {
+			items = append(items, CompletionItem{Label: name, Kind: completionKindFunction, Detail: "operator"})
+		}
+	}
+
+	if match := keyPrefixPattern.FindStringSubmatch(prefix); match != nil {
+		column := len(match[1]) + len(match[2])
+		schema := schemaAt(documentSchema(s.opts.Engine.SchemaRegistry, lines, params.Position.Line), fieldPath(lines, params.Position.Line, column))
+		if schema != nil {
+			properties, _ := schema.GetProperties()
+			for _, name := range sortedKeys(properties) {
+				item := CompletionItem{
+					Label:  name,
+					Kind:   completionKindField,
+					Detail: properties[name].Type,
+				}
+				if properties[name].Description != "" {
+					item.Documentation = &markupContent{Kind: "markdown", Value: properties[name].Description}
+				}
+				items = append(items, item)
+			}
+		}
+	}
+
+	return items, nil
+}
+
+// symbolCompletions lists the anchors and imports of m, or the members of an import
+// when partial is of the form "module.member"
+func symbolCompletions(m *lint.Module, partial string, typesOnly bool) []CompletionItem {
+	items := make([]CompletionItem, 0)
+
+	if moduleName, _, ok := strings.Cut(partial, "."); ok {
+		imp, ok := m.Imports[strings.TrimSuffix(moduleName, "?")]
+		if !ok || imp.Module == nil {
+			return items
+		}
+		for _, name := range sortedKeys(imp.Module.Anchors) {
+			items = append(items, definitionCompletion(imp.Module.Anchors[name]))
+		}
+		return items
+	}
+
+	for _, name := range sortedKeys(m.Anchors) {
+		items = append(items, definitionCompletion(m.Anchors[name]))
+	}
+	if !typesOnly {
+		for _, name := range sortedKeys(m.Imports) {
+			items = append(items, CompletionItem{Label: name, Kind: completionKindModule, Detail: "import"})
+		}
+	}
+	return items
+}
+
+func definitionCompletion(def *lint.Definition) CompletionItem {
+	if def.Lambda {
+		return CompletionItem{Label: def.Name, Kind: completionKindFunction, Detail: def.Signature()}
+	}
+	return CompletionItem{Label: def.Name, Kind: completionKindVariable, Detail: def.Node.Kind.String()}
+}
+
+func describeDefinition(def *lint.Definition, m *lint.Module) string {
+	signature := def.Signature()
+	if signature == "" {
+		signature = def.Node.Kind.String()
+	}
+	return fmt.Sprintf("```yisp\n&%s: %s\n```\n\n%s:%d", def.Name, signature, m.Path, def.Node.Attr.Line())
+}
+
+func describeSchema(name string, schema *core.Schema) string {
+	text := fmt.Sprintf("```yisp\n%s: %s\n```", name, schema.Type)
+	if schema.Description != "" {
+		text += "\n\n" + schema.Description
+	}
+	return text
+}
+
+func markdownHover(text string) hover {
+	return hover{Contents: markupContent{Kind: "markdown", Value: text}}
+}
+
+func operatorNames() []string {
+	return append(engine.OperatorNames(), lib.OperatorNames()...)
+}
+
+// fileLines returns the lines of a file, or nil if it cannot be read
+func fileLines(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return strings.Split(string(data), "\n")
+}
+
+// wordAt returns the identifier under pos, the sigil (* or !) directly before it if any,
+// and the byte offset where the identifier starts
+func wordAt(lines []string, pos Position) (string, byte, int) {
+	if pos.Line >= len(lines) {
+		return "", 0, 0
+	}
+	line := lines[pos.Line]
+	isWord := func(c byte) bool {
+		return c == '_' || c == '-' || c == '.' || c == '?' || c == '/' ||
+			('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+	}
+
+	start := characterOffset(line, pos.Character)
+	if start < len(line) && (line[start] == '*' || line[start] == '!') {
+		start++
+	}
+	end := start
+	for start > 0 && isWord(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isWord(line[end]) {
+		end++
+	}
+
+	var sigil byte
+	if start > 0 && (line[start-1] == '*' || line[start-1] == '!') {
+		sigil = line[start-1]
+	}
+	return line[start:end], sigil, start
+}
+
+// fieldPath returns the keys of the block mappings enclosing the given column of a line,
+// outermost first. Items of block sequences are represented by "[]".
+// It works on the raw text so that documents being edited need not parse.
+func fieldPath(lines []string, line, column int) []string {
+	path := make([]string, 0)
+	indent := column
+
+	current := lines[line][:min(column, len(lines[line]))]
+	if trimmed := strings.TrimLeft(current, " "); strings.HasPrefix(trimmed, "-") {
+		for rest := trimmed; strings.HasPrefix(rest, "-"); rest = strings.TrimLeft(rest[1:], " ") {
+			path = append(path, "[]")
+		}
+		indent = len(current) - len(trimmed)
+	}
+
+	for i := line - 1; i >= 0 && indent > 0; i-- {
+		text := lines[i]
+		if strings.HasPrefix(text, "---") {
+			break
+		}
+		stripped := strings.TrimLeft(text, " ")
+		if stripped == "" || strings.HasPrefix(stripped, "#") {
+			continue
+		}
+		lineIndent := len(text) - len(stripped)
+		if lineIndent >= indent {
+			continue
+		}
+
+		keyIndent := lineIndent
+		rest := stripped
+		dashes := make([]int, 0)
+		for strings.HasPrefix(rest, "- ") || rest == "-" {
+			dashes = append(dashes, keyIndent)
+			next := strings.TrimLeft(rest[1:], " ")
+			keyIndent += len(rest) - len(next)
+			rest = next
+		}
+
+		if keyIndent < indent {
+			if match := mapKeyPattern.FindStringSubmatch(rest); match != nil && opensBlock(rest[len(match[0]):]) {
+				path = append([]string{strings.Trim(match[1], `"'`)}, path...)
+				indent = keyIndent
+			}
+		}
+		for j := len(dashes) - 1; j >= 0; j-- {
+			if dashes[j] < indent {
+				path = append([]string{"[]"}, path...)
+				indent = dashes[j]
+			}
+		}
+	}
+
+	return path
+}
+
+// opensBlock reports whether the value after a mapping key continues on the following lines
+func opensBlock(value string) bool {
+	value = strings.TrimSpace(value)
+	for _, field := range strings.Fields(value) {
+		if strings.HasPrefix(field, "#") {
+			return true
+		}
+		if !strings.HasPrefix(field, "!") && !strings.HasPrefix(field, "&") {
+			return false
+		}
+	}
+	return true
+}
+
+// documentSchema looks up the schema for the apiVersion and kind of the document containing line
+func documentSchema(schemas core.SchemaRegistry, lines []string, line int) *core.Schema {
+	start := line
+	for start > 0 && !strings.HasPrefix(lines[start], "---") {
+		start--
+	}
+
+	var apiVersion, kind string
+	for i := start; i < len(lines); i++ {
+		if i > start && strings.HasPrefix(lines[i], "---") {
+			break
+		}
+		if match := topLevelPattern.FindStringSubmatch(lines[i]); match != nil {
+			if match[1] == "apiVersion" {
+				apiVersion = match[2]
+			} else {
+				kind = match[2]
+			}
+		}
+	}
+	if apiVersion == "" || kind == "" {
+		return nil
+	}
+
+	group, version, ok := strings.Cut(apiVersion, "/")
+	if !ok {
+		group, version = "", apiVersion
+	}
+	schema, err := schemas.SchemaByGVK(group, version, kind)
+	if err != nil {
+		return nil
+	}
+	return schema
+}
+
+// schemaAt descends from schema along path as returned by fieldPath
+func schemaAt(schema *core.Schema, path []string) *core.Schema {
+	for _, key := range path {
+		if schema == nil {
+			return nil
+		}
+		if key == "[]" {
+			schema, _ = schema.GetItems()
+		} else {
+			properties, _ := schema.GetProperties()
+			schema = properties[key]
+		}
+	}
+	return schema
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,124 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldPath(t *testing.T) {
+
+	lines := strings.Split(`apiVersion: v1
+kind: Pod
+metadata:
+  name: test
+spec:
+  containers:
+    - name: app
+      env:
+        - name: FOO
+          
+      image: nginx
+---
+spec:
+  `, "\n")
+
+	assert.Equal(t, []string{"metadata"}, fieldPath(lines, 3, 2))
+	assert.Equal(t, []string{"spec", "containers", "[]"}, fieldPath(lines, 6, 6))
+	assert.Equal(t, []string{"spec", "containers", "[]", "env", "[]"}, fieldPath(lines, 9, 10))
+	assert.Equal(t, []string{"spec", "containers", "[]"}, fieldPath(lines, 10, 6))
+	assert.Equal(t, []string{}, fieldPath(lines, 12, 0))
+	assert.Equal(t, []string{"spec"}, fieldPath(lines, 13, 2))
+}
+
+func TestWordAt(t *testing.T) {
+
+	lines := []string{"- [*podmod.mkpod, !string name]"}
+
+	word, sigil, start := wordAt(lines, Position{Line: 0, Character: 8})
+	assert.Equal(t, "podmod.mkpod", word)
+	assert.Equal(t, byte('*'), sigil)
+	assert.Equal(t, 4, start)
+
+	word, sigil, _ = wordAt(lines, Position{Line: 0, Character: 20})
+	assert.Equal(t, "string", word)
+	assert.Equal(t, byte('!'), sigil)
+}
+
+func TestFieldCompletion(t *testing.T) {
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	cache := filepath.Join(home, ".cache", "yisp")
+	writeFile(t, filepath.Join(cache, "gvk", "_v1_Pod.txt"), "io.k8s.api.core.v1.Pod")
+	writeFile(t, filepath.Join(cache, "schemas", "io.k8s.api.core.v1.Pod.json"), `{
+  "type": "object",
+  "properties": {
+    "spec": {
+      "type": "object",
+      "properties": {
+        "hostname": {"type": "string", "description": "Specifies the hostname of the Pod"},
+        "nodeName": {"type": "string"}
+      }
+    }
+  }
+}`)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pod.yisp")
+	text := "apiVersion: v1\nkind: Pod\nspec:\n  ho"
+
+	s := NewServer(strings.NewReader(""), &strings.Builder{}, Options{})
+	s.documents[pathToURI(path)] = &document{path: path, text: text}
+
+	result, err := s.completion(textDocumentPositionParams{
+		TextDocument: textDocumentIdentifier{URI: pathToURI(path)},
+		Position:     Position{Line: 3, Character: 4},
+	})
+	if err != nil {
+		t.Fatalf("Error completing: %v", err)
+	}
+
+	labels := make([]string, 0)
+	for _, item := range result.([]CompletionItem) {
+		labels = append(labels, item.Label)
+	}
+	assert.Equal(t, []string{"hostname", "nodeName"}, labels)
+
+	result, err = s.hover(textDocumentPositionParams{
+		TextDocument: textDocumentIdentifier{URI: pathToURI(path)},
+		Position:     Position{Line: 2, Character: 1},
+	})
+	if err != nil {
+		t.Fatalf("Error hovering: %v", err)
+	}
+	assert.Contains(t, result.(hover).Contents.Value, "spec: object")
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		t.Fatalf("Error creating %s: %v", filepath.Dir(path), err)
+	}
+	err = os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("Error writing %s: %v", path, err)
+	}
+}
+
+func TestPositionsInUTF16(t *testing.T) {
+
+	// 😀 is one character in yisp columns and two UTF-16 code units in LSP positions
+	lines := []string{`msg: "😀" *undefined`}
+
+	assert.Equal(t, Range{Start: Position{Line: 0, Character: 10}, End: Position{Line: 0, Character: 20}}, tokenRange(lines, 1, 10))
+	assert.Equal(t, len(`msg: "😀" `), characterOffset(lines[0], 10))
+
+	word, sigil, _ := wordAt(lines, Position{Line: 0, Character: 12})
+	assert.Equal(t, "undefined", word)
+	assert.Equal(t, byte('*'), sigil)
+}
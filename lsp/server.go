@@ -0,0 +1,467 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/totegamma/yisp/core"
+	"github.com/totegamma/yisp/engine"
+	"github.com/totegamma/yisp/lint"
+)
+
+// evalDelay is how long the server waits after the last edit before evaluating a document
+const evalDelay = 500 * time.Millisecond
+
+type Options struct {
+	// Engine configures the engine used to evaluate open documents for diagnostics.
+	// Its schema registry should not fetch schemas over the network, since documents are evaluated on every edit.
+	Engine engine.Options
+	// AllowedEnvVars lists the environment variables documents may read, as the AllowedEnvVars config does for builds
+	AllowedEnvVars []string
+	// Lint configures the static checks. Sources is managed by the server.
+	Lint    lint.Options
+	Version string
+	// Log receives protocol errors. Nothing is logged if nil.
+	Log io.Writer
+}
+
+type document struct {
+	path    string
+	text    string
+	version int
+	// evalDiagnostics are the results of the last evaluation of this version
+	evalDiagnostics []Diagnostic
+	evalTimer       *time.Timer
+}
+
+// Server is a language server for yisp speaking LSP over a byte stream
+type Server struct {
+	opts   Options
+	reader *bufio.Reader
+	writer io.Writer
+	logger *log.Logger
+
+	mu        sync.Mutex
+	writeMu   sync.Mutex
+	documents map[string]*document
+	shutdown  bool
+}
+
+func NewServer(in io.Reader, out io.Writer, opts Options) *Server {
+	logOut := opts.Log
+	if logOut == nil {
+		logOut = io.Discard
+	}
+	if opts.Engine.SchemaRegistry == nil {
+		opts.Engine.SchemaRegistry = core.DefaultSchemaRegistry()
+	}
+	return &Server{
+		opts:      opts,
+		reader:    bufio.NewReader(in),
+		writer:    out,
+		logger:    log.New(logOut, "yisp lsp: ", log.LstdFlags),
+		documents: make(map[string]*document),
+	}
+}
+
+// Run serves requests until the client sends exit or closes the stream
+func (s *Server) Run() error {
+	for {
+		msg, err := readMessage(s.reader)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit without shutdown")
+			}
+			return nil
+		}
+
+		result, err := s.handle(msg)
+		if msg.ID == nil {
+			if err != nil {
+				s.logger.Printf("%s: %v", msg.Method, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			var rerr *responseError
+			if !errors.As(err, &rerr) {
+				rerr = &responseError{Code: codeInternalError, Message: err.Error()}
+			}
+			s.write(&errorResponse{JSONRPC: "2.0", ID: msg.ID, Error: *rerr})
+			continue
+		}
+		s.write(&response{JSONRPC: "2.0", ID: msg.ID, Result: result})
+	}
+}
+
+func (e *responseError) Error() string {
+	return e.Message
+}
+
+func (s *Server) write(msg any) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	err := writeMessage(s.writer, msg)
+	if err != nil {
+		s.logger.Printf("write: %v", err)
+	}
+}
+
+func (s *Server) handle(msg *message) (any, error) {
+	switch msg.Method {
+	case "initialize":
+		return initializeResult{
+			Capabilities: serverCapabilities{
+				TextDocumentSync: textDocumentSyncOptions{
+					OpenClose: true,
+					Change:    1, // full document sync
+					Save:      saveOptions{IncludeText: true},
+				},
+				DefinitionProvider: true,
+				HoverProvider:      true,
+				CompletionProvider: completionOptions{TriggerCharacters: []string{"*", ".", "!"}},
+			},
+			ServerInfo: serverInfo{Name: "yisp", Version: s.opts.Version},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		s.update(params.TextDocument.URI, params.TextDocument.Text, params.TextDocument.Version)
+		return nil, nil
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+		s.update(params.TextDocument.URI, text, params.TextDocument.Version)
+		return nil, nil
+	case "textDocument/didSave":
+		var params didSaveParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		if params.Text != nil {
+			s.mu.Lock()
+			version := 0
+			if doc, ok := s.documents[params.TextDocument.URI]; ok {
+				version = doc.version
+			}
+			s.mu.Unlock()
+			s.update(params.TextDocument.URI, *params.Text, version)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		if doc, ok := s.documents[params.TextDocument.URI]; ok && doc.evalTimer != nil {
+			doc.evalTimer.Stop()
+		}
+		delete(s.documents, params.TextDocument.URI)
+		s.mu.Unlock()
+		s.write(&notification{
+			JSONRPC: "2.0",
+			Method:  "textDocument/publishDiagnostics",
+			Params:  publishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}},
+		})
+		return nil, nil
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.definition(params)
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.hover(params)
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.completion(params)
+	}
+
+	if msg.ID == nil || strings.HasPrefix(msg.Method, "$/") {
+		return nil, nil // unknown notifications are ignored
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method not found: %s", msg.Method)}
+}
+
+func unmarshalParams(msg *message, params any) error {
+	err := json.Unmarshal(msg.Params, params)
+	if err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// update stores new document contents, publishes lint diagnostics and schedules an evaluation
+func (s *Server) update(uri, text string, version int) {
+	path, err := uriToPath(uri)
+	if err != nil {
+		s.logger.Printf("%s: %v", uri, err)
+		return
+	}
+
+	s.mu.Lock()
+	doc, ok := s.documents[uri]
+	if !ok {
+		doc = &document{path: path}
+		s.documents[uri] = doc
+	}
+	doc.text = text
+	doc.version = version
+	doc.evalDiagnostics = nil
+	if doc.evalTimer != nil {
+		doc.evalTimer.Stop()
+	}
+	doc.evalTimer = time.AfterFunc(evalDelay, func() { s.evaluate(uri, version) })
+	s.mu.Unlock()
+
+	s.publish(uri)
+}
+
+// evaluate runs the engine on a document and publishes the resulting error, if any
+func (s *Server) evaluate(uri string, version int) {
+	s.mu.Lock()
+	doc, ok := s.documents[uri]
+	if !ok || doc.version != version {
+		s.mu.Unlock()
+		return
+	}
+	path, text := doc.path, doc.text
+	s.mu.Unlock()
+
+	diagnostics := evaluationDiagnostics(path, text, s.opts)
+
+	s.mu.Lock()
+	doc, ok = s.documents[uri]
+	if !ok || doc.version != version {
+		s.mu.Unlock()
+		return
+	}
+	doc.evalDiagnostics = diagnostics
+	s.mu.Unlock()
+
+	s.publish(uri)
+}
+
+func evaluationDiagnostics(path, text string, opts Options) (diagnostics []Diagnostic) {
+	defer func() {
+		if r := recover(); r != nil {
+			diagnostics = []Diagnostic{{
+				Severity: severityError,
+				Source:   "yisp",
+				Message:  fmt.Sprintf("evaluation panicked: %v", r),
+			}}
+		}
+	}()
+
+	e := engine.NewEngine(opts.Engine)
+	// commands would prompt on stdin, which carries the protocol, and run on every edit, as would remote includes
+	e.SetOption("net.gammalab.yisp.exec.disabled", true)
+	e.SetOption("net.gammalab.yisp.remote.disabled", true)
+	e.SetOption("net.gammalab.yisp.env.allowed_vars", opts.AllowedEnvVars)
+	_, err := e.EvaluateReaderToYaml(strings.NewReader(text), path)
+	if err == nil {
+		return []Diagnostic{}
+	}
+
+	var evalErr *core.ErrorTypeEvaluation
+	if errors.As(err, &evalErr) {
+		root := evalErr.GetRoot()
+		diagnostic := Diagnostic{
+			Severity: severityError,
+			Source:   "yisp",
+			Message:  root.Message,
+		}
+		if root.Node != nil && root.Node.Attr.File() == path {
+			diagnostic.Range = tokenRange(strings.Split(text, "\n"), root.Node.Attr.Line(), root.Node.Attr.Column())
+		} else if root.Node != nil {
+			diagnostic.Message = fmt.Sprintf("%s (at %s:%d:%d)", root.Message, root.Node.Attr.File(), root.Node.Attr.Line(), root.Node.Attr.Column())
+		}
+		return []Diagnostic{diagnostic}
+	}
+
+	return []Diagnostic{{
+		Severity: severityError,
+		Source:   "yisp",
+		Message:  err.Error(),
+	}}
+}
+
+func (s *Server) publish(uri string) {
+	s.mu.Lock()
+	doc, ok := s.documents[uri]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	path := doc.path
+	lines := strings.Split(doc.text, "\n")
+	diagnostics := append([]Diagnostic{}, doc.evalDiagnostics...)
+	opts := s.lintOptions()
+	s.mu.Unlock()
+
+	found, err := lint.Lint([]string{path}, opts)
+	if err != nil {
+		s.logger.Printf("lint %s: %v", path, err)
+	}
+	for _, d := range found {
+		if d.File != path {
+			continue
+		}
+		severity := severityWarning
+		if d.Severity == lint.SeverityError {
+			severity = severityError
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    tokenRange(lines, d.Line, d.Column),
+			Severity: severity,
+			Code:     d.Rule,
+			Source:   "yisp lint",
+			Message:  d.Message,
+		})
+	}
+
+	s.write(&notification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params:  publishDiagnosticsParams{URI: uri, Diagnostics: diagnostics},
+	})
+}
+
+// lintOptions returns the lint options with the open documents as sources. s.mu must be held.
+func (s *Server) lintOptions() lint.Options {
+	opts := s.opts.Lint
+	opts.Sources = make(map[string][]byte, len(s.documents))
+	for _, doc := range s.documents {
+		opts.Sources[doc.path] = []byte(doc.text)
+	}
+	return opts
+}
+
+// snapshot returns the document at uri and the lint options to analyze it
+func (s *Server) snapshot(uri string) (*document, lint.Options, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc, ok := s.documents[uri]
+	if !ok {
+		return nil, lint.Options{}, &responseError{Code: codeInvalidParams, Message: fmt.Sprintf("document is not open: %s", uri)}
+	}
+	copied := *doc
+	return &copied, s.lintOptions(), nil
+}
+
+func uriToPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("unsupported uri scheme: %s", u.Scheme)
+	}
+	return filepath.FromSlash(u.Path), nil
+}
+
+func pathToURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// tokenRange converts a 1-based yisp position into an LSP range covering the token starting there
+func tokenRange(lines []string, line, column int) Range {
+	r := pointRange(lines, line, column)
+	if r.Start.Line >= len(lines) {
+		return r
+	}
+	text := lines[r.Start.Line]
+	start := columnOffset(text, column)
+	end := start
+	for end < len(text) && !strings.ContainsRune(" \t,[]{}", rune(text[end])) {
+		end++
+	}
+	if end == start {
+		end = len(strings.TrimRight(text, " \t"))
+	}
+	r.End.Character = max(utf16Len(text[:max(end, start)]), r.Start.Character)
+	return r
+}
+
+// pointRange converts a 1-based yisp position into an empty LSP range.
+// yisp columns count characters and LSP ones UTF-16 code units, so lines holds the source they are counted in;
+// without it, the source is assumed to be ASCII.
+func pointRange(lines []string, line, column int) Range {
+	pos := Position{Line: max(line-1, 0), Character: max(column-1, 0)}
+	if pos.Line < len(lines) {
+		text := lines[pos.Line]
+		pos.Character = utf16Len(text[:columnOffset(text, column)])
+	}
+	return Range{Start: pos, End: pos}
+}
+
+// columnOffset returns the byte offset of a 1-based yisp column in text
+func columnOffset(text string, column int) int {
+	offset := 0
+	for i := 1; i < column && offset < len(text); i++ {
+		_, size := utf8.DecodeRuneInString(text[offset:])
+		offset += size
+	}
+	return offset
+}
+
+// characterOffset returns the byte offset of an LSP character, counted in UTF-16 code units, in text
+func characterOffset(text string, character int) int {
+	units := 0
+	for offset, r := range text {
+		if units >= character {
+			return offset
+		}
+		units += utf16.RuneLen(r)
+	}
+	return len(text)
+}
+
+// utf16Len returns the length of text in UTF-16 code units
+func utf16Len(text string) int {
+	units := 0
+	for _, r := range text {
+		units += utf16.RuneLen(r)
+	}
+	return units
+}
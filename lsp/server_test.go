@@ -0,0 +1,84 @@
+package lsp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluationDoesNotRunCommands(t *testing.T) {
+
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "ran")
+	text := `!yisp
+- exec.cmd
+- cmd: touch
+  args: !quote [` + marker + `]
+  asString: true
+`
+
+	// a prompt would consume the byte waiting on stdin
+	stdin, input, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Error creating pipe: %v", err)
+	}
+	defer stdin.Close()
+	_, err = input.Write([]byte("\n"))
+	if err != nil {
+		t.Fatalf("Error writing to pipe: %v", err)
+	}
+	input.Close()
+
+	original := os.Stdin
+	os.Stdin = stdin
+	diagnostics := evaluationDiagnostics(filepath.Join(dir, "main.yisp"), text, Options{})
+	os.Stdin = original
+
+	if assert.Len(t, diagnostics, 1) {
+		assert.Contains(t, diagnostics[0].Message, "exec.cmd is disabled")
+		assert.Equal(t, 2, diagnostics[0].Range.Start.Line)
+	}
+	assert.NoFileExists(t, marker)
+
+	unread := make([]byte, 1)
+	n, _ := stdin.Read(unread)
+	assert.Equal(t, 1, n)
+}
+
+func TestEvaluationDoesNotFetchRemoteFiles(t *testing.T) {
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte("a: 1\n"))
+	}))
+	defer server.Close()
+
+	text := "!yisp [include, " + server.URL + "/values.yaml]\n"
+	diagnostics := evaluationDiagnostics(filepath.Join(t.TempDir(), "main.yisp"), text, Options{})
+
+	if assert.Len(t, diagnostics, 1) {
+		assert.Contains(t, diagnostics[0].Message, "remote files are not fetched here")
+	}
+	assert.Equal(t, int32(0), requests.Load())
+}
+
+func TestEvaluationReadsAllowedEnvVars(t *testing.T) {
+	t.Setenv("YISP_LSP_TEST_NAME", "web")
+	t.Setenv("YISP_LSP_SECRET", "hunter2")
+	path := filepath.Join(t.TempDir(), "main.yisp")
+	opts := Options{AllowedEnvVars: []string{"YISP_LSP_TEST_*"}}
+
+	diagnostics := evaluationDiagnostics(path, "name: !yisp [env.get, YISP_LSP_TEST_NAME]\n", opts)
+	assert.Empty(t, diagnostics)
+
+	diagnostics = evaluationDiagnostics(path, "name: !yisp [env.get, YISP_LSP_SECRET]\n", opts)
+	if assert.Len(t, diagnostics, 1) {
+		assert.Contains(t, diagnostics[0].Message, "environment variable YISP_LSP_SECRET is not allowed")
+	}
+}
@@ -0,0 +1,161 @@
+package yisptest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ansiEscape matches the color codes in rendered error messages
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	File      string        `xml:"file,attr,omitempty"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// WriteJUnit writes results as a JUnit XML report with a single test suite named name.
+// The golden file comparison and every deftest of a file are reported as separate test cases.
+func WriteJUnit(w io.Writer, name string, results []Result) error {
+	suite := junitTestSuite{Name: name}
+
+	var total time.Duration
+	for _, result := range results {
+		total += result.Duration
+
+		tc := junitTestCase{
+			Name:      result.Case.Name,
+			Classname: name,
+			File:      result.Case.Test,
+			Time:      seconds(result.Duration),
+		}
+		switch {
+		case result.Status == StatusError:
+			suite.Errors++
+			tc.Error = &junitFailure{
+				Message: ansiEscape.ReplaceAllString(result.Summary(), ""),
+				Body:    ansiEscape.ReplaceAllString(result.Details(), ""),
+			}
+		case len(result.Changes) > 0:
+			suite.Failures++
+			tc.Failure = &junitFailure{
+				Message: result.Summary(),
+				Body:    result.Details(),
+			}
+		}
+		suite.Cases = append(suite.Cases, tc)
+
+		for _, test := range result.Tests {
+			tc := junitTestCase{
+				Name:      result.Case.Name + "/" + test.Name,
+				Classname: name,
+				File:      test.File,
+				Time:      seconds(test.Duration),
+			}
+			if test.Err != nil {
+				suite.Errors++
+				message, _, _ := strings.Cut(test.Err.Error(), "\n")
+				tc.Error = &junitFailure{
+					Message: ansiEscape.ReplaceAllString(message, ""),
+					Body:    ansiEscape.ReplaceAllString(test.Err.Error(), ""),
+				}
+			} else if len(test.Failures) > 0 {
+				suite.Failures++
+				lines := make([]string, 0, len(test.Failures))
+				for _, failure := range test.Failures {
+					lines = append(lines, failure.String())
+				}
+				tc.Failure = &junitFailure{
+					Message: fmt.Sprintf("%d assertions failed", len(test.Failures)),
+					Body:    strings.Join(lines, "\n"),
+				}
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+	}
+	suite.Tests = len(suite.Cases)
+	suite.Time = seconds(total)
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	err = encoder.Encode(junitTestSuites{Suites: []junitTestSuite{suite}})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// Summary describes the outcome of a result in one line
+func (r Result) Summary() string {
+	switch r.Status {
+	case StatusFail:
+		if len(r.Changes) > 0 {
+			return fmt.Sprintf("output differs from %s in %d places", r.Case.Expected, len(r.Changes))
+		}
+		failed := 0
+		for _, test := range r.Tests {
+			if !test.Passed() {
+				failed++
+			}
+		}
+		return fmt.Sprintf("%d of %d tests failed", failed, len(r.Tests))
+	case StatusError:
+		message, _, _ := strings.Cut(r.Err.Error(), "\n")
+		return message
+	case StatusUpdated:
+		return fmt.Sprintf("updated %s", r.Case.Expected)
+	default:
+		return "ok"
+	}
+}
+
+// Details describes why a result failed, one change or error line per line
+func (r Result) Details() string {
+	switch r.Status {
+	case StatusFail:
+		lines := make([]string, 0, len(r.Changes))
+		for _, change := range r.Changes {
+			lines = append(lines, change.String())
+		}
+		return strings.Join(lines, "\n")
+	case StatusError:
+		return r.Err.Error()
+	default:
+		return ""
+	}
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,133 @@
+package yisptest
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/totegamma/yisp/diff"
+	"github.com/totegamma/yisp/engine"
+)
+
+type Status string
+
+const (
+	StatusPass    Status = "pass"
+	StatusFail    Status = "fail"
+	StatusError   Status = "error"
+	StatusUpdated Status = "updated"
+)
+
+type Result struct {
+	Case     Case
+	Status   Status
+	Duration time.Duration
+	// Changes turn the expected output into the rendered one
+	Changes []diff.Change
+	// Tests are the results of the deftest forms in the file
+	Tests []engine.TestResult
+	Err   error
+}
+
+// Run evaluates a test case, runs the deftest forms in it and compares its output with the golden file.
+// A file with deftest forms needs no golden file. With update set, the golden file is rewritten
+// instead when they differ.
+func Run(c Case, update bool) Result {
+	start := time.Now()
+	result := run(c, update)
+	result.Case = c
+	result.Duration = time.Since(start)
+	return result
+}
+
+func run(c Case, update bool) Result {
+	e := engine.NewEngine(engine.Options{
+		AllowUntypedManifest: c.Options.AllowUntypedManifest,
+		DisableTypeCheck:     c.Options.DisableTypeCheck,
+		RenderSpecialObjects: c.Options.RenderSpecialObjects,
+		CollectTests:         true,
+		Coverage:             c.Options.Coverage,
+		SchemaRegistry:       c.Options.SchemaRegistry,
+	})
+	e.SetOption("net.gammalab.yisp.exec.allow_cmd", c.Options.AllowCmd)
+	e.SetOption("net.gammalab.yisp.exec.allowed_go_pkgs", c.Options.AllowedGoPkgs)
+	e.SetOption("net.gammalab.yisp.env.allowed_vars", c.Options.AllowedEnvVars)
+
+	path, err := filepath.Abs(c.Test)
+	if err != nil {
+		return Result{Status: StatusError, Err: err}
+	}
+
+	rendered, err := e.EvaluateFileToYaml(path)
+	if err != nil {
+		return Result{Status: StatusError, Err: err}
+	}
+
+	result := Result{Status: StatusPass}
+	for _, test := range e.Tests() {
+		testResult := e.RunTest(test)
+		result.Tests = append(result.Tests, testResult)
+		if !testResult.Passed() {
+			result.Status = StatusFail
+		}
+	}
+
+	status, changes, err := compareGolden(c, rendered, update, len(result.Tests) > 0)
+	switch {
+	case err != nil:
+		result.Status = StatusError
+		result.Err = err
+	case status == StatusFail:
+		result.Status = StatusFail
+		result.Changes = changes
+	case status == StatusUpdated && result.Status == StatusPass:
+		result.Status = StatusUpdated
+	}
+	return result
+}
+
+// compareGolden compares rendered output with the golden file of c
+func compareGolden(c Case, rendered string, update, hasTests bool) (Status, []diff.Change, error) {
+	actual, err := diff.DecodeDocuments(strings.NewReader(rendered))
+	if err != nil {
+		return StatusError, nil, err
+	}
+
+	expectedSrc, err := os.ReadFile(c.Expected)
+	if errors.Is(err, os.ErrNotExist) {
+		if hasTests {
+			return StatusPass, nil, nil
+		}
+		if update {
+			return writeGolden(c, rendered)
+		}
+	}
+	if err != nil {
+		return StatusError, nil, err
+	}
+
+	expected, err := diff.DecodeDocuments(bytes.NewReader(expectedSrc))
+	if err != nil {
+		return StatusError, nil, err
+	}
+
+	changes := diff.Values(expected, actual)
+	if len(changes) == 0 {
+		return StatusPass, nil, nil
+	}
+	if update {
+		return writeGolden(c, rendered)
+	}
+	return StatusFail, changes, nil
+}
+
+func writeGolden(c Case, rendered string) (Status, []diff.Change, error) {
+	err := os.WriteFile(c.Expected, []byte(rendered), 0644)
+	if err != nil {
+		return StatusError, nil, err
+	}
+	return StatusUpdated, nil, nil
+}
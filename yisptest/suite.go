@@ -0,0 +1,153 @@
+package yisptest
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/totegamma/yisp/core"
+	"github.com/totegamma/yisp/engine"
+	"github.com/totegamma/yisp/internal/yaml"
+)
+
+// ManifestFile is the name of the file listing the tests of a directory
+const ManifestFile = "yisp-test.yaml"
+
+// Options configure the engine a test is evaluated with
+type Options struct {
+	AllowUntypedManifest bool `yaml:"allowUntypedManifest"`
+	DisableTypeCheck     bool `yaml:"disableTypeCheck"`
+	RenderSpecialObjects bool `yaml:"renderSpecialObjects"`
+	// AllowCmd, AllowedGoPkgs and AllowedEnvVars come from the command line and the user config only,
+	// so that a checked-in manifest cannot grant itself commands, Go packages or environment variables
+	AllowCmd       bool     `yaml:"-"`
+	AllowedGoPkgs  []string `yaml:"-"`
+	AllowedEnvVars []string `yaml:"-"`
+	// Coverage collects the evaluated nodes of all tests, if set
+	Coverage *engine.Coverage `yaml:"-"`
+	// SchemaRegistry looks up the schemas of manifests. core.DefaultSchemaRegistry is used if nil.
+	SchemaRegistry core.SchemaRegistry `yaml:"-"`
+}
+
+// Case is a yisp file whose rendered output is compared with a golden file
+type Case struct {
+	Name     string
+	Test     string
+	Expected string
+	Options  Options
+}
+
+type manifest struct {
+	Options yaml.Node `yaml:"options"`
+	Tests   []struct {
+		Name     string    `yaml:"name"`
+		Test     string    `yaml:"test"`
+		Expected string    `yaml:"expected"`
+		Options  yaml.Node `yaml:"options"`
+	} `yaml:"tests"`
+}
+
+// Discover finds the tests below dir. A directory containing a manifest file runs the tests listed in it,
+// and its subdirectories are left to the manifest. Other directories pair every *.test.yisp
+// with the *.expected.yisp next to it.
+func Discover(dir string, opts Options) ([]Case, error) {
+	cases := make([]Case, 0)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		manifestPath := filepath.Join(path, ManifestFile)
+		if _, err := os.Stat(manifestPath); err == nil {
+			found, err := LoadManifest(manifestPath, opts)
+			if err != nil {
+				return err
+			}
+			cases = append(cases, found...)
+			return fs.SkipDir
+		}
+
+		tests, err := filepath.Glob(filepath.Join(path, "*.test.yisp"))
+		if err != nil {
+			return err
+		}
+		for _, test := range tests {
+			expected := strings.TrimSuffix(test, ".test.yisp") + ".expected.yisp"
+			cases = append(cases, Case{
+				Name:     caseName(dir, test),
+				Test:     test,
+				Expected: expected,
+				Options:  opts,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cases, nil
+}
+
+// LoadManifest reads the tests listed in a manifest file.
+// Options in the manifest override opts, and options of a test override those of the manifest.
+func LoadManifest(path string, opts Options) ([]Case, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m manifest
+	err = yaml.Unmarshal(data, &m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if !m.Options.IsZero() {
+		err = m.Options.Decode(&opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid options: %w", path, err)
+		}
+	}
+
+	dir := filepath.Dir(path)
+	cases := make([]Case, 0, len(m.Tests))
+	for i, test := range m.Tests {
+		if test.Test == "" {
+			return nil, fmt.Errorf("%s: test %d has no test file", path, i)
+		}
+
+		c := Case{
+			Name:     test.Name,
+			Test:     filepath.Join(dir, test.Test),
+			Expected: filepath.Join(dir, test.Expected),
+			Options:  opts,
+		}
+		if test.Expected == "" {
+			c.Expected = strings.TrimSuffix(c.Test, ".test.yisp") + ".expected.yisp"
+		}
+		if c.Name == "" {
+			c.Name = caseName(dir, c.Test)
+		}
+		if !test.Options.IsZero() {
+			err = test.Options.Decode(&c.Options)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid options of %s: %w", path, c.Name, err)
+			}
+		}
+		cases = append(cases, c)
+	}
+	return cases, nil
+}
+
+func caseName(dir, test string) string {
+	name, err := filepath.Rel(dir, test)
+	if err != nil {
+		name = test
+	}
+	return strings.TrimSuffix(filepath.ToSlash(name), ".test.yisp")
+}
@@ -0,0 +1,136 @@
+package yisptest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/totegamma/yisp/diff"
+)
+
+func TestManifest(t *testing.T) {
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "pod.yisp"), "a: 1\nb: [1, 2]\n")
+	writeFile(t, filepath.Join(dir, "pod.expected.yaml"), "a: 2\nb: [1]\n")
+	writeFile(t, filepath.Join(dir, ManifestFile), `options:
+  allowUntypedManifest: true
+tests:
+  - name: pod
+    test: pod.yisp
+    expected: pod.expected.yaml
+    options:
+      disableTypeCheck: true
+`)
+
+	cases, err := Discover(dir, Options{AllowCmd: true})
+	if err != nil {
+		t.Fatalf("Error discovering tests: %v", err)
+	}
+
+	assert.Equal(t, []Case{{
+		Name:     "pod",
+		Test:     filepath.Join(dir, "pod.yisp"),
+		Expected: filepath.Join(dir, "pod.expected.yaml"),
+		Options: Options{
+			AllowUntypedManifest: true,
+			DisableTypeCheck:     true,
+			AllowCmd:             true,
+		},
+	}}, cases)
+
+	result := Run(cases[0], false)
+	assert.Equal(t, StatusFail, result.Status)
+	assert.Equal(t, []diff.Change{
+		{Op: diff.OpReplace, Path: "/0/a", From: 2, To: 1},
+		{Op: diff.OpAdd, Path: "/0/b/1", To: 2},
+	}, result.Changes)
+
+	result = Run(cases[0], true)
+	assert.Equal(t, StatusUpdated, result.Status)
+
+	result = Run(cases[0], false)
+	assert.Equal(t, StatusPass, result.Status)
+}
+
+func TestManifestCannotAllow(t *testing.T) {
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, ManifestFile), `options:
+  allowCmd: true
+  allowedGoPkgs: [github.com/example/pkg]
+  allowedEnvVars: ["*"]
+tests:
+  - test: a.test.yisp
+    options:
+      allowCmd: true
+      allowedEnvVars: [HOME]
+`)
+
+	cases, err := Discover(dir, Options{AllowedEnvVars: []string{"USER"}})
+	if err != nil {
+		t.Fatalf("Error discovering tests: %v", err)
+	}
+
+	assert.Len(t, cases, 1)
+	assert.False(t, cases[0].Options.AllowCmd)
+	assert.Nil(t, cases[0].Options.AllowedGoPkgs)
+	assert.Equal(t, []string{"USER"}, cases[0].Options.AllowedEnvVars)
+}
+
+func TestDiscoverManifestSubdirectories(t *testing.T) {
+
+	dir := t.TempDir()
+	err := os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	if err != nil {
+		t.Fatalf("Error creating directory: %v", err)
+	}
+	writeFile(t, filepath.Join(dir, "sub", "a.test.yisp"), "a: 1\n")
+	writeFile(t, filepath.Join(dir, ManifestFile), `tests:
+  - test: sub/a.test.yisp
+`)
+
+	cases, err := Discover(dir, Options{})
+	if err != nil {
+		t.Fatalf("Error discovering tests: %v", err)
+	}
+
+	assert.Len(t, cases, 1)
+	assert.Equal(t, filepath.Join(dir, "sub", "a.test.yisp"), cases[0].Test)
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	err := os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("Error writing %s: %v", path, err)
+	}
+}
+
+func TestDeftest(t *testing.T) {
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "unit.test.yisp")
+	writeFile(t, path, `!yisp
+- deftest
+- arithmetic
+- [assert-equal, 3, [+, 1, 1]]
+- [assert, [==, 1, 1]]
+- [assert-error, [+, 1, 1]]
+`)
+
+	result := Run(Case{Name: "unit", Test: path, Expected: filepath.Join(dir, "unit.expected.yisp")}, false)
+	assert.Equal(t, StatusFail, result.Status)
+	if assert.Len(t, result.Tests, 1) {
+		test := result.Tests[0]
+		assert.Equal(t, "arithmetic", test.Name)
+		assert.NoError(t, test.Err)
+		if assert.Len(t, test.Failures, 2) {
+			assert.Equal(t, 4, test.Failures[0].Line)
+			assert.Equal(t, "values differ (expected -> actual):\n~ (root): 3 -> 2", test.Failures[0].Message)
+			assert.Equal(t, 6, test.Failures[1].Line)
+		}
+	}
+}